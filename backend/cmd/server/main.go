@@ -6,12 +6,22 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"strings"
 	"syscall"
+	"time"
 
+	"github.com/PeterShin23/cockpit-coder/backend/internal/agents"
 	"github.com/PeterShin23/cockpit-coder/backend/internal/auth"
+	"github.com/PeterShin23/cockpit-coder/backend/internal/cmdexec"
+	"github.com/PeterShin23/cockpit-coder/backend/internal/events"
+	"github.com/PeterShin23/cockpit-coder/backend/internal/git"
 	"github.com/PeterShin23/cockpit-coder/backend/internal/httpserver"
+	"github.com/PeterShin23/cockpit-coder/backend/internal/jobs"
+	"github.com/PeterShin23/cockpit-coder/backend/internal/orchestrator"
+	"github.com/PeterShin23/cockpit-coder/backend/internal/policy"
 	"github.com/PeterShin23/cockpit-coder/backend/internal/pty"
+	"github.com/PeterShin23/cockpit-coder/backend/internal/recording"
 	"github.com/PeterShin23/cockpit-coder/backend/internal/session"
 )
 
@@ -22,6 +32,14 @@ func main() {
 	repoAllowlist := strings.Split(getEnv("REPO_ALLOWLIST", ""), ",")
 	cmdAllowlist := strings.Split(getEnv("CMD_ALLOWLIST", ""), ",")
 	corsOrigins := strings.Split(getEnv("CORS_ORIGINS", "http://localhost:19006"), ",")
+	ptyIdleTimeout := time.Duration(getEnvInt("PTY_IDLE_TIMEOUT_SECONDS", 1800)) * time.Second
+	dataDir := getEnv("DATA_DIR", filepath.Join(os.TempDir(), "cockpit-coder"))
+	maxCmdDuration := time.Duration(getEnvInt("CMD_MAX_SECONDS", 600)) * time.Second
+	worktreeMaxBytes := int64(getEnvInt("WORKTREE_MAX_MB", 2048)) << 20
+	worktreeTTL := time.Duration(getEnvInt("WORKTREE_TTL_HOURS", 72)) * time.Hour
+	agentsConfig := getEnv("AGENTS_CONFIG", "")
+	maxTaskDuration := time.Duration(getEnvInt("TASK_MAX_SECONDS", 3600)) * time.Second
+	confirmTimeout := time.Duration(getEnvInt("CONFIRM_TIMEOUT_SECONDS", 300)) * time.Second
 
 	// Handle JWT secret
 	if jwtSecret == "" {
@@ -35,13 +53,63 @@ func main() {
 	log.Printf("CORS origins: %v", corsOrigins)
 	log.Printf("Repo allowlist: %v", repoAllowlist)
 	log.Printf("Command allowlist: %v", cmdAllowlist)
+	log.Printf("Data directory: %s", dataDir)
 
 	// Initialize core components
 	sessionManager := session.NewMemoryManager()
-	ptyManager := pty.NewManager()
+	recordings, err := recording.NewStore(filepath.Join(dataDir, "recordings"))
+	if err != nil {
+		log.Fatalf("Failed to open recordings: %v", err)
+	}
+	ptyManager := pty.NewManager(ptyIdleTimeout, recordings.Record)
+	eventBus := events.NewMemoryBus()
+	sessionManager.OnEnd(eventBus.Drop)
+	securityPolicy := policy.NewPolicy(repoAllowlist, cmdAllowlist, maxCmdDuration, false)
+	if len(securityPolicy.RepoAllowlist) == 0 {
+		log.Println("WARNING: REPO_ALLOWLIST is empty, no sessions can be created")
+	}
+	cmdRunner := cmdexec.NewRunner(cmdexec.PolicyWrapper{IsCmdAllowed: securityPolicy.IsCmdAllowed}, ptyManager)
+	jobManager, err := jobs.NewManager(cmdRunner, eventBus, filepath.Join(dataDir, "jobs"))
+	if err != nil {
+		log.Fatalf("Failed to open jobs: %v", err)
+	}
+
+	// Worktrees of tasks still at work or under review are never expired
+	worktreeInUse := func(taskID string) bool {
+		task, err := sessionManager.GetTask(taskID)
+		return err == nil && !session.WorkspaceDone(task.Status)
+	}
+	worktrees, err := git.NewWorktreeManager(filepath.Join(dataDir, "worktrees"), worktreeMaxBytes, worktreeTTL, worktreeInUse)
+	if err != nil {
+		log.Fatalf("Failed to open worktrees: %v", err)
+	}
+
+	agentConfigs := map[string]agents.Config{}
+	if agentsConfig != "" {
+		agentConfigs, err = agents.LoadConfig(agentsConfig)
+		if err != nil {
+			log.Fatalf("Failed to load agents: %v", err)
+		}
+	}
+	log.Printf("Agents: %d configured", len(agentConfigs))
+	gitProvider := git.NewProvider()
+	agentFactory := agents.NewFactory(agentConfigs, ptyManager, gitProvider)
+	tasks := orchestrator.New(sessionManager, agentFactory, gitProvider, eventBus, maxTaskDuration)
+	tasks.SetConfirmTimeout(confirmTimeout)
 
 	// Setup HTTP server
-	server := httpserver.NewServer(sessionManager, ptyManager)
+	server := httpserver.NewServer(httpserver.Deps{
+		Sessions:   sessionManager,
+		PTYs:       ptyManager,
+		Recordings: recordings,
+		Policy:     securityPolicy,
+		Jobs:       jobManager,
+		Events:     eventBus,
+		Git:        gitProvider,
+		Worktrees:  worktrees,
+		Agents:     agentFactory,
+		Tasks:      tasks,
+	})
 
 	// Setup graceful shutdown
 	stop := make(chan os.Signal, 1)
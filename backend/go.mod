@@ -8,4 +8,4 @@ require (
 	github.com/gorilla/mux v1.8.1
 )
 
-require github.com/gorilla/websocket v1.5.3 // indirect
+require github.com/gorilla/websocket v1.5.3
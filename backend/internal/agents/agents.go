@@ -2,19 +2,28 @@ package agents
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"syscall"
 	"time"
 
 	"github.com/PeterShin23/cockpit-coder/backend/internal/git"
+	"github.com/PeterShin23/cockpit-coder/backend/internal/pty"
 )
 
 // Agent interface for AI agents
 type Agent interface {
-	StartTask(ctx context.Context, instruction, repo string) (string, error)
+	// StartTask starts the agent on a task of a session, working on
+	// instruction in repo, and returns its ID for the run
+	StartTask(ctx context.Context, sessionID, taskID, instruction, repo string) (string, error)
 	StreamPTY(ctx context.Context, taskID string) (<-chan []byte, error)
 	GetPatches(ctx context.Context, taskID string) ([]git.FilePatch, error)
 	ApplyPatches(ctx context.Context, taskID string, sel []git.PatchSelection) error
 	RunCommand(ctx context.Context, cmd string) (<-chan []byte, error)
+	// Wait blocks until the task's agent exits and returns its exit code
+	Wait(ctx context.Context, taskID string) (int, error)
+	// Signal signals the task's agent and every process it started
+	Signal(taskID string, sig syscall.Signal) error
 }
 
 // Factory interface for creating agents
@@ -22,33 +31,56 @@ type Factory interface {
 	For(kind string) (Agent, error)
 }
 
+// ErrUnknownAgent is returned for agent kinds that have no config
+var ErrUnknownAgent = errors.New("unknown agent")
+
 // agentFactory implements the Factory interface
-type agentFactory struct{}
+type agentFactory struct {
+	configs map[string]Config
+	ptys    pty.Manager
+	git     git.Provider
+}
 
-// NewFactory creates a new agent factory
-func NewFactory() Factory {
-	return &agentFactory{}
+// NewFactory creates a new agent factory that runs the configured kinds as
+// subprocesses. The "mock" kind is always available unless configured.
+func NewFactory(configs map[string]Config, ptys pty.Manager, gitProvider git.Provider) Factory {
+	return &agentFactory{
+		configs: configs,
+		ptys:    ptys,
+		git:     gitProvider,
+	}
 }
 
 // For creates an agent by kind
 func (f *agentFactory) For(kind string) (Agent, error) {
-	switch kind {
-	case "claude", "cline", "roo", "kilo":
+	if config, ok := f.configs[kind]; ok {
+		return NewSubprocessAgent(kind, config, f.ptys, f.git), nil
+	}
+	if kind == "mock" {
 		return &MockAgent{}, nil
-	default:
-		return &MockAgent{}, nil // Default to mock agent
 	}
+	return nil, fmt.Errorf("%w %q", ErrUnknownAgent, kind)
 }
 
 // MockAgent implements the Agent interface for testing
 type MockAgent struct{}
 
 // StartTask starts a mock task
-func (m *MockAgent) StartTask(ctx context.Context, instruction, repo string) (string, error) {
+func (m *MockAgent) StartTask(ctx context.Context, sessionID, taskID, instruction, repo string) (string, error) {
 	// Simulate task start
 	return "mock-task-id", nil
 }
 
+// Wait returns at once; the mock task is done as soon as it starts
+func (m *MockAgent) Wait(ctx context.Context, taskID string) (int, error) {
+	return 0, nil
+}
+
+// Signal does nothing; the mock task has no process
+func (m *MockAgent) Signal(taskID string, sig syscall.Signal) error {
+	return nil
+}
+
 // StreamPTY streams mock PTY output
 func (m *MockAgent) StreamPTY(ctx context.Context, taskID string) (<-chan []byte, error) {
 	ch := make(chan []byte, 100)
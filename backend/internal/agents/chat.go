@@ -0,0 +1,227 @@
+package agents
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ChatEnv names the variable that gives a chat agent the path of its
+// conversation socket
+const ChatEnv = "COCKPIT_CHAT"
+
+// Conversation protocol message types
+const (
+	// ChatUserMessage carries a follow-up from the user to the agent
+	ChatUserMessage = "user_message"
+	// ChatAgent carries a reply from the agent to the user
+	ChatAgent = "agent"
+	// ChatConfirmation is the agent asking for approval, with its own ID
+	// and the question as Content. The agent waits for a confirmation with
+	// the same ID and Confirmed set in reply.
+	ChatConfirmation = "confirmation"
+)
+
+// ErrNoChat is returned when talking to an agent that does not hold
+// conversations
+var ErrNoChat = errors.New("agent does not chat")
+
+// ChatMessage is one line of the conversation protocol. Agents configured
+// with chat connect to the Unix socket named by COCKPIT_CHAT and exchange
+// newline-delimited JSON messages over it:
+//
+//	{"type": "agent", "content": "Looking at the tests now"}
+//	{"type": "confirmation", "id": "1", "content": "Delete build/?"}
+//	{"type": "user_message", "id": "…", "content": "Also fix the docs"}
+//	{"type": "confirmation", "id": "1", "confirmed": false, "reason": "timed out"}
+type ChatMessage struct {
+	Type      string `json:"type"`
+	ID        string `json:"id,omitempty"`
+	Content   string `json:"content,omitempty"`
+	Confirmed *bool  `json:"confirmed,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// Conversant is implemented by agents the user can talk with while they
+// work
+type Conversant interface {
+	// Messages returns what the task's agent says, until it exits. It fails
+	// with ErrNoChat if the agent does not hold conversations.
+	Messages(taskID string) (<-chan ChatMessage, error)
+	// Say sends a message to the task's agent
+	Say(taskID string, msg ChatMessage) error
+}
+
+// chatDrainTimeout bounds how long messages are read from an agent that has
+// exited
+const chatDrainTimeout = 2 * time.Second
+
+// chat is the conversation socket of one agent run. The agent may connect
+// more than once; messages go to its latest connection, and those sent
+// before it first connects wait for it.
+type chat struct {
+	dir      string
+	listener net.Listener
+	out      chan ChatMessage
+	done     chan struct{}
+	wg       sync.WaitGroup
+
+	mu      sync.Mutex
+	conn    net.Conn
+	pending []ChatMessage
+	closed  bool
+}
+
+// newChat listens on a socket in a fresh temporary directory
+func newChat() (*chat, error) {
+	dir, err := os.MkdirTemp("", "cockpit-chat-")
+	if err != nil {
+		return nil, err
+	}
+	listener, err := net.Listen("unix", filepath.Join(dir, "chat.sock"))
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+
+	c := &chat{
+		dir:      dir,
+		listener: listener,
+		out:      make(chan ChatMessage, 100),
+		done:     make(chan struct{}),
+	}
+	c.wg.Add(1)
+	go c.accept()
+	return c, nil
+}
+
+// path is where the agent connects
+func (c *chat) path() string {
+	return c.listener.Addr().String()
+}
+
+// accept takes the agent's connections until the chat is closed
+func (c *chat) accept() {
+	defer c.wg.Done()
+	for {
+		conn, err := c.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		c.mu.Lock()
+		if c.closed {
+			c.mu.Unlock()
+			conn.Close()
+			return
+		}
+		if c.conn != nil {
+			c.conn.Close()
+		}
+		c.conn = conn
+		for _, msg := range c.pending {
+			c.writeLocked(msg)
+		}
+		c.pending = nil
+		c.mu.Unlock()
+
+		c.wg.Add(1)
+		go c.read(conn)
+	}
+}
+
+// read forwards the messages of one connection. Lines that are not
+// protocol messages are skipped.
+func (c *chat) read(conn net.Conn) {
+	defer c.wg.Done()
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var msg ChatMessage
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			continue
+		}
+		if msg.Type != ChatAgent && msg.Type != ChatConfirmation {
+			continue
+		}
+		select {
+		case c.out <- msg:
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// send writes a message to the agent, or keeps it until the agent connects
+func (c *chat) send(msg ChatMessage) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return errors.New("agent has exited")
+	}
+	if c.conn == nil {
+		c.pending = append(c.pending, msg)
+		return nil
+	}
+	return c.writeLocked(msg)
+}
+
+// writeLocked writes a message to the agent's connection; the caller holds
+// c.mu
+func (c *chat) writeLocked(msg ChatMessage) error {
+	line, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	_, err = c.conn.Write(append(line, '\n'))
+	return err
+}
+
+// close stops taking connections once the agent has exited and removes the
+// socket. What the agent said before exiting is still read, for a moment,
+// before the connection is cut. The message channel is closed once nothing
+// writes to it any more.
+func (c *chat) close() {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return
+	}
+	c.closed = true
+	c.mu.Unlock()
+
+	c.listener.Close()
+	drained := make(chan struct{})
+	go func() {
+		c.wg.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+	case <-time.After(chatDrainTimeout):
+		// A process the agent started still holds the connection open
+		c.mu.Lock()
+		if c.conn != nil {
+			c.conn.Close()
+		}
+		c.mu.Unlock()
+		close(c.done)
+		<-drained
+	}
+
+	c.mu.Lock()
+	if c.conn != nil {
+		c.conn.Close()
+	}
+	c.mu.Unlock()
+	close(c.out)
+	os.RemoveAll(c.dir)
+}
@@ -0,0 +1,78 @@
+package agents
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Placeholders expanded in an agent's Args and Env
+const (
+	InstructionPlaceholder = "{{instruction}}"
+	RepoPlaceholder        = "{{repo}}"
+)
+
+// Config describes how to run one kind of coding agent CLI. Args and Env
+// values may use the {{instruction}} and {{repo}} placeholders; they are
+// passed to the executable as-is, never through a shell.
+type Config struct {
+	Command string            `json:"command"`
+	Args    []string          `json:"args"`
+	Env     map[string]string `json:"env"`
+	// PTY is set for agents that expect an interactive terminal. Other agents
+	// get TERM=dumb and an end-of-file on their input so they cannot block
+	// waiting for a prompt to be answered.
+	PTY bool `json:"pty"`
+	// Chat is set for agents that talk with the user while they work, over
+	// the conversation socket described at ChatMessage
+	Chat bool `json:"chat"`
+}
+
+// LoadConfig reads agent configs keyed by kind from a JSON file, e.g.
+//
+//	{"claude": {"command": "claude", "args": ["-p", "{{instruction}}"], "pty": true}}
+func LoadConfig(path string) (map[string]Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var configs map[string]Config
+	if err := json.Unmarshal(data, &configs); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	for kind, config := range configs {
+		if strings.TrimSpace(config.Command) == "" {
+			return nil, fmt.Errorf("agent %q has no command", kind)
+		}
+	}
+
+	return configs, nil
+}
+
+// expand fills in the placeholders of a config for one run
+func (c Config) expand(instruction, repo string) ([]string, []string) {
+	replacer := strings.NewReplacer(InstructionPlaceholder, instruction, RepoPlaceholder, repo)
+
+	args := make([]string, len(c.Args))
+	for i, arg := range c.Args {
+		args[i] = replacer.Replace(arg)
+	}
+
+	env := make([]string, 0, len(c.Env)+1)
+	if !c.PTY {
+		env = append(env, "TERM=dumb")
+	}
+	keys := make([]string, 0, len(c.Env))
+	for key := range c.Env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		env = append(env, key+"="+replacer.Replace(c.Env[key]))
+	}
+
+	return args, env
+}
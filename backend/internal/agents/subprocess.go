@@ -0,0 +1,261 @@
+package agents
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/PeterShin23/cockpit-coder/backend/internal/git"
+	"github.com/PeterShin23/cockpit-coder/backend/internal/pty"
+)
+
+// eof is the terminal's end-of-file character, Ctrl-D
+const eof = "\x04"
+
+// SubprocessAgent runs a coding agent CLI described by a Config under a PTY
+// in the task workspace. Task IDs it hands out are the IDs of those PTYs.
+type SubprocessAgent struct {
+	kind   string
+	config Config
+	ptys   pty.Manager
+	git    git.Provider
+
+	mu        sync.Mutex
+	runs      map[string]run
+	workspace string // workspace of the latest run
+}
+
+// run is an agent process and the workspace it works in, with its
+// conversation socket if it chats
+type run struct {
+	proc      pty.Proc
+	workspace string
+	chat      *chat
+}
+
+// NewSubprocessAgent creates an agent that runs config's command
+func NewSubprocessAgent(kind string, config Config, ptys pty.Manager, gitProvider git.Provider) *SubprocessAgent {
+	return &SubprocessAgent{
+		kind:   kind,
+		config: config,
+		ptys:   ptys,
+		git:    gitProvider,
+		runs:   make(map[string]run),
+	}
+}
+
+// StartTask starts the agent on instruction in repo. The agent's PTY belongs
+// to the task's session, so it is recorded and can be attached to like any
+// other, but it is not reaped when idle: the task's maximum runtime bounds
+// it instead. The agent is stopped when ctx is cancelled.
+func (a *SubprocessAgent) StartTask(ctx context.Context, sessionID, taskID, instruction, repo string) (string, error) {
+	args, env := a.config.expand(instruction, repo)
+
+	var conversation *chat
+	if a.config.Chat {
+		var err error
+		if conversation, err = newChat(); err != nil {
+			return "", fmt.Errorf("start %s agent chat: %w", a.kind, err)
+		}
+		env = append(env, ChatEnv+"="+conversation.path())
+	}
+
+	proc, err := a.ptys.Spawn(ctx, pty.Spec{
+		Owner:     sessionID,
+		TaskID:    taskID,
+		Name:      a.kind,
+		Cmd:       a.config.Command,
+		Args:      args,
+		Cwd:       repo,
+		Env:       env,
+		KeepAlive: true,
+	})
+	if err != nil {
+		if conversation != nil {
+			conversation.close()
+		}
+		return "", fmt.Errorf("start %s agent: %w", a.kind, err)
+	}
+	if !a.config.PTY {
+		proc.Write([]byte(eof))
+	}
+	if conversation != nil {
+		go func() {
+			<-proc.Done()
+			conversation.close()
+		}()
+	}
+
+	a.mu.Lock()
+	a.runs[proc.ID()] = run{proc: proc, workspace: repo, chat: conversation}
+	a.workspace = repo
+	a.mu.Unlock()
+
+	return proc.ID(), nil
+}
+
+// StreamPTY streams a run's terminal output, starting with what it printed
+// before the call, until the agent exits or ctx is cancelled
+func (a *SubprocessAgent) StreamPTY(ctx context.Context, taskID string) (<-chan []byte, error) {
+	r, err := a.lookup(taskID)
+	if err != nil {
+		return nil, err
+	}
+	return stream(ctx, r.proc), nil
+}
+
+// Wait blocks until a run's agent exits and returns its exit code
+func (a *SubprocessAgent) Wait(ctx context.Context, taskID string) (int, error) {
+	r, err := a.lookup(taskID)
+	if err != nil {
+		return 0, err
+	}
+
+	select {
+	case state := <-r.proc.Done():
+		return state.ExitCode, state.Err
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+}
+
+// Signal signals a run's agent and every process it started
+func (a *SubprocessAgent) Signal(taskID string, sig syscall.Signal) error {
+	r, err := a.lookup(taskID)
+	if err != nil {
+		return err
+	}
+	return r.proc.Signal(sig)
+}
+
+// Messages returns what a run's agent says over its conversation socket,
+// until it exits
+func (a *SubprocessAgent) Messages(taskID string) (<-chan ChatMessage, error) {
+	r, err := a.lookup(taskID)
+	if err != nil {
+		return nil, err
+	}
+	if r.chat == nil {
+		return nil, ErrNoChat
+	}
+	return r.chat.out, nil
+}
+
+// Say sends a message to a run's agent over its conversation socket. The
+// message waits for the agent if it has not connected yet.
+func (a *SubprocessAgent) Say(taskID string, msg ChatMessage) error {
+	r, err := a.lookup(taskID)
+	if err != nil {
+		return err
+	}
+	if r.chat == nil {
+		return ErrNoChat
+	}
+	return r.chat.send(msg)
+}
+
+// GetPatches diffs a run's workspace against its checked-out commit
+func (a *SubprocessAgent) GetPatches(ctx context.Context, taskID string) ([]git.FilePatch, error) {
+	r, err := a.lookup(taskID)
+	if err != nil {
+		return nil, err
+	}
+
+	return a.git.Unified(ctx, r.workspace, git.DiffOptions{})
+}
+
+// ApplyPatches commits the selected hunks onto the branch checked out in a
+// run's workspace
+func (a *SubprocessAgent) ApplyPatches(ctx context.Context, taskID string, sel []git.PatchSelection) error {
+	r, err := a.lookup(taskID)
+	if err != nil {
+		return err
+	}
+
+	_, err = a.git.ApplySelection(ctx, r.workspace, sel, fmt.Sprintf("Apply %s agent changes", a.kind), "")
+	return err
+}
+
+// RunCommand runs cmd in the workspace of the latest run and streams its
+// output. The command is split on spaces and not run through a shell.
+func (a *SubprocessAgent) RunCommand(ctx context.Context, cmd string) (<-chan []byte, error) {
+	parts := strings.Fields(cmd)
+	if len(parts) == 0 {
+		return nil, errors.New("empty command")
+	}
+
+	a.mu.Lock()
+	workspace := a.workspace
+	a.mu.Unlock()
+	if workspace == "" {
+		return nil, errors.New("agent has not started a task")
+	}
+
+	proc, err := a.ptys.Spawn(ctx, pty.Spec{
+		Name: cmd,
+		Cmd:  parts[0],
+		Args: parts[1:],
+		Cwd:  workspace,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return stream(ctx, proc), nil
+}
+
+// lookup finds a run by the ID StartTask returned
+func (a *SubprocessAgent) lookup(taskID string) (run, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	r, ok := a.runs[taskID]
+	if !ok {
+		return run{}, pty.ErrNotFound
+	}
+	return r, nil
+}
+
+// stream forwards a process's output, replayed scrollback first, until it
+// exits or ctx is cancelled. The stream is a passive viewer: it hands the
+// input lease on if attaching gave it the lease.
+func stream(ctx context.Context, proc pty.Proc) <-chan []byte {
+	attachment := proc.Attach("")
+	attachment.ReleaseInput()
+
+	ch := make(chan []byte, 100)
+	go func() {
+		defer close(ch)
+		defer attachment.Detach()
+
+		if len(attachment.Replay) > 0 {
+			select {
+			case ch <- attachment.Replay:
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		for {
+			select {
+			case chunk, ok := <-attachment.Output:
+				if !ok {
+					return
+				}
+				select {
+				case ch <- chunk:
+				case <-ctx.Done():
+					return
+				}
+			case <-attachment.Detached:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return ch
+}
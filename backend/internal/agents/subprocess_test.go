@@ -0,0 +1,167 @@
+package agents
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PeterShin23/cockpit-coder/backend/internal/git"
+	"github.com/PeterShin23/cockpit-coder/backend/internal/pty"
+)
+
+// fakeAgent is a shell script standing in for a coding agent CLI. It echoes
+// what it was given, edits README.md and reports whether its input was
+// closed.
+const fakeAgent = `#!/bin/sh
+echo "instruction: $1"
+echo "repo: $2 $FAKE_REPO"
+echo "term: $TERM"
+echo "changed" >> README.md
+if read line; then echo "got input: $line"; else echo "no input"; fi
+`
+
+func TestSubprocessAgent(t *testing.T) {
+	repo := t.TempDir()
+	for _, args := range [][]string{
+		{"init", "-q", "-b", "main"},
+		{"-c", "user.name=Test", "-c", "user.email=test@example.com", "commit", "-q", "--allow-empty", "-m", "Initial commit"},
+	} {
+		if out, err := exec.Command("git", append([]string{"-C", repo}, args...)...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(repo, "README.md"), []byte("hello\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := exec.Command("git", "-C", repo, "add", "README.md").CombinedOutput(); err != nil {
+		t.Fatalf("git add: %v\n%s", err, out)
+	}
+
+	script := filepath.Join(t.TempDir(), "fake-agent")
+	if err := os.WriteFile(script, []byte(fakeAgent), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	configs := map[string]Config{
+		"fake": {
+			Command: script,
+			Args:    []string{"{{instruction}}", "{{repo}}"},
+			Env:     map[string]string{"FAKE_REPO": "in {{repo}}"},
+		},
+	}
+	factory := NewFactory(configs, pty.NewManager(0, nil), git.NewProvider())
+
+	if _, err := factory.For("claude"); !errors.Is(err, ErrUnknownAgent) {
+		t.Errorf("Expected ErrUnknownAgent for an unconfigured kind, got %v", err)
+	}
+
+	agent, err := factory.For("fake")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	id, err := agent.StartTask(ctx, "session-1", "task-1", "add a line; rm -rf /", repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	output, err := agent.StreamPTY(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	transcript := collect(output)
+
+	for _, want := range []string{
+		"instruction: add a line; rm -rf /",
+		"repo: " + repo + " in " + repo,
+		"term: dumb",
+		"no input",
+	} {
+		if !strings.Contains(transcript, want) {
+			t.Errorf("Expected output to contain %q, got %q", want, transcript)
+		}
+	}
+
+	patches, err := agent.GetPatches(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(patches) != 1 || patches[0].File != "README.md" || !strings.Contains(patches[0].Content, "+changed") {
+		t.Errorf("Expected the README.md change, got %+v", patches)
+	}
+
+	output, err = agent.RunCommand(ctx, "git status --porcelain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status := collect(output); !strings.Contains(status, "AM README.md") {
+		t.Errorf("Expected the command to run in the workspace, got %q", status)
+	}
+
+	if _, err := agent.GetPatches(ctx, "missing"); !errors.Is(err, pty.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for an unknown run, got %v", err)
+	}
+}
+
+func TestAgentOutlivesIdleTimeout(t *testing.T) {
+	ptys := pty.NewManager(100*time.Millisecond, nil)
+	configs := map[string]Config{"quiet": {Command: "/bin/sh", Args: []string{"-c", "sleep 0.6"}}}
+	agent, err := NewFactory(configs, ptys, git.NewProvider()).For("quiet")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	id, err := agent.StartTask(ctx, "session-1", "task-1", "think", t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	proc, ok := ptys.Get(id)
+	if !ok {
+		t.Fatal("Expected the agent's PTY to be managed")
+	}
+	if info := proc.Info(); info.Owner != "session-1" || info.TaskID != "task-1" {
+		t.Errorf("Expected the PTY to belong to the task's session, got %+v", info)
+	}
+
+	// Nobody attaches, yet the agent runs well past the idle timeout
+	if code, err := agent.Wait(ctx, id); err != nil || code != 0 {
+		t.Errorf("Expected the agent to finish on its own, got code %d and %v", code, err)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agents.json")
+	os.WriteFile(path, []byte(`{"claude": {"command": "claude", "args": ["-p", "{{instruction}}"], "pty": true}}`), 0o644)
+
+	configs, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config := configs["claude"]; config.Command != "claude" || len(config.Args) != 2 || !config.PTY {
+		t.Errorf("Unexpected config %+v", config)
+	}
+
+	os.WriteFile(path, []byte(`{"cline": {"args": ["{{instruction}}"]}}`), 0o644)
+	if _, err := LoadConfig(path); err == nil {
+		t.Error("Expected an error for an agent without a command")
+	}
+}
+
+// collect reads a stream until it is closed
+func collect(ch <-chan []byte) string {
+	var b strings.Builder
+	for chunk := range ch {
+		b.Write(chunk)
+	}
+	return b.String()
+}
@@ -1,6 +1,7 @@
 package auth
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
@@ -12,6 +13,19 @@ import (
 
 var jwtSecret = []byte("change_me")
 
+type contextKey struct{}
+
+// WithSessionID returns a copy of ctx carrying an authenticated session ID
+func WithSessionID(ctx context.Context, sessionID string) context.Context {
+	return context.WithValue(ctx, contextKey{}, sessionID)
+}
+
+// SessionIDFromContext returns the session ID stored by WithSessionID
+func SessionIDFromContext(ctx context.Context) (string, bool) {
+	sessionID, ok := ctx.Value(contextKey{}).(string)
+	return sessionID, ok && sessionID != ""
+}
+
 // SetJWTSecret allows setting the JWT secret from environment
 func SetJWTSecret(secret string) {
 	jwtSecret = []byte(secret)
@@ -81,10 +95,31 @@ func ValidateToken(tokenString string) (string, error) {
 	return "", errors.New("invalid token")
 }
 
-// GetSessionIDFromRequest extracts and validates the JWT token from the request
+// GetSessionIDFromRequest returns the session ID already authenticated for
+// the request, or else extracts and validates the JWT token from it
 func GetSessionIDFromRequest(r *http.Request) (string, error) {
+	if sessionID, ok := SessionIDFromContext(r.Context()); ok {
+		return sessionID, nil
+	}
+
+	token, err := TokenFromRequest(r)
+	if err != nil {
+		return "", err
+	}
+
+	return ValidateToken(token)
+}
+
+// TokenFromRequest returns the bearer token from the Authorization header.
+// Browser WebSocket clients cannot set headers, so WebSocket handshakes may
+// pass the token as a query param instead.
+func TokenFromRequest(r *http.Request) (string, error) {
 	authHeader := r.Header.Get("Authorization")
 	if authHeader == "" {
+		isWebSocket := strings.EqualFold(r.Header.Get("Upgrade"), "websocket")
+		if token := r.URL.Query().Get("token"); token != "" && isWebSocket {
+			return token, nil
+		}
 		return "", errors.New("authorization header required")
 	}
 
@@ -94,7 +129,7 @@ func GetSessionIDFromRequest(r *http.Request) (string, error) {
 		return "", errors.New("invalid authorization header format")
 	}
 
-	return ValidateToken(parts[1])
+	return parts[1], nil
 }
 
 // IsTokenExpired checks if a token is expired
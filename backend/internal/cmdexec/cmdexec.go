@@ -2,15 +2,25 @@ package cmdexec
 
 import (
 	"context"
+	"errors"
 	"strings"
 	"time"
 
 	"github.com/PeterShin23/cockpit-coder/backend/internal/pty"
 )
 
+// Request describes a command to run
+type Request struct {
+	SessionID string
+	TaskID    string
+	Cmd       string
+	Cwd       string
+	Timeout   time.Duration
+}
+
 // Runner interface for command execution
 type Runner interface {
-	Run(ctx context.Context, cmd string, cwd string, timeout time.Duration) (pty.Proc, error)
+	Run(ctx context.Context, req Request) (pty.Proc, error)
 	Allowed(cmd string) bool
 }
 
@@ -33,16 +43,17 @@ func NewRunner(policy PolicyWrapper, ptyManager pty.Manager) *CmdRunner {
 	}
 }
 
-// Run executes a command under PTY
-func (r *CmdRunner) Run(ctx context.Context, cmd string, cwd string, timeout time.Duration) (pty.Proc, error) {
-	// Create a context with timeout
-	ctx, cancel := context.WithTimeout(ctx, timeout)
-	defer cancel()
-
+// Run executes a command under PTY. The process is killed once the timeout
+// elapses or ctx is cancelled, whichever comes first.
+func (r *CmdRunner) Run(ctx context.Context, req Request) (pty.Proc, error) {
 	// Split command into executable and arguments
-	parts := strings.Fields(cmd)
+	parts := strings.Fields(req.Cmd)
 	if len(parts) == 0 {
-		return nil, nil
+		return nil, errors.New("empty command")
+	}
+
+	if !r.Allowed(req.Cmd) {
+		return nil, errors.New("command not allowed")
 	}
 
 	executable := parts[0]
@@ -51,12 +62,29 @@ func (r *CmdRunner) Run(ctx context.Context, cmd string, cwd string, timeout tim
 		args = parts[1:]
 	}
 
+	// The timeout has to outlive this call: it is released once the process
+	// has exited rather than when Run returns
+	ctx, cancel := context.WithTimeout(ctx, req.Timeout)
+
 	// Start the command under PTY
-	proc, err := r.pty.Start(ctx, executable, args, cwd, nil)
+	proc, err := r.pty.Spawn(ctx, pty.Spec{
+		Owner:  req.SessionID,
+		TaskID: req.TaskID,
+		Name:   req.Cmd,
+		Cmd:    executable,
+		Args:   args,
+		Cwd:    req.Cwd,
+	})
 	if err != nil {
+		cancel()
 		return nil, err
 	}
 
+	go func() {
+		<-proc.Done()
+		cancel()
+	}()
+
 	return proc, nil
 }
 
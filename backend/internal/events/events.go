@@ -1,73 +1,166 @@
 package events
 
 import (
+	"encoding/json"
+	"sort"
 	"sync"
+	"time"
 )
 
-// Event represents a system event
+// historySize is how many events are kept per session for replay
+const historySize = 1000
+
+// Event represents a system event. Seq and Time are assigned by the bus when
+// the event is published. Transient events, such as command output that is
+// kept elsewhere, are only sent to current subscribers and never replayed.
 type Event struct {
-	Type   string         `json:"type"`
-	Fields map[string]any `json:"fields,omitempty"`
+	Type      string         `json:"type"`
+	Fields    map[string]any `json:"fields,omitempty"`
+	Seq       uint64         `json:"seq,omitempty"`
+	Time      time.Time      `json:"time,omitempty"`
+	Transient bool           `json:"-"`
+}
+
+// MarshalJSON flattens Fields next to the type, which is the shape clients consume
+func (e Event) MarshalJSON() ([]byte, error) {
+	flat := make(map[string]any, len(e.Fields)+3)
+	for k, v := range e.Fields {
+		flat[k] = v
+	}
+	flat["type"] = e.Type
+	if e.Seq > 0 {
+		flat["seq"] = e.Seq
+	}
+	if !e.Time.IsZero() {
+		flat["time"] = e.Time
+	}
+	return json.Marshal(flat)
 }
 
 // Bus interface for event publishing and subscription
 type Bus interface {
 	Subscribe(sessionID string) (<-chan Event, func())
 	Publish(sessionID string, e Event)
+	// History returns the retained events with a seq greater than since,
+	// oldest first. complete is false when events after since have already
+	// been dropped from the history.
+	History(sessionID string, since uint64) (events []Event, complete bool)
+	// Drop forgets a session's subscribers and history once the session is
+	// gone
+	Drop(sessionID string)
+}
+
+// topic holds a session's subscribers along with its sequence counter and
+// recent history. trimmed is the seq of the newest event dropped from the
+// history.
+type topic struct {
+	subscribers map[chan Event]bool
+	seq         uint64
+	history     []Event
+	trimmed     uint64
 }
 
 // MemoryBus implements an in-memory event bus
 type MemoryBus struct {
-	topics map[string]map[chan Event]bool
+	topics map[string]*topic
 	mu     sync.RWMutex
 }
 
 // NewMemoryBus creates a new in-memory event bus
 func NewMemoryBus() *MemoryBus {
 	return &MemoryBus{
-		topics: make(map[string]map[chan Event]bool),
+		topics: make(map[string]*topic),
 	}
 }
 
+// topicLocked returns the session's topic, creating it if needed; the caller
+// holds b.mu for writing
+func (b *MemoryBus) topicLocked(sessionID string) *topic {
+	t, ok := b.topics[sessionID]
+	if !ok {
+		t = &topic{subscribers: make(map[chan Event]bool)}
+		b.topics[sessionID] = t
+	}
+	return t
+}
+
 // Subscribe creates a new subscription for a session
 func (b *MemoryBus) Subscribe(sessionID string) (<-chan Event, func()) {
 	ch := make(chan Event, 100) // Buffered channel to prevent blocking
 
 	b.mu.Lock()
-	if b.topics[sessionID] == nil {
-		b.topics[sessionID] = make(map[chan Event]bool)
-	}
-	b.topics[sessionID][ch] = true
+	b.topicLocked(sessionID).subscribers[ch] = true
 	b.mu.Unlock()
 
 	// Return unsubscribe function
+	var once sync.Once
 	unsubscribe := func() {
-		b.mu.Lock()
-		if subscribers, ok := b.topics[sessionID]; ok {
-			delete(subscribers, ch)
-			if len(subscribers) == 0 {
-				delete(b.topics, sessionID)
+		once.Do(func() {
+			b.mu.Lock()
+			if t, ok := b.topics[sessionID]; ok {
+				delete(t.subscribers, ch)
 			}
-		}
-		b.mu.Unlock()
-		close(ch)
+			b.mu.Unlock()
+			close(ch)
+		})
 	}
 
 	return ch, unsubscribe
 }
 
-// Publish sends an event to all subscribers of a session
+// Publish numbers an event, records it in the session's history and sends it
+// to all subscribers of the session. A subscriber that is not keeping up
+// misses live events, and can spot the gap in seq and catch up from History.
 func (b *MemoryBus) Publish(sessionID string, e Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	t := b.topicLocked(sessionID)
+	t.seq++
+	e.Seq = t.seq
+	e.Time = time.Now()
+
+	if !e.Transient {
+		t.history = append(t.history, e)
+		if len(t.history) > historySize {
+			drop := len(t.history) - historySize
+			t.trimmed = t.history[drop-1].Seq
+			t.history = append(t.history[:0:0], t.history[drop:]...)
+		}
+	}
+
+	for ch := range t.subscribers {
+		select {
+		case ch <- e:
+		default:
+			// Channel is full, drop the event
+		}
+	}
+}
+
+// History returns the session's retained events published after since.
+// Transient events leave gaps in seq that are not reported as missing.
+func (b *MemoryBus) History(sessionID string, since uint64) ([]Event, bool) {
 	b.mu.RLock()
 	defer b.mu.RUnlock()
 
-	if subscribers, ok := b.topics[sessionID]; ok {
-		for ch := range subscribers {
-			select {
-			case ch <- e:
-			default:
-				// Channel is full, drop the event
-			}
-		}
+	t, ok := b.topics[sessionID]
+	if !ok || since >= t.seq {
+		return nil, true
+	}
+
+	start := sort.Search(len(t.history), func(i int) bool { return t.history[i].Seq > since })
+	if start == len(t.history) {
+		return nil, since >= t.trimmed
 	}
+	return append([]Event(nil), t.history[start:]...), since >= t.trimmed
+}
+
+// Drop removes a session's topic. Subscribers still holding a channel keep
+// it until they unsubscribe, but receive nothing more.
+func (b *MemoryBus) Drop(sessionID string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.topics, sessionID)
 }
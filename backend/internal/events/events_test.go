@@ -0,0 +1,104 @@
+package events
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestPublishNumbersEventsPerSession(t *testing.T) {
+	bus := NewMemoryBus()
+	ch, unsubscribe := bus.Subscribe("a")
+	defer unsubscribe()
+
+	bus.Publish("a", Event{Type: "one"})
+	bus.Publish("b", Event{Type: "other"})
+	bus.Publish("a", Event{Type: "two"})
+
+	for want := uint64(1); want <= 2; want++ {
+		if e := <-ch; e.Seq != want {
+			t.Errorf("Expected seq %d, got %d (%s)", want, e.Seq, e.Type)
+		}
+	}
+
+	if other, _ := bus.History("b", 0); len(other) != 1 || other[0].Seq != 1 {
+		t.Errorf("Expected session b to be numbered separately, got %+v", other)
+	}
+}
+
+func TestHistoryReplaysSince(t *testing.T) {
+	bus := NewMemoryBus()
+	for i := 0; i < historySize+10; i++ {
+		bus.Publish("a", Event{Type: "tick"})
+	}
+
+	missed, complete := bus.History("a", historySize+5)
+	if !complete || len(missed) != 5 || missed[0].Seq != historySize+6 {
+		t.Errorf("Expected last 5 events, got %d (complete=%v)", len(missed), complete)
+	}
+
+	if missed, _ := bus.History("a", historySize+10); len(missed) != 0 {
+		t.Errorf("Expected nothing after the latest seq, got %d", len(missed))
+	}
+
+	missed, complete = bus.History("a", 3)
+	if complete {
+		t.Error("Expected replay from a trimmed seq to be incomplete")
+	}
+	if len(missed) != historySize || missed[0].Seq != 11 {
+		t.Errorf("Expected the retained history, got %d from seq %d", len(missed), missed[0].Seq)
+	}
+}
+
+func TestMarshalFlattensFields(t *testing.T) {
+	data, err := json.Marshal(Event{Type: "cmd_exit", Seq: 7, Fields: map[string]any{"code": 0}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got map[string]any
+	json.Unmarshal(data, &got)
+	if got["type"] != "cmd_exit" || got["seq"] != float64(7) || got["code"] != float64(0) {
+		t.Errorf("Unexpected JSON %s", data)
+	}
+}
+
+func TestTransientEventsAreNotReplayed(t *testing.T) {
+	bus := NewMemoryBus()
+	ch, unsubscribe := bus.Subscribe("a")
+	defer unsubscribe()
+
+	bus.Publish("a", Event{Type: "task_status"})
+	for i := 0; i < historySize+10; i++ {
+		bus.Publish("a", Event{Type: "cmd_output", Transient: true})
+	}
+	bus.Publish("a", Event{Type: "cmd_exit"})
+
+	if e := <-ch; e.Type != "task_status" {
+		t.Fatalf("Expected live delivery, got %s", e.Type)
+	}
+	if e := <-ch; e.Type != "cmd_output" || e.Seq != 2 {
+		t.Errorf("Expected transient events to be sent live, got %s seq %d", e.Type, e.Seq)
+	}
+
+	missed, complete := bus.History("a", 0)
+	if !complete || len(missed) != 2 || missed[0].Type != "task_status" || missed[1].Type != "cmd_exit" {
+		t.Errorf("Expected only the retained events, got %+v (complete=%v)", missed, complete)
+	}
+	if missed, complete := bus.History("a", 5); !complete || len(missed) != 1 || missed[0].Seq != historySize+12 {
+		t.Errorf("Expected replay from within the output to resume at cmd_exit, got %+v (complete=%v)", missed, complete)
+	}
+}
+
+func TestDropForgetsSession(t *testing.T) {
+	bus := NewMemoryBus()
+	bus.Publish("a", Event{Type: "one"})
+	bus.Publish("b", Event{Type: "other"})
+
+	bus.Drop("a")
+	if _, ok := bus.topics["a"]; ok {
+		t.Error("Expected the topic to be dropped")
+	}
+	if missed, _ := bus.History("b", 0); len(missed) != 1 {
+		t.Errorf("Expected other sessions to be kept, got %d events", len(missed))
+	}
+}
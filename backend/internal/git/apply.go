@@ -0,0 +1,393 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ErrApplyFailed is returned when a selection does not apply to the branch;
+// the per-file results say which files failed
+var ErrApplyFailed = errors.New("selection does not apply")
+
+// ErrBranchMoved is returned when the branch changed while a commit was
+// being prepared
+var ErrBranchMoved = errors.New("branch moved during apply")
+
+// File results of an apply
+const (
+	FileApplied = "applied"
+	FileFailed  = "failed"
+	// FileConflicted marks a file where some hunks were merged and the
+	// others conflicted with changes made since the patch
+	FileConflicted = "conflicted"
+)
+
+// FileResult reports how a file's selected hunks applied. Hunks lists the
+// ones that went in; Drifted says the file had changed since the patch was
+// made and was merged.
+type FileResult struct {
+	File      string         `json:"file"`
+	Hunks     []int          `json:"hunks"`
+	Status    string         `json:"status"`
+	Error     string         `json:"error,omitempty"`
+	Drifted   bool           `json:"drifted,omitempty"`
+	Conflicts []HunkConflict `json:"conflicts,omitempty"`
+}
+
+// ApplyResult describes the commit made from a selection
+type ApplyResult struct {
+	Commit string       `json:"commit"`
+	Branch string       `json:"branch"`
+	Parent string       `json:"parent"`
+	Files  []FileResult `json:"files"`
+}
+
+// Covers reports whether the apply took every hunk of patches, given as
+// contents by file, so none of their changes are left out
+func (r ApplyResult) Covers(patches map[string]string) bool {
+	files := make(map[string]FileResult, len(r.Files))
+	for _, file := range r.Files {
+		files[file.File] = file
+	}
+
+	for path, content := range patches {
+		file, ok := files[path]
+		if !ok || file.Status != FileApplied {
+			return false
+		}
+		_, hunks, err := splitPatch(path, content)
+		if err != nil || len(file.Hunks) < len(hunks) {
+			return false
+		}
+	}
+	return true
+}
+
+// ApplySelection commits the selected hunks onto branch without touching the
+// work tree or index. The patch is applied to a temporary index built from
+// the branch tip, written as a tree and committed, and the branch is then
+// moved only if it still points at the same commit. A selection with a Blob
+// whose file has changed on the branch since is merged hunk by hunk instead,
+// and hunks that conflict are reported and left out. If any file fails to
+// apply, or nothing is left to commit, no commit is made. When the branch
+// is checked out, the index entries of the committed files are refreshed,
+// and so are their work tree copies unless they have local changes.
+func (g *GitProvider) ApplySelection(ctx context.Context, repo string, sel []PatchSelection, commitMsg, branch string) (ApplyResult, error) {
+	if len(sel) == 0 {
+		return ApplyResult{}, errors.New("nothing selected")
+	}
+	if strings.TrimSpace(commitMsg) == "" {
+		return ApplyResult{}, errors.New("commit message required")
+	}
+
+	// Patch paths are relative to the top of the work tree
+	repo, err := WorkTreeRoot(ctx, repo)
+	if err != nil {
+		return ApplyResult{}, err
+	}
+
+	if branch == "" {
+		current, err := runGit(ctx, repo, "symbolic-ref", "--quiet", "--short", "HEAD")
+		if err != nil {
+			return ApplyResult{}, errors.New("HEAD is detached; a branch is required")
+		}
+		branch = strings.TrimSpace(current)
+	}
+	if _, err := runGit(ctx, repo, "check-ref-format", "--branch", branch); err != nil || strings.HasPrefix(branch, "-") {
+		return ApplyResult{}, fmt.Errorf("invalid branch %q", branch)
+	}
+	ref := "refs/heads/" + branch
+
+	// A branch that does not exist yet starts from HEAD, and update-ref is
+	// told it must still not exist when the commit is ready
+	expected := strings.Repeat("0", 40)
+	parent, err := runGit(ctx, repo, "rev-parse", "--verify", "--quiet", ref+"^{commit}")
+	if err == nil {
+		expected = strings.TrimSpace(parent)
+	} else {
+		parent, err = runGit(ctx, repo, "rev-parse", "--verify", "--quiet", "HEAD^{commit}")
+		if err != nil {
+			return ApplyResult{}, errors.New("repository has no commits to apply onto")
+		}
+	}
+	parent = strings.TrimSpace(parent)
+
+	result := ApplyResult{Branch: branch, Parent: parent, Files: make([]FileResult, len(sel))}
+	patches := make([]string, len(sel))
+	merged := make(map[string]mergedFile)
+	var paths []string
+	failed := false
+	for i, s := range sel {
+		paths = append(paths, s.File)
+		// A rename also removes the old path
+		if parsed := parseGitDiff(s.Content); len(parsed) == 1 && parsed[0].OldPath != "" && parsed[0].OldPath != s.File {
+			paths = append(paths, parsed[0].OldPath)
+		}
+
+		if s.Blob != "" {
+			if current, mode := blobAt(ctx, repo, parent, s.File); current != "" && current != s.Blob {
+				content, file, err := mergeDrifted(ctx, repo, s, current)
+				if err != nil {
+					file.Status, file.Error = FileFailed, err.Error()
+					failed = true
+				} else if len(file.Hunks) > 0 {
+					merged[s.File] = mergedFile{content: content, mode: mode}
+				}
+				result.Files[i] = file
+				continue
+			}
+		}
+
+		patch, hunks, err := SelectHunks(s)
+		if err != nil {
+			result.Files[i] = FileResult{File: s.File, Hunks: s.Hunks, Status: FileFailed, Error: err.Error()}
+			failed = true
+			continue
+		}
+		result.Files[i] = FileResult{File: s.File, Hunks: hunks, Status: FileApplied}
+		patches[i] = patch
+	}
+	if failed {
+		return result, ErrApplyFailed
+	}
+	if len(merged) == 0 && strings.Join(patches, "") == "" {
+		return result, fmt.Errorf("%w: every selected hunk conflicts", ErrApplyFailed)
+	}
+
+	tmp, err := os.MkdirTemp("", "cockpit-apply-")
+	if err != nil {
+		return ApplyResult{}, err
+	}
+	defer os.RemoveAll(tmp)
+	env := []string{"GIT_INDEX_FILE=" + filepath.Join(tmp, "index")}
+
+	if _, err := runGitWith(ctx, repo, env, "", "read-tree", parent); err != nil {
+		return ApplyResult{}, err
+	}
+
+	// Check each file on its own so the results can say which ones fail
+	for i, patch := range patches {
+		if patch == "" {
+			continue
+		}
+		if _, err := runGitWith(ctx, repo, env, patch, "apply", "--cached", "--check", "-"); err != nil {
+			result.Files[i].Status = FileFailed
+			result.Files[i].Error = strings.TrimPrefix(err.Error(), "git apply: ")
+			failed = true
+		}
+	}
+	if failed {
+		return result, ErrApplyFailed
+	}
+
+	if combined := strings.Join(patches, ""); combined != "" {
+		if _, err := runGitWith(ctx, repo, env, combined, "apply", "--cached", "-"); err != nil {
+			return result, fmt.Errorf("%w: %v", ErrApplyFailed, err)
+		}
+	}
+	for path, file := range merged {
+		blob, err := runGitWith(ctx, repo, nil, file.content, "hash-object", "-w", "--stdin")
+		if err != nil {
+			return result, err
+		}
+		info := file.mode + "," + strings.TrimSpace(blob) + "," + path
+		if _, err := runGitWith(ctx, repo, env, "", "update-index", "--cacheinfo", info); err != nil {
+			return result, err
+		}
+	}
+	tree, err := runGitWith(ctx, repo, env, "", "write-tree")
+	if err != nil {
+		return result, err
+	}
+	commit, err := runGitWith(ctx, repo, nil, commitMsg, "commit-tree", strings.TrimSpace(tree), "-p", parent)
+	if err != nil {
+		return result, err
+	}
+	commit = strings.TrimSpace(commit)
+
+	// Note which checked-out copies can be refreshed before moving the branch
+	worktree := checkedOutAt(ctx, repo, ref)
+	var dirty map[string]bool
+	if worktree != "" {
+		dirty = dirtyPaths(ctx, worktree, paths)
+	}
+
+	if _, err := runGit(ctx, repo, "update-ref", "-m", "cockpit: apply selection", ref, commit, expected); err != nil {
+		return result, ErrBranchMoved
+	}
+	result.Commit = commit
+
+	if worktree != "" {
+		syncWorktree(ctx, worktree, commit, paths, dirty)
+	}
+
+	return result, nil
+}
+
+// mergedFile is the content a drifted file gets in the commit
+type mergedFile struct {
+	content string
+	mode    string
+}
+
+// SelectHunks builds the patch text for the chosen hunks of a file and
+// returns it with the hunk indexes used. The new-side start of each kept
+// hunk is shifted by the line count changes of the hunks left out before it,
+// so the patch applies as if only the selected hunks had ever been made.
+func SelectHunks(sel PatchSelection) (string, []int, error) {
+	header, hunks, err := splitPatch(sel.File, sel.Content)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(hunks) == 0 {
+		// Pure renames, copies and mode changes are all header
+		if len(sel.Hunks) == 0 && strings.HasPrefix(header, "diff --git ") {
+			return header, []int{}, nil
+		}
+		return "", nil, errors.New("patch has no hunks")
+	}
+
+	indexes, err := chooseHunks(len(hunks), sel.Hunks)
+	if err != nil {
+		return "", nil, err
+	}
+	selected := make(map[int]bool, len(indexes))
+	for _, i := range indexes {
+		selected[i] = true
+	}
+
+	var b strings.Builder
+	b.WriteString(header)
+	skipped := 0
+	for i, hunk := range hunks {
+		if !selected[i] {
+			skipped += hunk.LenNew - hunk.LenOld
+			continue
+		}
+		hunk.StartNew -= skipped
+		b.WriteString(hunk.String())
+	}
+
+	return b.String(), indexes, nil
+}
+
+// chooseHunks validates hunk indexes against a patch with count hunks and
+// returns them sorted without duplicates. No indexes means every hunk.
+func chooseHunks(count int, chosen []int) ([]int, error) {
+	if len(chosen) == 0 {
+		for i := 0; i < count; i++ {
+			chosen = append(chosen, i)
+		}
+	}
+
+	selected := make(map[int]bool)
+	for _, i := range chosen {
+		if i < 0 || i >= count {
+			return nil, fmt.Errorf("hunk %d out of range", i)
+		}
+		selected[i] = true
+	}
+	indexes := make([]int, 0, len(selected))
+	for i := range selected {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+	return indexes, nil
+}
+
+// splitPatch separates a file patch into its header and parsed hunks. A
+// patch without a git or ---/+++ header, as agents sometimes produce, gets a
+// header for file.
+func splitPatch(file, content string) (string, []Hunk, error) {
+	header := content
+	if i := strings.Index(content, "\n@@ "); i >= 0 {
+		header = content[:i+1]
+	} else if strings.HasPrefix(content, "@@ ") {
+		header = ""
+	}
+
+	if !strings.HasPrefix(header, "diff --git ") && !strings.Contains(header, "\n+++ ") && !strings.HasPrefix(header, "+++ ") {
+		if file == "" {
+			return "", nil, errors.New("patch has no file header")
+		}
+		header = fmt.Sprintf("--- a/%s\n+++ b/%s\n", file, file)
+	}
+
+	hunks, err := ParseHunks(content)
+	if err != nil {
+		return "", nil, err
+	}
+	return header, hunks, nil
+}
+
+// checkedOutAt returns the work tree that has ref checked out, if any
+func checkedOutAt(ctx context.Context, repo, ref string) string {
+	out, err := runGit(ctx, repo, "worktree", "list", "--porcelain")
+	if err != nil {
+		return ""
+	}
+
+	var path string
+	for _, line := range strings.Split(out, "\n") {
+		if strings.HasPrefix(line, "worktree ") {
+			path = strings.TrimPrefix(line, "worktree ")
+		} else if line == "branch "+ref {
+			return path
+		}
+	}
+	return ""
+}
+
+// dirtyPaths returns which of paths have staged or unstaged changes
+func dirtyPaths(ctx context.Context, worktree string, paths []string) map[string]bool {
+	dirty := make(map[string]bool)
+	args := append([]string{"status", "--porcelain", "-z", "--untracked-files=all", "--"}, paths...)
+	out, err := runGit(ctx, worktree, args...)
+	if err != nil {
+		// Without status, treat everything as locally changed and leave it be
+		for _, path := range paths {
+			dirty[path] = true
+		}
+		return dirty
+	}
+
+	entries := strings.Split(out, "\x00")
+	for i := 0; i < len(entries); i++ {
+		entry := entries[i]
+		if len(entry) < 4 {
+			continue
+		}
+		dirty[entry[3:]] = true
+		// Renames and copies are followed by their source path
+		if entry[0] == 'R' || entry[0] == 'C' {
+			i++
+		}
+	}
+	return dirty
+}
+
+// syncWorktree brings the index of a checked-out branch up to date with the
+// new commit for paths, and refreshes the work tree copies that had no local
+// changes
+func syncWorktree(ctx context.Context, worktree, commit string, paths []string, dirty map[string]bool) {
+	args := append([]string{"reset", "-q", commit, "--"}, paths...)
+	if _, err := runGit(ctx, worktree, args...); err != nil {
+		return
+	}
+
+	for _, path := range paths {
+		if dirty[path] {
+			continue
+		}
+		if _, err := runGit(ctx, worktree, "cat-file", "-e", commit+":"+path); err != nil {
+			os.Remove(filepath.Join(worktree, path))
+			continue
+		}
+		runGit(ctx, worktree, "checkout", "--", path)
+	}
+}
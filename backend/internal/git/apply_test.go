@@ -0,0 +1,200 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func numberedLines(n int) []string {
+	lines := make([]string, n)
+	for i := range lines {
+		lines[i] = fmt.Sprintf("line %d", i+1)
+	}
+	return lines
+}
+
+func writeLines(t *testing.T, path string, lines []string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// threeHunkPatch commits a 30 line file and returns a patch that inserts
+// near the top, edits the middle and deletes near the bottom
+func threeHunkPatch(t *testing.T, dir string) string {
+	t.Helper()
+	path := filepath.Join(dir, "file.txt")
+	lines := numberedLines(30)
+	writeLines(t, path, lines)
+	gitCmd(t, dir, "add", ".")
+	gitCmd(t, dir, "commit", "-qm", "Add file")
+
+	changed := append([]string{}, lines[:3]...)
+	changed = append(changed, "inserted a", "inserted b")
+	changed = append(changed, lines[3:14]...)
+	changed = append(changed, "edited 15")
+	changed = append(changed, lines[15:26]...)
+	changed = append(changed, lines[27:]...)
+	writeLines(t, path, changed)
+
+	patches, err := NewProvider().Unified(context.Background(), dir, DiffOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(patches) != 1 || len(patches[0].Hunks) != 3 {
+		t.Fatalf("Expected one file with three hunks, got %+v", patches)
+	}
+	gitCmd(t, dir, "checkout", "--", "file.txt")
+	return patches[0].Content
+}
+
+func TestApplySelectionCommitsChosenHunks(t *testing.T) {
+	ctx := context.Background()
+	dir := initRepo(t)
+	patch := threeHunkPatch(t, dir)
+	t.Setenv("GIT_AUTHOR_NAME", "Test")
+	t.Setenv("GIT_AUTHOR_EMAIL", "test@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "Test")
+	t.Setenv("GIT_COMMITTER_EMAIL", "test@example.com")
+
+	// A local edit elsewhere must survive the apply
+	os.WriteFile(filepath.Join(dir, "README.md"), []byte("local edit\n"), 0o644)
+
+	parent := strings.TrimSpace(gitCmd(t, dir, "rev-parse", "HEAD"))
+	result, err := NewProvider().ApplySelection(ctx, dir, []PatchSelection{
+		{File: "file.txt", Content: patch, Hunks: []int{2, 0}},
+	}, "Apply first and last", "")
+	if err != nil {
+		t.Fatalf("%v: %+v", err, result)
+	}
+
+	if result.Branch != "main" || result.Parent != parent {
+		t.Errorf("Unexpected result: %+v", result)
+	}
+	if head := strings.TrimSpace(gitCmd(t, dir, "rev-parse", "HEAD")); head != result.Commit {
+		t.Errorf("Expected HEAD at %s, got %s", result.Commit, head)
+	}
+	if len(result.Files) != 1 || result.Files[0].Status != FileApplied || fmt.Sprint(result.Files[0].Hunks) != "[0 2]" {
+		t.Errorf("Unexpected file results: %+v", result.Files)
+	}
+
+	committed := gitCmd(t, dir, "show", "HEAD:file.txt")
+	if !strings.Contains(committed, "inserted a") || strings.Contains(committed, "edited 15") || strings.Contains(committed, "line 27\n") {
+		t.Errorf("Unexpected committed content:\n%s", committed)
+	}
+
+	// The checked-out copy follows the commit and the local edit is kept
+	onDisk, _ := os.ReadFile(filepath.Join(dir, "file.txt"))
+	if string(onDisk) != committed {
+		t.Error("Expected the work tree copy to be refreshed")
+	}
+	if status := gitCmd(t, dir, "status", "--porcelain"); strings.TrimSpace(status) != "M README.md" {
+		t.Errorf("Expected only the local edit to remain, got %q", status)
+	}
+}
+
+func TestApplyResultCovers(t *testing.T) {
+	patch := threeHunkPatch(t, initRepo(t))
+	patches := map[string]string{"file.txt": patch, "moved.txt": "diff --git a/old.txt b/moved.txt\nsimilarity index 100%\nrename from old.txt\nrename to moved.txt\n"}
+
+	tests := []struct {
+		name  string
+		files []FileResult
+		want  bool
+	}{
+		{"everything", []FileResult{{File: "file.txt", Hunks: []int{0, 1, 2}, Status: FileApplied}, {File: "moved.txt", Hunks: []int{}, Status: FileApplied}}, true},
+		{"some hunks", []FileResult{{File: "file.txt", Hunks: []int{0, 2}, Status: FileApplied}, {File: "moved.txt", Hunks: []int{}, Status: FileApplied}}, false},
+		{"some files", []FileResult{{File: "file.txt", Hunks: []int{0, 1, 2}, Status: FileApplied}}, false},
+		{"conflicts", []FileResult{{File: "file.txt", Hunks: []int{0, 1}, Status: FileConflicted}, {File: "moved.txt", Hunks: []int{}, Status: FileApplied}}, false},
+	}
+	for _, tt := range tests {
+		if got := (ApplyResult{Files: tt.files}).Covers(patches); got != tt.want {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestApplySelectionFailureLeavesBranch(t *testing.T) {
+	ctx := context.Background()
+	dir := initRepo(t)
+	patch := threeHunkPatch(t, dir)
+
+	// Change the lines the last hunk deletes so it no longer applies
+	lines := numberedLines(30)
+	lines[26] = "someone else"
+	writeLines(t, filepath.Join(dir, "file.txt"), lines)
+	gitCmd(t, dir, "commit", "-qam", "Conflicting change")
+	before := gitCmd(t, dir, "rev-parse", "HEAD")
+
+	result, err := NewProvider().ApplySelection(ctx, dir, []PatchSelection{
+		{File: "file.txt", Content: patch, Hunks: []int{0, 2}},
+	}, "Should not commit", "")
+	if !errors.Is(err, ErrApplyFailed) {
+		t.Fatalf("Expected ErrApplyFailed, got %v", err)
+	}
+	if len(result.Files) != 1 || result.Files[0].Status != FileFailed || result.Files[0].Error == "" {
+		t.Errorf("Expected the file to be reported as failed, got %+v", result.Files)
+	}
+	if after := gitCmd(t, dir, "rev-parse", "HEAD"); after != before {
+		t.Error("Expected the branch to stay put")
+	}
+	if status := gitCmd(t, dir, "status", "--porcelain"); status != "" {
+		t.Errorf("Expected a clean tree, got %q", status)
+	}
+}
+
+func TestSelectHunksShiftsOffsets(t *testing.T) {
+	patch := "--- a/f\n+++ b/f\n@@ -1,2 +1,4 @@\n a\n+b\n+c\n d\n@@ -10,3 +12,2 @@\n x\n-y\n z\n"
+
+	text, _, err := SelectHunks(PatchSelection{File: "f", Content: patch, Hunks: []int{1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(text, "@@ -10,3 +10,2 @@") {
+		t.Errorf("Expected the second hunk to be shifted back by two lines, got:\n%s", text)
+	}
+
+	if _, _, err := SelectHunks(PatchSelection{File: "f", Content: patch, Hunks: []int{5}}); err == nil {
+		t.Error("Expected an out of range hunk to fail")
+	}
+}
+
+func TestApplySelectionRename(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("GIT_AUTHOR_NAME", "Test")
+	t.Setenv("GIT_AUTHOR_EMAIL", "test@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "Test")
+	t.Setenv("GIT_COMMITTER_EMAIL", "test@example.com")
+	dir := initRepo(t)
+	g := NewProvider()
+
+	gitCmd(t, dir, "mv", "README.md", "docs.md")
+
+	patches, err := g.Unified(ctx, dir, DiffOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(patches) != 1 || patches[0].Type != PatchRenamed || patches[0].OldPath != "README.md" || patches[0].File != "docs.md" {
+		t.Fatalf("Expected README.md to be renamed to docs.md, got %+v", patches)
+	}
+
+	gitCmd(t, dir, "branch", "task")
+	result, err := g.ApplySelection(ctx, dir, []PatchSelection{{File: "docs.md", Content: patches[0].Content}}, "Rename README", "task")
+	if err != nil {
+		t.Fatalf("%v: %+v", err, result)
+	}
+	tree := gitCmd(t, dir, "ls-tree", "--name-only", "task")
+	if tree != "docs.md\n" {
+		t.Errorf("Expected only docs.md on the branch, got %q", tree)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "docs.md")); err != nil {
+		t.Errorf("Expected the work tree to be left alone: %v", err)
+	}
+}
@@ -0,0 +1,84 @@
+package git
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Branch is a local or remote-tracking branch
+type Branch struct {
+	Name    string `json:"name"`
+	Remote  bool   `json:"remote"`
+	Current bool   `json:"current"`
+	// Upstream, Ahead and Behind are only set for local branches that track one
+	Upstream     string `json:"upstream,omitempty"`
+	UpstreamGone bool   `json:"upstreamGone,omitempty"`
+	Ahead        int    `json:"ahead"`
+	Behind       int    `json:"behind"`
+	LastCommit   Commit `json:"lastCommit"`
+}
+
+const branchFormat = "%(refname)%00%(symref)%00%(upstream:short)%00%(upstream:track,nobracket)%00%(HEAD)%00" +
+	"%(objectname)%00%(contents:subject)%00%(authorname)%00%(committerdate:iso-strict)"
+
+// Branches lists the local branches, then the remote-tracking ones, each
+// with its last commit
+func (g *GitProvider) Branches(ctx context.Context, repo string) ([]Branch, error) {
+	out, err := runGit(ctx, repo, "for-each-ref", "--format="+branchFormat, "refs/heads", "refs/remotes")
+	if err != nil {
+		return nil, err
+	}
+
+	branches := []Branch{}
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Split(line, "\x00")
+		if len(fields) != 9 {
+			continue
+		}
+		// Skip symbolic refs such as origin/HEAD
+		if fields[1] != "" {
+			continue
+		}
+
+		date, _ := time.Parse(time.RFC3339, fields[8])
+		branch := Branch{
+			Current:  fields[4] == "*",
+			Upstream: fields[2],
+			LastCommit: Commit{
+				SHA:     fields[5],
+				Subject: fields[6],
+				Author:  fields[7],
+				Date:    date,
+			},
+		}
+		if name, ok := strings.CutPrefix(fields[0], "refs/heads/"); ok {
+			branch.Name = name
+		} else {
+			branch.Name = strings.TrimPrefix(fields[0], "refs/remotes/")
+			branch.Remote = true
+		}
+		parseTrack(&branch, fields[3])
+
+		branches = append(branches, branch)
+	}
+
+	return branches, nil
+}
+
+// parseTrack reads an upstream:track value such as "ahead 2, behind 1" or
+// "gone"
+func parseTrack(branch *Branch, track string) {
+	if track == "gone" {
+		branch.UpstreamGone = true
+		return
+	}
+	for _, part := range strings.Split(track, ", ") {
+		if n, ok := strings.CutPrefix(part, "ahead "); ok {
+			branch.Ahead, _ = strconv.Atoi(n)
+		} else if n, ok := strings.CutPrefix(part, "behind "); ok {
+			branch.Behind, _ = strconv.Atoi(n)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// emptyTree is the ID of the empty tree object, used as the base of a
+// repository that has no commits yet
+const emptyTree = "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+
+// DiffMode selects which changes a diff against the work tree covers
+type DiffMode string
+
+const (
+	// DiffAll compares the base with the work tree, staged or not
+	DiffAll DiffMode = "all"
+	// DiffStaged compares the base with the index
+	DiffStaged DiffMode = "staged"
+	// DiffUnstaged compares the index with the work tree
+	DiffUnstaged DiffMode = "unstaged"
+)
+
+// Whitespace handling, matching git diff's ignore options
+const (
+	WhitespaceIgnoreAll    = "ignore-all"
+	WhitespaceIgnoreChange = "ignore-change"
+	WhitespaceIgnoreEOL    = "ignore-eol"
+)
+
+// whitespaceFlags maps the Whitespace constants to git diff's options
+var whitespaceFlags = map[string]string{
+	WhitespaceIgnoreAll:    "--ignore-all-space",
+	WhitespaceIgnoreChange: "--ignore-space-change",
+	WhitespaceIgnoreEOL:    "--ignore-space-at-eol",
+}
+
+// DiffOptions selects what a diff compares. Without a Target the base is
+// compared with the index or work tree according to Mode, and untracked
+// files show up as added unless Mode is DiffStaged. With a Target two
+// commits are compared and Mode is ignored.
+type DiffOptions struct {
+	// Base is the ref to compare from; it defaults to HEAD
+	Base string
+	// Target is the ref to compare to; empty means the index or work tree
+	Target string
+	// Paths limits the diff to these pathspecs
+	Paths []string
+	// Mode defaults to DiffAll
+	Mode DiffMode
+	// Context is the number of context lines; 0 keeps git's default of 3
+	Context int
+	// Whitespace is empty or one of the Whitespace constants
+	Whitespace string
+}
+
+// Validate checks the options for values git would misread
+func (o DiffOptions) Validate() error {
+	for _, ref := range []string{o.Base, o.Target} {
+		if strings.HasPrefix(ref, "-") {
+			return fmt.Errorf("invalid ref %q", ref)
+		}
+	}
+
+	switch o.Mode {
+	case "", DiffAll, DiffStaged:
+	case DiffUnstaged:
+		if o.Base != "" && o.Target == "" {
+			return errors.New("base does not apply to unstaged diffs")
+		}
+	default:
+		return fmt.Errorf("unknown diff mode %q", o.Mode)
+	}
+
+	switch o.Whitespace {
+	case "", WhitespaceIgnoreAll, WhitespaceIgnoreChange, WhitespaceIgnoreEOL:
+	default:
+		return fmt.Errorf("unknown whitespace mode %q", o.Whitespace)
+	}
+
+	if o.Context < 0 {
+		return errors.New("context must not be negative")
+	}
+	return nil
+}
+
+// flags returns the formatting flags shared by every diff invocation. Prefixes
+// are pinned so user config cannot change the paths parseGitDiff reads, and
+// moved or copied files show up as such rather than as deletions.
+func (o DiffOptions) flags() []string {
+	flags := []string{"--no-color", "--no-ext-diff", "--src-prefix=a/", "--dst-prefix=b/", "--find-renames", "--find-copies"}
+	if o.Context > 0 {
+		flags = append(flags, "-U"+strconv.Itoa(o.Context))
+	}
+	if flag, ok := whitespaceFlags[o.Whitespace]; ok {
+		flags = append(flags, flag)
+	}
+	return flags
+}
+
+// diff runs git diff for opts and returns the combined unified diff,
+// including untracked files where the mode covers the work tree
+func diff(ctx context.Context, repo string, opts DiffOptions) (string, error) {
+	if err := opts.Validate(); err != nil {
+		return "", err
+	}
+
+	args := append([]string{"diff"}, opts.flags()...)
+	mode := opts.Mode
+	if mode == "" {
+		mode = DiffAll
+	}
+
+	if opts.Target != "" {
+		base := opts.Base
+		if base == "" {
+			base = "HEAD"
+		}
+		if err := verifyCommit(ctx, repo, base, opts.Target); err != nil {
+			return "", err
+		}
+		args = append(args, base, opts.Target)
+	} else {
+		switch mode {
+		case DiffStaged:
+			base, err := resolveBase(ctx, repo, opts.Base)
+			if err != nil {
+				return "", err
+			}
+			args = append(args, "--cached", base)
+		case DiffAll:
+			base, err := resolveBase(ctx, repo, opts.Base)
+			if err != nil {
+				return "", err
+			}
+			args = append(args, base)
+		}
+	}
+	args = append(args, "--")
+	args = append(args, opts.Paths...)
+
+	output, err := runGit(ctx, repo, args...)
+	if err != nil {
+		return "", err
+	}
+
+	if opts.Target == "" && mode != DiffStaged {
+		untracked, err := diffUntracked(ctx, repo, opts)
+		if err != nil {
+			return "", err
+		}
+		output += untracked
+	}
+
+	return output, nil
+}
+
+// resolveBase returns the base ref for a diff against the index or work
+// tree. Without an explicit ref it is HEAD, or the empty tree while the
+// repository has no commits.
+func resolveBase(ctx context.Context, repo, base string) (string, error) {
+	if base != "" {
+		return base, verifyCommit(ctx, repo, base)
+	}
+	if _, err := runGit(ctx, repo, "rev-parse", "--verify", "--quiet", "HEAD^{commit}"); err != nil {
+		return emptyTree, nil
+	}
+	return "HEAD", nil
+}
+
+// verifyCommit checks that every ref names a commit
+func verifyCommit(ctx context.Context, repo string, refs ...string) error {
+	for _, ref := range refs {
+		if _, err := runGit(ctx, repo, "rev-parse", "--verify", "--quiet", ref+"^{commit}"); err != nil {
+			return fmt.Errorf("unknown ref %q", ref)
+		}
+	}
+	return nil
+}
+
+// diffUntracked renders untracked, non-ignored files as new file diffs
+func diffUntracked(ctx context.Context, repo string, opts DiffOptions) (string, error) {
+	args := append([]string{"ls-files", "--others", "--exclude-standard", "-z", "--"}, opts.Paths...)
+	listing, err := runGit(ctx, repo, args...)
+	if err != nil {
+		return "", err
+	}
+
+	var out strings.Builder
+	for _, file := range strings.Split(listing, "\x00") {
+		if file == "" {
+			continue
+		}
+
+		args := append([]string{"diff"}, opts.flags()...)
+		args = append(args, "--no-index", "--", "/dev/null", file)
+		cmd := exec.CommandContext(ctx, "git", args...)
+		cmd.Dir = repo
+
+		// --no-index exits with 1 when the files differ, which they always do
+		patch, err := cmd.Output()
+		var exitErr *exec.ExitError
+		if err != nil && !(errors.As(err, &exitErr) && exitErr.ExitCode() == 1) {
+			return "", fmt.Errorf("failed to diff untracked file %s: %w", file, err)
+		}
+		out.Write(patch)
+	}
+
+	return out.String(), nil
+}
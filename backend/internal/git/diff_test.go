@@ -0,0 +1,153 @@
+package git
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func patchFiles(patches []FilePatch) map[string]string {
+	files := make(map[string]string)
+	for _, p := range patches {
+		files[p.File] = p.Type
+	}
+	return files
+}
+
+func TestUnifiedModes(t *testing.T) {
+	ctx := context.Background()
+	dir := initRepo(t)
+	g := NewProvider()
+
+	os.WriteFile(filepath.Join(dir, "README.md"), []byte("hello\nstaged\n"), 0o644)
+	gitCmd(t, dir, "add", "README.md")
+	os.WriteFile(filepath.Join(dir, "README.md"), []byte("hello\nstaged\nunstaged\n"), 0o644)
+	os.WriteFile(filepath.Join(dir, "new.txt"), []byte("new\n"), 0o644)
+
+	tests := []struct {
+		mode   DiffMode
+		files  map[string]string
+		has    string
+		hasNot string
+	}{
+		{DiffAll, map[string]string{"README.md": "modified", "new.txt": "added"}, "+unstaged", ""},
+		{DiffStaged, map[string]string{"README.md": "modified"}, "+staged", "+unstaged"},
+		{DiffUnstaged, map[string]string{"README.md": "modified", "new.txt": "added"}, "+unstaged", "+staged"},
+	}
+	for _, tt := range tests {
+		patches, err := g.Unified(ctx, dir, DiffOptions{Mode: tt.mode})
+		if err != nil {
+			t.Fatalf("%s: %v", tt.mode, err)
+		}
+		files := patchFiles(patches)
+		if len(files) != len(tt.files) {
+			t.Errorf("%s: expected %v, got %v", tt.mode, tt.files, files)
+		}
+		for file, typ := range tt.files {
+			if files[file] != typ {
+				t.Errorf("%s: expected %s to be %s, got %q", tt.mode, file, typ, files[file])
+			}
+		}
+		readme := patches[0].Content
+		if !strings.Contains(readme, tt.has) || (tt.hasNot != "" && strings.Contains(readme, tt.hasNot)) {
+			t.Errorf("%s: unexpected README diff:\n%s", tt.mode, readme)
+		}
+	}
+
+	patches, err := g.Unified(ctx, dir, DiffOptions{Paths: []string{"new.txt"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if files := patchFiles(patches); len(files) != 1 || files["new.txt"] != "added" {
+		t.Errorf("Expected path filter to keep only new.txt, got %v", files)
+	}
+}
+
+func TestUnifiedBetweenRefs(t *testing.T) {
+	ctx := context.Background()
+	dir := initRepo(t)
+	g := NewProvider()
+
+	var lines []string
+	for i := 1; i <= 20; i++ {
+		lines = append(lines, "line")
+	}
+	os.WriteFile(filepath.Join(dir, "README.md"), []byte(strings.Join(lines, "\n")+"\n"), 0o644)
+	gitCmd(t, dir, "commit", "-qam", "Add lines")
+	lines[10] = "changed"
+	os.WriteFile(filepath.Join(dir, "README.md"), []byte(strings.Join(lines, "\n")+"\n"), 0o644)
+	gitCmd(t, dir, "commit", "-qam", "Change a line")
+
+	patches, err := g.Unified(ctx, dir, DiffOptions{Base: "HEAD~1", Target: "HEAD", Context: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(patches) != 1 || !strings.Contains(patches[0].Content, "@@ -10,3 +10,3 @@") {
+		t.Errorf("Expected a one-line-context hunk, got %+v", patches)
+	}
+
+	if _, err := g.Unified(ctx, dir, DiffOptions{Base: "nope"}); err == nil {
+		t.Error("Expected an unknown ref to fail")
+	}
+	if _, err := g.Unified(ctx, dir, DiffOptions{Base: "--output=/tmp/x"}); err == nil {
+		t.Error("Expected an option-like ref to be rejected")
+	}
+}
+
+func TestUnifiedWhitespace(t *testing.T) {
+	ctx := context.Background()
+	dir := initRepo(t)
+	g := NewProvider()
+
+	os.WriteFile(filepath.Join(dir, "eol.txt"), []byte("a b\n"), 0o644)
+	os.WriteFile(filepath.Join(dir, "change.txt"), []byte("a b\n"), 0o644)
+	os.WriteFile(filepath.Join(dir, "all.txt"), []byte("ab\n"), 0o644)
+	gitCmd(t, dir, "add", ".")
+	gitCmd(t, dir, "commit", "-qm", "Add files")
+	os.WriteFile(filepath.Join(dir, "eol.txt"), []byte("a b  \n"), 0o644)
+	os.WriteFile(filepath.Join(dir, "change.txt"), []byte("a    b\n"), 0o644)
+	os.WriteFile(filepath.Join(dir, "all.txt"), []byte("a b\n"), 0o644)
+
+	tests := []struct {
+		whitespace string
+		changed    []string
+	}{
+		{"", []string{"all.txt", "change.txt", "eol.txt"}},
+		{WhitespaceIgnoreEOL, []string{"all.txt", "change.txt"}},
+		{WhitespaceIgnoreChange, []string{"all.txt"}},
+		{WhitespaceIgnoreAll, nil},
+	}
+	for _, tt := range tests {
+		patches, err := g.Unified(ctx, dir, DiffOptions{Whitespace: tt.whitespace})
+		if err != nil {
+			t.Fatalf("%q: %v", tt.whitespace, err)
+		}
+		// git may still list a file whose changes are all ignored, without
+		// any hunks
+		var changed []string
+		for _, p := range patches {
+			if strings.Contains(p.Content, "@@") {
+				changed = append(changed, p.File)
+			}
+		}
+		if strings.Join(changed, ",") != strings.Join(tt.changed, ",") {
+			t.Errorf("%q: expected changes in %v, got %v", tt.whitespace, tt.changed, changed)
+		}
+	}
+}
+
+func TestUnifiedWithoutCommits(t *testing.T) {
+	dir := t.TempDir()
+	gitCmd(t, dir, "init", "-q")
+	os.WriteFile(filepath.Join(dir, "first.txt"), []byte("first\n"), 0o644)
+
+	patches, err := NewProvider().Unified(context.Background(), dir, DiffOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if files := patchFiles(patches); files["first.txt"] != "added" {
+		t.Errorf("Expected first.txt to be added, got %v", files)
+	}
+}
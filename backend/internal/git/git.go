@@ -3,28 +3,49 @@ package git
 import (
 	"context"
 	"fmt"
+	"os"
 	"os/exec"
 	"strings"
 )
 
-// FilePatch represents a file change
+// FilePatch represents a file change. Content holds the raw diff text and
+// Hunks its parsed form. File is the new path, or the old one for deletions;
+// OldPath is empty for added files and NewPath for deleted ones. Modes are
+// git's octal file modes.
 type FilePatch struct {
-	File    string `json:"file"`
-	Content string `json:"content"`
-	Type    string `json:"type"` // "added", "modified", "deleted"
+	File       string `json:"file"`
+	OldPath    string `json:"oldPath,omitempty"`
+	NewPath    string `json:"newPath,omitempty"`
+	Content    string `json:"content"`
+	Type       string `json:"type"` // "added", "modified", "deleted", "renamed", "copied", "binary"
+	OldMode    string `json:"oldMode,omitempty"`
+	Mode       string `json:"mode,omitempty"`
+	Similarity int    `json:"similarity,omitempty"`
+	IsBinary   bool   `json:"isBinary"`
+	Hunks      []Hunk `json:"hunks"`
 }
 
-// PatchSelection represents a selected patch to apply
+// PatchSelection picks hunks out of a file's patch to apply. Hunks are
+// indexes into the hunks of Content; none means the whole patch. Blob is the
+// file's blob the patch was made against, if known, which lets the patch be
+// merged when the file has changed since.
 type PatchSelection struct {
 	File    string `json:"file"`
 	Content string `json:"content"`
-	Apply   bool   `json:"apply"`
+	Hunks   []int  `json:"hunks"`
+	Blob    string `json:"blob,omitempty"`
 }
 
 // Provider interface for git operations
 type Provider interface {
-	Unified(ctx context.Context, repo string, base string) ([]FilePatch, error)
-	ApplySelection(ctx context.Context, repo string, sel []PatchSelection, commitMsg, branch string) (string, error)
+	Unified(ctx context.Context, repo string, opts DiffOptions) ([]FilePatch, error)
+	ApplySelection(ctx context.Context, repo string, sel []PatchSelection, commitMsg, branch string) (ApplyResult, error)
+	Revert(ctx context.Context, repo, branch string, commits []string, mode, commitMsg string) (RevertResult, error)
+	Status(ctx context.Context, repo string) (Status, error)
+	Branches(ctx context.Context, repo string) ([]Branch, error)
+	Log(ctx context.Context, repo string, opts LogOptions) ([]LogEntry, error)
+	Push(ctx context.Context, repo string, opts PushOptions) (PushResult, error)
+	FormatPatch(ctx context.Context, repo string, commits []string) ([]PatchFile, error)
 }
 
 // GitProvider implements the git provider interface
@@ -35,84 +56,52 @@ func NewProvider() *GitProvider {
 	return &GitProvider{}
 }
 
-// Unified gets the unified diff for a repository
-func (g *GitProvider) Unified(ctx context.Context, repo string, base string) ([]FilePatch, error) {
-	// Run git diff command
-	cmd := exec.CommandContext(ctx, "git", "diff", "--no-color", base)
-	cmd.Dir = repo
-
-	output, err := cmd.Output()
+// Unified gets the unified diff for a repository as one patch per file
+func (g *GitProvider) Unified(ctx context.Context, repo string, opts DiffOptions) ([]FilePatch, error) {
+	output, err := diff(ctx, repo, opts)
 	if err != nil {
-		// If there's no diff, return empty patches
-		if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 1 {
-			return []FilePatch{}, nil
-		}
-		return nil, fmt.Errorf("failed to run git diff: %w", err)
+		return nil, err
 	}
 
 	// Parse the diff output into patches
-	patches := parseGitDiff(string(output))
-	return patches, nil
-}
-
-// ApplySelection applies selected patches to a repository
-func (g *GitProvider) ApplySelection(ctx context.Context, repo string, sel []PatchSelection, commitMsg, branch string) (string, error) {
-	// For now, we'll create a simple implementation that writes files directly
-	// In a real implementation, this would use git apply with proper patch formatting
-
-	for _, patch := range sel {
-		if patch.Apply {
-			// This is a simplified implementation - in reality, you'd want to apply
-			// the actual git patch properly
-			fmt.Printf("Would apply patch to file: %s\n", patch.File)
+	patches := parseGitDiff(output)
+	for i := range patches {
+		hunks, err := ParseHunks(patches[i].Content)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse diff of %s: %w", patches[i].File, err)
 		}
+		patches[i].Hunks = hunks
 	}
+	return patches, nil
+}
 
-	// Return a mock commit hash
-	return "abc123def456", nil
+// runGit runs a git command in dir and returns its stdout. Failures include
+// git's stderr so callers can surface the reason.
+func runGit(ctx context.Context, dir string, args ...string) (string, error) {
+	return runGitWith(ctx, dir, nil, "", args...)
 }
 
-// parseGitDiff parses git diff output into FilePatch structs
-func parseGitDiff(diff string) []FilePatch {
-	if diff == "" {
-		return []FilePatch{}
+// runGitWith runs a git command with extra environment variables and the
+// given stdin
+func runGitWith(ctx context.Context, dir string, env []string, stdin string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	if stdin != "" {
+		cmd.Stdin = strings.NewReader(stdin)
 	}
 
-	lines := strings.Split(diff, "\n")
-	var patches []FilePatch
-	var currentPatch *FilePatch
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
 
-	for _, line := range lines {
-		if strings.HasPrefix(line, "diff --git") {
-			if currentPatch != nil {
-				patches = append(patches, *currentPatch)
-			}
-			// Extract filename from diff line
-			parts := strings.Split(line, " ")
-			if len(parts) >= 4 {
-				filename := strings.TrimPrefix(parts[3], "b/")
-				currentPatch = &FilePatch{
-					File:    filename,
-					Content: line + "\n",
-					Type:    "modified",
-				}
-			}
-		} else if strings.HasPrefix(line, "new file mode") {
-			if currentPatch != nil {
-				currentPatch.Type = "added"
-			}
-		} else if strings.HasPrefix(line, "deleted file mode") {
-			if currentPatch != nil {
-				currentPatch.Type = "deleted"
-			}
-		} else if currentPatch != nil {
-			currentPatch.Content += line + "\n"
+	output, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return string(output), fmt.Errorf("git %s: %s", args[0], msg)
 		}
+		return string(output), fmt.Errorf("git %s: %w", args[0], err)
 	}
-
-	if currentPatch != nil {
-		patches = append(patches, *currentPatch)
-	}
-
-	return patches
+	return string(output), nil
 }
@@ -0,0 +1,194 @@
+package git
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Line kinds within a hunk
+const (
+	LineContext = "context"
+	LineAdded   = "added"
+	LineDeleted = "deleted"
+)
+
+// noNewlineMarker follows a line that has no trailing newline
+const noNewlineMarker = `\ No newline at end of file`
+
+// Line is one line of a hunk. OldLine and NewLine are its 1-based numbers on
+// each side, zero on the side it does not exist in. NoNewline marks the last
+// line of a file that lacks a trailing newline.
+type Line struct {
+	Kind      string `json:"kind"`
+	Content   string `json:"content"`
+	OldLine   int    `json:"oldLine,omitempty"`
+	NewLine   int    `json:"newLine,omitempty"`
+	NoNewline bool   `json:"noNewline,omitempty"`
+}
+
+// Hunk is a contiguous block of changes. Section is the function or heading
+// git prints after the range.
+type Hunk struct {
+	StartOld int    `json:"startOld"`
+	LenOld   int    `json:"lenOld"`
+	StartNew int    `json:"startNew"`
+	LenNew   int    `json:"lenNew"`
+	Section  string `json:"section,omitempty"`
+	Lines    []Line `json:"lines"`
+}
+
+// Header renders the hunk's @@ line
+func (h Hunk) Header() string {
+	header := fmt.Sprintf("@@ -%s +%s @@", formatRange(h.StartOld, h.LenOld), formatRange(h.StartNew, h.LenNew))
+	if h.Section != "" {
+		header += " " + h.Section
+	}
+	return header
+}
+
+// String renders the hunk back into unified diff text
+func (h Hunk) String() string {
+	var b strings.Builder
+	b.WriteString(h.Header())
+	b.WriteByte('\n')
+	for _, line := range h.Lines {
+		switch line.Kind {
+		case LineAdded:
+			b.WriteByte('+')
+		case LineDeleted:
+			b.WriteByte('-')
+		default:
+			b.WriteByte(' ')
+		}
+		b.WriteString(line.Content)
+		b.WriteByte('\n')
+		if line.NoNewline {
+			b.WriteString(noNewlineMarker)
+			b.WriteByte('\n')
+		}
+	}
+	return b.String()
+}
+
+// ParseHunks parses the hunks of a single file's unified diff. Lines before
+// the first @@ header, such as the diff --git and ---/+++ headers, are
+// skipped.
+func ParseHunks(diff string) ([]Hunk, error) {
+	hunks := []Hunk{}
+	lines := strings.Split(diff, "\n")
+
+	for i := 0; i < len(lines); i++ {
+		if !strings.HasPrefix(lines[i], "@@ ") {
+			continue
+		}
+
+		hunk, err := parseHunkHeader(lines[i])
+		if err != nil {
+			return nil, err
+		}
+
+		oldLine, newLine := hunk.StartOld, hunk.StartNew
+		oldLeft, newLeft := hunk.LenOld, hunk.LenNew
+		for (oldLeft > 0 || newLeft > 0) && i+1 < len(lines) {
+			i++
+			text := lines[i]
+			if text == "" {
+				// Some tools strip the space off empty context lines
+				text = " "
+			}
+
+			var line Line
+			switch text[0] {
+			case ' ':
+				line = Line{Kind: LineContext, Content: text[1:], OldLine: oldLine, NewLine: newLine}
+				oldLine++
+				newLine++
+				oldLeft--
+				newLeft--
+			case '-':
+				line = Line{Kind: LineDeleted, Content: text[1:], OldLine: oldLine}
+				oldLine++
+				oldLeft--
+			case '+':
+				line = Line{Kind: LineAdded, Content: text[1:], NewLine: newLine}
+				newLine++
+				newLeft--
+			case '\\':
+				if n := len(hunk.Lines); n > 0 {
+					hunk.Lines[n-1].NoNewline = true
+				}
+				continue
+			default:
+				return nil, fmt.Errorf("unexpected line in hunk %q: %q", hunk.Header(), text)
+			}
+			hunk.Lines = append(hunk.Lines, line)
+		}
+		if oldLeft != 0 || newLeft != 0 {
+			return nil, fmt.Errorf("hunk %q is truncated", hunk.Header())
+		}
+
+		// The marker for the hunk's last line comes after the counted lines
+		if i+1 < len(lines) && strings.HasPrefix(lines[i+1], `\`) {
+			i++
+			if n := len(hunk.Lines); n > 0 {
+				hunk.Lines[n-1].NoNewline = true
+			}
+		}
+
+		hunks = append(hunks, hunk)
+	}
+
+	return hunks, nil
+}
+
+// parseHunkHeader parses "@@ -a,b +c,d @@ section"
+func parseHunkHeader(header string) (Hunk, error) {
+	rest := strings.TrimPrefix(header, "@@ ")
+	end := strings.Index(rest, " @@")
+	if end < 0 {
+		return Hunk{}, fmt.Errorf("invalid hunk header %q", header)
+	}
+
+	ranges := strings.Fields(rest[:end])
+	if len(ranges) != 2 || !strings.HasPrefix(ranges[0], "-") || !strings.HasPrefix(ranges[1], "+") {
+		return Hunk{}, fmt.Errorf("invalid hunk header %q", header)
+	}
+
+	var hunk Hunk
+	var err error
+	if hunk.StartOld, hunk.LenOld, err = parseRange(ranges[0][1:]); err != nil {
+		return Hunk{}, fmt.Errorf("invalid hunk header %q", header)
+	}
+	if hunk.StartNew, hunk.LenNew, err = parseRange(ranges[1][1:]); err != nil {
+		return Hunk{}, fmt.Errorf("invalid hunk header %q", header)
+	}
+	hunk.Section = strings.TrimSpace(rest[end+3:])
+	hunk.Lines = []Line{}
+
+	return hunk, nil
+}
+
+// parseRange parses "start,len" or "start", where the length defaults to 1
+func parseRange(r string) (int, int, error) {
+	startText, lenText, hasLen := strings.Cut(r, ",")
+	start, err := strconv.Atoi(startText)
+	if err != nil {
+		return 0, 0, err
+	}
+	if !hasLen {
+		return start, 1, nil
+	}
+	length, err := strconv.Atoi(lenText)
+	if err != nil {
+		return 0, 0, err
+	}
+	return start, length, nil
+}
+
+func formatRange(start, length int) string {
+	if length == 1 {
+		return strconv.Itoa(start)
+	}
+	return fmt.Sprintf("%d,%d", start, length)
+}
@@ -0,0 +1,74 @@
+package git
+
+import (
+	"strings"
+	"testing"
+)
+
+const sampleDiff = `diff --git a/main.go b/main.go
+index 1111111..2222222 100644
+--- a/main.go
++++ b/main.go
+@@ -1,4 +1,4 @@ package main
+ import "fmt"
+-func a() {}
++func b() {}
+ 
+ func c() {}
+@@ -10 +10,2 @@ func c() {}
+-old last
+\ No newline at end of file
++new last
++added
+\ No newline at end of file
+`
+
+func TestParseHunks(t *testing.T) {
+	hunks, err := ParseHunks(sampleDiff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hunks) != 2 {
+		t.Fatalf("Expected 2 hunks, got %d", len(hunks))
+	}
+
+	first := hunks[0]
+	if first.StartOld != 1 || first.LenOld != 4 || first.StartNew != 1 || first.LenNew != 4 || first.Section != "package main" {
+		t.Errorf("Unexpected header: %+v", first)
+	}
+	want := []Line{
+		{Kind: LineContext, Content: `import "fmt"`, OldLine: 1, NewLine: 1},
+		{Kind: LineDeleted, Content: "func a() {}", OldLine: 2},
+		{Kind: LineAdded, Content: "func b() {}", NewLine: 2},
+		{Kind: LineContext, Content: "", OldLine: 3, NewLine: 3},
+		{Kind: LineContext, Content: "func c() {}", OldLine: 4, NewLine: 4},
+	}
+	for i, line := range want {
+		if first.Lines[i] != line {
+			t.Errorf("Line %d: expected %+v, got %+v", i, line, first.Lines[i])
+		}
+	}
+
+	second := hunks[1]
+	if second.LenOld != 1 || second.LenNew != 2 {
+		t.Errorf("Expected omitted length to default to 1, got %+v", second)
+	}
+	if !second.Lines[0].NoNewline || second.Lines[1].NoNewline || !second.Lines[2].NoNewline {
+		t.Errorf("Unexpected no-newline markers: %+v", second.Lines)
+	}
+
+	// Rendering gives back the hunk text
+	rendered := first.String() + second.String()
+	if !strings.HasSuffix(sampleDiff, rendered) {
+		t.Errorf("Expected hunks to render back to the diff, got:\n%s", rendered)
+	}
+}
+
+func TestParseHunksRejectsTruncated(t *testing.T) {
+	if _, err := ParseHunks("@@ -1,3 +1,3 @@\n a\n-b\n"); err == nil {
+		t.Error("Expected a truncated hunk to fail")
+	}
+	if _, err := ParseHunks("@@ -x +1 @@\n+a\n"); err == nil {
+		t.Error("Expected a malformed header to fail")
+	}
+}
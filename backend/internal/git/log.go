@@ -0,0 +1,140 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LogOptions selects the commits Log returns
+type LogOptions struct {
+	// Ref is where history starts; it defaults to HEAD
+	Ref string
+	// Paths limits history to commits touching these pathspecs
+	Paths []string
+	// Since is any date git understands, such as "8am" or "2 days ago"
+	Since string
+	Skip  int
+	Limit int
+}
+
+// FileStat counts the lines a commit changed in one file. Binary files have
+// no line counts.
+type FileStat struct {
+	Path      string `json:"path"`
+	OldPath   string `json:"oldPath,omitempty"`
+	Additions int    `json:"additions"`
+	Deletions int    `json:"deletions"`
+	Binary    bool   `json:"binary,omitempty"`
+}
+
+// LogEntry is a commit with its parents and per-file stats
+type LogEntry struct {
+	Commit
+	Email     string     `json:"email"`
+	Parents   []string   `json:"parents"`
+	Additions int        `json:"additions"`
+	Deletions int        `json:"deletions"`
+	Files     []FileStat `json:"files"`
+}
+
+// Log returns commits newest first. A repository without commits has no
+// history rather than an error.
+func (g *GitProvider) Log(ctx context.Context, repo string, opts LogOptions) ([]LogEntry, error) {
+	if strings.HasPrefix(opts.Ref, "-") {
+		return nil, fmt.Errorf("invalid ref %q", opts.Ref)
+	}
+	if opts.Skip < 0 || opts.Limit < 0 {
+		return nil, errors.New("skip and limit must not be negative")
+	}
+
+	ref := opts.Ref
+	if ref == "" {
+		if _, err := runGit(ctx, repo, "rev-parse", "--verify", "--quiet", "HEAD^{commit}"); err != nil {
+			return []LogEntry{}, nil
+		}
+		ref = "HEAD"
+	} else if err := verifyCommit(ctx, repo, ref); err != nil {
+		return nil, err
+	}
+
+	args := []string{"log", "-z", "--numstat", "--find-renames", "--no-color",
+		"--format=%x1e%H%x00%P%x00%an%x00%ae%x00%aI%x00%s"}
+	if opts.Skip > 0 {
+		args = append(args, "--skip="+strconv.Itoa(opts.Skip))
+	}
+	if opts.Limit > 0 {
+		args = append(args, "--max-count="+strconv.Itoa(opts.Limit))
+	}
+	if opts.Since != "" {
+		args = append(args, "--since="+opts.Since)
+	}
+	args = append(args, ref, "--")
+	args = append(args, opts.Paths...)
+
+	out, err := runGit(ctx, repo, args...)
+	if err != nil {
+		return nil, err
+	}
+	return parseLog(out), nil
+}
+
+// parseLog reads the output of Log's git log invocation. Each record starts
+// with a record separator and NUL-separated header fields ending in a
+// newline, followed by NUL-terminated numstat entries. Renames take three
+// entries: the counts with an empty path, then the old and new paths.
+func parseLog(out string) []LogEntry {
+	entries := []LogEntry{}
+
+	for _, record := range strings.Split(out, "\x1e") {
+		header, stats, _ := strings.Cut(record, "\n")
+		fields := strings.Split(strings.TrimSuffix(header, "\x00"), "\x00")
+		if len(fields) != 6 {
+			continue
+		}
+
+		date, _ := time.Parse(time.RFC3339, fields[4])
+		entry := LogEntry{
+			Commit: Commit{
+				SHA:     fields[0],
+				Subject: fields[5],
+				Author:  fields[2],
+				Date:    date,
+			},
+			Email:   fields[3],
+			Parents: strings.Fields(fields[1]),
+			Files:   []FileStat{},
+		}
+
+		tokens := strings.Split(stats, "\x00")
+		for i := 0; i < len(tokens); i++ {
+			counts := strings.SplitN(strings.TrimPrefix(tokens[i], "\n"), "\t", 3)
+			if len(counts) != 3 {
+				continue
+			}
+
+			stat := FileStat{Path: counts[2]}
+			if counts[0] == "-" && counts[1] == "-" {
+				stat.Binary = true
+			} else {
+				stat.Additions, _ = strconv.Atoi(counts[0])
+				stat.Deletions, _ = strconv.Atoi(counts[1])
+			}
+			if stat.Path == "" && i+2 < len(tokens) {
+				stat.OldPath, stat.Path = tokens[i+1], tokens[i+2]
+				i += 2
+			}
+
+			entry.Additions += stat.Additions
+			entry.Deletions += stat.Deletions
+			entry.Files = append(entry.Files, stat)
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries
+}
@@ -0,0 +1,43 @@
+package git
+
+import (
+	"context"
+	"testing"
+)
+
+func TestLog(t *testing.T) {
+	ctx := context.Background()
+	dir := initRepo(t)
+	g := NewProvider()
+
+	commitFile(t, dir, "a.txt", "one\ntwo\n")
+	commitFile(t, dir, "README.md", "bye\n")
+	gitCmd(t, dir, "mv", "a.txt", "b.txt")
+	gitCmd(t, dir, "commit", "-q", "-m", "Move a.txt")
+
+	entries, err := g.Log(ctx, dir, LogOptions{Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Subject != "Move a.txt" || entries[1].Subject != "Change README.md" {
+		t.Fatalf("Unexpected entries: %+v", entries)
+	}
+	if files := entries[0].Files; len(files) != 1 || files[0].Path != "b.txt" || files[0].OldPath != "a.txt" {
+		t.Errorf("Expected a rename, got %+v", files)
+	}
+	if e := entries[1]; e.Additions != 1 || e.Deletions != 1 || len(e.Parents) != 1 || e.Email != "test@example.com" {
+		t.Errorf("Unexpected stats: %+v", e)
+	}
+
+	entries, err = g.Log(ctx, dir, LogOptions{Skip: 1, Paths: []string{"README.md"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Subject != "Initial commit" {
+		t.Errorf("Expected the path filter and skip to leave the initial commit, got %+v", entries)
+	}
+
+	if _, err := g.Log(ctx, dir, LogOptions{Ref: "--all"}); err == nil {
+		t.Error("Expected an option-like ref to be rejected")
+	}
+}
@@ -0,0 +1,255 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// HunkConflict is a selected hunk that could not be merged into a file that
+// changed after its patch was made. Ours is the branch's current text of the
+// conflicting region, Theirs the hunk's version and Base what both started
+// from.
+type HunkConflict struct {
+	Hunk   int    `json:"hunk"`
+	Ours   string `json:"ours"`
+	Base   string `json:"base"`
+	Theirs string `json:"theirs"`
+}
+
+// PatchBase returns the commit checked out in the work tree at repo and the
+// blob of each of files in it, to be stored with patches made against that
+// work tree so they can be merged later if the files move on. Files that do
+// not exist in the commit have no blob.
+func PatchBase(ctx context.Context, repo string, files []string) (string, map[string]string, error) {
+	repo, err := WorkTreeRoot(ctx, repo)
+	if err != nil {
+		return "", nil, err
+	}
+
+	head, err := runGit(ctx, repo, "rev-parse", "--verify", "--quiet", "HEAD^{commit}")
+	if err != nil {
+		return "", map[string]string{}, nil
+	}
+	head = strings.TrimSpace(head)
+
+	return head, blobsAt(ctx, repo, head, files), nil
+}
+
+// Blobs returns the blob of each of files in commit, for patches made against
+// a commit other than the one checked out. Files that do not exist in the
+// commit have no blob.
+func Blobs(ctx context.Context, repo, commit string, files []string) (map[string]string, error) {
+	if err := verifyCommit(ctx, repo, commit); err != nil {
+		return nil, err
+	}
+	return blobsAt(ctx, repo, commit, files), nil
+}
+
+// blobsAt returns the blobs of those of files that exist in commit
+func blobsAt(ctx context.Context, repo, commit string, files []string) map[string]string {
+	blobs := make(map[string]string, len(files))
+	for _, file := range files {
+		if blob, _ := blobAt(ctx, repo, commit, file); blob != "" {
+			blobs[file] = blob
+		}
+	}
+	return blobs
+}
+
+// blobAt returns the blob ID and mode of path in commit, or empty strings if
+// it is not there
+func blobAt(ctx context.Context, repo, commit, path string) (string, string) {
+	out, err := runGit(ctx, repo, "ls-tree", "-z", commit, "--", path)
+	if err != nil {
+		return "", ""
+	}
+
+	// <mode> SP <type> SP <object> TAB <path>
+	meta, _, _ := strings.Cut(strings.TrimSuffix(out, "\x00"), "\t")
+	fields := strings.Fields(meta)
+	if len(fields) != 3 || fields[1] != "blob" {
+		return "", ""
+	}
+	return fields[2], fields[0]
+}
+
+// mergeDrifted brings the selected hunks of a patch made against sel.Blob
+// into the file's current blob. Each hunk is applied to the old blob and
+// three-way merged into the current content on its own, so hunks that clash
+// with the newer changes are reported and left out while the rest go in.
+func mergeDrifted(ctx context.Context, repo string, sel PatchSelection, current string) (string, FileResult, error) {
+	result := FileResult{File: sel.File, Status: FileApplied, Drifted: true, Hunks: []int{}}
+
+	if parsed := parseGitDiff(sel.Content); len(parsed) == 1 && (parsed[0].Type != PatchModified || parsed[0].OldPath != parsed[0].NewPath) {
+		return "", result, errors.New("file changed since the patch was made")
+	}
+
+	_, hunks, err := splitPatch(sel.File, sel.Content)
+	if err != nil {
+		return "", result, err
+	}
+	indexes, err := chooseHunks(len(hunks), sel.Hunks)
+	if err != nil {
+		return "", result, err
+	}
+
+	base, err := runGit(ctx, repo, "cat-file", "blob", sel.Blob)
+	if err != nil {
+		return "", result, fmt.Errorf("patch base %s is not available", sel.Blob)
+	}
+	ours, err := runGit(ctx, repo, "cat-file", "blob", current)
+	if err != nil {
+		return "", result, err
+	}
+
+	for _, i := range indexes {
+		theirs, err := applyHunks(base, hunks[i:i+1])
+		if err != nil {
+			return "", result, fmt.Errorf("hunk %d: %w", i, err)
+		}
+
+		merged, conflicts, err := mergeFile(ctx, ours, base, theirs)
+		if err != nil {
+			return "", result, err
+		}
+		if len(conflicts) > 0 {
+			for _, conflict := range conflicts {
+				conflict.Hunk = i
+				result.Conflicts = append(result.Conflicts, conflict)
+			}
+			continue
+		}
+
+		ours = merged
+		result.Hunks = append(result.Hunks, i)
+	}
+
+	if len(result.Conflicts) > 0 {
+		result.Status = FileConflicted
+	}
+	return ours, result, nil
+}
+
+// applyHunks applies hunks, in order, to the text they were made against.
+// It fails if the text does not match what the hunks expect.
+func applyHunks(text string, hunks []Hunk) (string, error) {
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	var out strings.Builder
+	pos := 0
+	for _, hunk := range hunks {
+		// A hunk that only adds lines starts after its old line
+		start := hunk.StartOld - 1
+		if hunk.LenOld == 0 {
+			start = hunk.StartOld
+		}
+		if start < pos || start > len(lines) {
+			return "", fmt.Errorf("hunk %q is out of place", hunk.Header())
+		}
+		for _, line := range lines[pos:start] {
+			out.WriteString(line)
+		}
+		pos = start
+
+		for _, line := range hunk.Lines {
+			switch line.Kind {
+			case LineAdded:
+				out.WriteString(line.Content)
+				if !line.NoNewline {
+					out.WriteByte('\n')
+				}
+			default:
+				if pos >= len(lines) || strings.TrimSuffix(lines[pos], "\n") != line.Content {
+					return "", fmt.Errorf("hunk %q does not match the file", hunk.Header())
+				}
+				if line.Kind == LineContext {
+					out.WriteString(lines[pos])
+				}
+				pos++
+			}
+		}
+	}
+	for _, line := range lines[pos:] {
+		out.WriteString(line)
+	}
+
+	return out.String(), nil
+}
+
+// mergeFile three-way merges ours and theirs from base with git merge-file
+// and returns the result, or the conflicting regions if there are any
+func mergeFile(ctx context.Context, ours, base, theirs string) (string, []HunkConflict, error) {
+	tmp, err := os.MkdirTemp("", "cockpit-merge-")
+	if err != nil {
+		return "", nil, err
+	}
+	defer os.RemoveAll(tmp)
+
+	files := make([]string, 3)
+	for i, content := range []string{ours, base, theirs} {
+		files[i] = filepath.Join(tmp, fmt.Sprint(i))
+		if err := os.WriteFile(files[i], []byte(content), 0o600); err != nil {
+			return "", nil, err
+		}
+	}
+
+	cmd := exec.CommandContext(ctx, "git", "merge-file", "-p", "--diff3",
+		"-L", "ours", "-L", "base", "-L", "theirs", files[0], files[1], files[2])
+
+	// merge-file exits with the number of conflicts, or a negative code on error
+	out, err := cmd.Output()
+	var exitErr *exec.ExitError
+	if err != nil && !(errors.As(err, &exitErr) && exitErr.ExitCode() > 0 && exitErr.ExitCode() < 128) {
+		return "", nil, fmt.Errorf("git merge-file: %w", err)
+	}
+	if err == nil {
+		return string(out), nil, nil
+	}
+	return "", parseConflicts(string(out)), nil
+}
+
+// parseConflicts extracts the sides of each conflict from merge-file's
+// diff3-style output
+func parseConflicts(merged string) []HunkConflict {
+	var conflicts []HunkConflict
+	var current *HunkConflict
+	var side *string
+
+	for _, line := range strings.SplitAfter(merged, "\n") {
+		switch strings.TrimSuffix(line, "\n") {
+		case "<<<<<<< ours":
+			current = &HunkConflict{}
+			side = &current.Ours
+			continue
+		case "||||||| base":
+			if current != nil {
+				side = &current.Base
+				continue
+			}
+		case "=======":
+			if current != nil {
+				side = &current.Theirs
+				continue
+			}
+		case ">>>>>>> theirs":
+			if current != nil {
+				conflicts = append(conflicts, *current)
+				current, side = nil, nil
+				continue
+			}
+		}
+		if side != nil {
+			*side += line
+		}
+	}
+
+	return conflicts
+}
@@ -0,0 +1,79 @@
+package git
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestApplyHunks(t *testing.T) {
+	hunks, err := ParseHunks("@@ -1,2 +1,3 @@\n a\n+b\n c\n@@ -4 +5,2 @@\n-d\n+D\n+e\n\\ No newline at end of file\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := applyHunks("a\nc\nx\nd\n", hunks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "a\nb\nc\nx\nD\ne" {
+		t.Errorf("Unexpected result %q", out)
+	}
+
+	if _, err := applyHunks("a\nz\nx\nd\n", hunks); err == nil {
+		t.Error("Expected a mismatched context line to fail")
+	}
+}
+
+func TestApplySelectionMergesDrift(t *testing.T) {
+	ctx := context.Background()
+	dir := initRepo(t)
+	patch := threeHunkPatch(t, dir)
+	t.Setenv("GIT_AUTHOR_NAME", "Test")
+	t.Setenv("GIT_AUTHOR_EMAIL", "test@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "Test")
+	t.Setenv("GIT_COMMITTER_EMAIL", "test@example.com")
+
+	_, blobs, err := PatchBase(ctx, dir, []string{"file.txt", "missing.txt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if blobs["file.txt"] == "" || blobs["missing.txt"] != "" {
+		t.Fatalf("Unexpected base blobs %v", blobs)
+	}
+
+	// The user keeps editing: one change clashes with the middle hunk, the
+	// other is clear of every hunk
+	lines := numberedLines(30)
+	lines[14] = "user edit 15"
+	lines[20] = "user edit 21"
+	writeLines(t, filepath.Join(dir, "file.txt"), lines)
+	gitCmd(t, dir, "commit", "-qam", "User edits")
+
+	result, err := NewProvider().ApplySelection(ctx, dir, []PatchSelection{
+		{File: "file.txt", Content: patch, Blob: blobs["file.txt"]},
+	}, "Apply stale patch", "")
+	if err != nil {
+		t.Fatalf("%v: %+v", err, result)
+	}
+
+	file := result.Files[0]
+	if file.Status != FileConflicted || !file.Drifted || len(file.Hunks) != 2 || file.Hunks[0] != 0 || file.Hunks[1] != 2 {
+		t.Fatalf("Expected hunks 0 and 2 to merge and 1 to conflict, got %+v", file)
+	}
+	conflict := file.Conflicts[0]
+	if conflict.Hunk != 1 || conflict.Ours != "user edit 15\n" || conflict.Theirs != "edited 15\n" || conflict.Base != "line 15\n" {
+		t.Errorf("Unexpected conflict %+v", conflict)
+	}
+
+	committed := gitCmd(t, dir, "show", "HEAD:file.txt")
+	for _, want := range []string{"inserted a", "user edit 15", "user edit 21"} {
+		if !strings.Contains(committed, want) {
+			t.Errorf("Expected %q in the commit:\n%s", want, committed)
+		}
+	}
+	if strings.Contains(committed, "line 27\n") || strings.Contains(committed, "edited 15") {
+		t.Errorf("Unexpected committed content:\n%s", committed)
+	}
+}
@@ -0,0 +1,196 @@
+package git
+
+import (
+	"strconv"
+	"strings"
+)
+
+// File patch types
+const (
+	PatchAdded    = "added"
+	PatchModified = "modified"
+	PatchDeleted  = "deleted"
+	PatchRenamed  = "renamed"
+	PatchCopied   = "copied"
+	// PatchBinary is a change to the contents of a binary file
+	PatchBinary = "binary"
+)
+
+// parseGitDiff splits git diff output into one FilePatch per file. Paths are
+// taken from the extended header and ---/+++ lines, which unlike the
+// diff --git line are unambiguous, and are unquoted where git quoted them.
+// Each patch's Content is exactly the text git printed for that file.
+func parseGitDiff(diff string) []FilePatch {
+	patches := []FilePatch{}
+	var current *FilePatch
+	inHunks := false
+
+	for _, line := range strings.SplitAfter(diff, "\n") {
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "diff --git ") {
+			if current != nil {
+				patches = append(patches, finishPatch(*current))
+			}
+			current = &FilePatch{}
+			current.OldPath, current.NewPath = parseDiffGitPaths(strings.TrimSuffix(line[len("diff --git "):], "\n"))
+			current.Content = line
+			inHunks = false
+			continue
+		}
+		if current == nil {
+			continue
+		}
+		current.Content += line
+
+		text := strings.TrimSuffix(line, "\n")
+		if strings.HasPrefix(text, "@@ ") {
+			inHunks = true
+		}
+		if inHunks {
+			continue
+		}
+		parseHeaderLine(current, text)
+	}
+
+	if current != nil {
+		patches = append(patches, finishPatch(*current))
+	}
+
+	return patches
+}
+
+// parseHeaderLine records what one extended header line says about a patch.
+// Type is only set for additions, deletions, renames and copies here;
+// finishPatch fills in the rest.
+func parseHeaderLine(p *FilePatch, line string) {
+	switch {
+	case strings.HasPrefix(line, "new file mode "):
+		p.Type = PatchAdded
+		p.Mode = strings.TrimPrefix(line, "new file mode ")
+	case strings.HasPrefix(line, "deleted file mode "):
+		p.Type = PatchDeleted
+		p.OldMode = strings.TrimPrefix(line, "deleted file mode ")
+	case strings.HasPrefix(line, "old mode "):
+		p.OldMode = strings.TrimPrefix(line, "old mode ")
+	case strings.HasPrefix(line, "new mode "):
+		p.Mode = strings.TrimPrefix(line, "new mode ")
+	case strings.HasPrefix(line, "rename from "):
+		p.Type = PatchRenamed
+		p.OldPath = unquotePath(strings.TrimPrefix(line, "rename from "))
+	case strings.HasPrefix(line, "rename to "):
+		p.NewPath = unquotePath(strings.TrimPrefix(line, "rename to "))
+	case strings.HasPrefix(line, "copy from "):
+		p.Type = PatchCopied
+		p.OldPath = unquotePath(strings.TrimPrefix(line, "copy from "))
+	case strings.HasPrefix(line, "copy to "):
+		p.NewPath = unquotePath(strings.TrimPrefix(line, "copy to "))
+	case strings.HasPrefix(line, "similarity index "):
+		p.Similarity, _ = strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(line, "similarity index "), "%"))
+	case strings.HasPrefix(line, "index "):
+		// index <old>..<new> <mode>, where the mode is only given when unchanged
+		if fields := strings.Fields(line); len(fields) == 3 {
+			p.OldMode, p.Mode = fields[2], fields[2]
+		}
+	case strings.HasPrefix(line, "--- "):
+		p.OldPath = headerPath(strings.TrimPrefix(line, "--- "), "a/")
+	case strings.HasPrefix(line, "+++ "):
+		p.NewPath = headerPath(strings.TrimPrefix(line, "+++ "), "b/")
+	case strings.HasPrefix(line, "Binary files "), line == "GIT binary patch":
+		p.IsBinary = true
+	}
+}
+
+// finishPatch settles a patch's file and type once its header is read
+func finishPatch(p FilePatch) FilePatch {
+	switch p.Type {
+	case PatchAdded:
+		p.OldPath = ""
+	case PatchDeleted:
+		p.NewPath = ""
+	case "":
+		p.Type = PatchModified
+		if p.IsBinary {
+			p.Type = PatchBinary
+		}
+	}
+
+	p.File = p.NewPath
+	if p.File == "" {
+		p.File = p.OldPath
+	}
+	return p
+}
+
+// headerPath reads the path of a ---/+++ line. Git ends unquoted paths that
+// contain spaces with a tab, and uses /dev/null for a missing side.
+func headerPath(s, prefix string) string {
+	s = strings.TrimSuffix(s, "\t")
+	if s == "/dev/null" {
+		return ""
+	}
+	return strings.TrimPrefix(unquotePath(s), prefix)
+}
+
+// parseDiffGitPaths reads the old and new paths from the rest of a
+// diff --git line. Unquoted paths containing spaces are ambiguous there;
+// they are split only when both sides name the same file or there is a
+// single place to split, and otherwise left to the header lines that follow.
+func parseDiffGitPaths(s string) (string, string) {
+	var oldPath, newPath string
+	switch {
+	case strings.HasPrefix(s, `"`):
+		end := closingQuote(s)
+		if end < 0 {
+			return "", ""
+		}
+		oldPath = unquotePath(s[:end+1])
+		newPath = unquotePath(strings.TrimPrefix(s[end+1:], " "))
+	case strings.HasSuffix(s, `"`):
+		// Unquoted paths never contain quotes, so this is where the new one starts
+		i := strings.Index(s, ` "`)
+		if i < 0 {
+			return "", ""
+		}
+		oldPath, newPath = s[:i], unquotePath(s[i+1:])
+	default:
+		// "a/<path> b/<path>" splits in the middle when both paths match
+		if n := (len(s) - 1) / 2; len(s) > 5 && len(s)%2 == 1 && s[n:n+3] == " b/" && s[2:n] == s[n+3:] {
+			oldPath, newPath = s[:n], s[n+1:]
+		} else if strings.Count(s, " b/") == 1 {
+			i := strings.Index(s, " b/")
+			oldPath, newPath = s[:i], s[i+1:]
+		} else {
+			return "", ""
+		}
+	}
+	return strings.TrimPrefix(oldPath, "a/"), strings.TrimPrefix(newPath, "b/")
+}
+
+// closingQuote returns the index of the quote ending the quoted string at
+// the start of s, or -1
+func closingQuote(s string) int {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return -1
+}
+
+// unquotePath undoes git's C-style quoting of paths with special or
+// non-ASCII characters, which escapes them as \t, \" or octal bytes
+func unquotePath(s string) string {
+	if len(s) < 2 || s[0] != '"' || s[len(s)-1] != '"' {
+		return s
+	}
+	if unquoted, err := strconv.Unquote(s); err == nil {
+		return unquoted
+	}
+	return s
+}
@@ -0,0 +1,82 @@
+package git
+
+import "testing"
+
+const headerDiff = `diff --git a/bin.dat b/bin.dat
+index 88768ef..3e3315e 100644
+Binary files a/bin.dat and b/bin.dat differ
+diff --git "a/\303\274n\303\257.txt" "b/copy \303\274.txt"
+similarity index 100%
+copy from "\303\274n\303\257.txt"
+copy to "copy \303\274.txt"
+diff --git a/old name.txt b/new name.txt
+similarity index 83%
+rename from old name.txt
+rename to new name.txt
+index 0fdf397..e0318ee 100644
+--- a/old name.txt	
++++ b/new name.txt	
+@@ -3,4 +3,4 @@ b
+ c
+ d
+ e
+-f
++F
+diff --git a/script.sh b/script.sh
+old mode 100644
+new mode 100755
+diff --git "a/tab\tfile" "b/tab\tfile"
+index c1b0730..137e751 100644
+--- "a/tab\tfile"
++++ "b/tab\tfile"
+@@ -1 +1 @@
+-x
+\ No newline at end of file
++xmore
+diff --git a/gone b/gone
+deleted file mode 100644
+index 587be6b..0000000
+--- a/gone
++++ /dev/null
+@@ -1 +0,0 @@
+-x
+diff --git a/a b/c b/a b/c
+new file mode 100755
+index 0000000..587be6b
+--- /dev/null
++++ b/a b/c	
+@@ -0,0 +1 @@
++x
+`
+
+func TestParseGitDiffHeaders(t *testing.T) {
+	patches := parseGitDiff(headerDiff)
+
+	expected := []FilePatch{
+		{File: "bin.dat", OldPath: "bin.dat", NewPath: "bin.dat", Type: PatchBinary, OldMode: "100644", Mode: "100644", IsBinary: true},
+		{File: "copy ü.txt", OldPath: "ünï.txt", NewPath: "copy ü.txt", Type: PatchCopied, Similarity: 100},
+		{File: "new name.txt", OldPath: "old name.txt", NewPath: "new name.txt", Type: PatchRenamed, OldMode: "100644", Mode: "100644", Similarity: 83},
+		{File: "script.sh", OldPath: "script.sh", NewPath: "script.sh", Type: PatchModified, OldMode: "100644", Mode: "100755"},
+		{File: "tab\tfile", OldPath: "tab\tfile", NewPath: "tab\tfile", Type: PatchModified, OldMode: "100644", Mode: "100644"},
+		{File: "gone", OldPath: "gone", Type: PatchDeleted, OldMode: "100644"},
+		{File: "a b/c", NewPath: "a b/c", Type: PatchAdded, Mode: "100755"},
+	}
+	if len(patches) != len(expected) {
+		t.Fatalf("Expected %d patches, got %d", len(expected), len(patches))
+	}
+
+	var joined string
+	for i, want := range expected {
+		got := patches[i]
+		joined += got.Content
+		got.Content = ""
+		if got.File != want.File || got.OldPath != want.OldPath || got.NewPath != want.NewPath ||
+			got.Type != want.Type || got.OldMode != want.OldMode || got.Mode != want.Mode ||
+			got.Similarity != want.Similarity || got.IsBinary != want.IsBinary {
+			t.Errorf("Patch %d: expected %+v, got %+v", i, want, got)
+		}
+	}
+	if joined != headerDiff {
+		t.Error("Expected patch contents to add up to the diff exactly")
+	}
+}
@@ -0,0 +1,214 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ErrPushRejected is returned when the remote refuses a push, including
+// when a force push finds the remote branch changed since it was last fetched
+var ErrPushRejected = errors.New("push rejected")
+
+// ErrUnknownRemote is returned for remotes the repository does not have
+var ErrUnknownRemote = errors.New("unknown remote")
+
+// Push outcomes
+const (
+	PushNew      = "new"
+	PushUpdated  = "updated"
+	PushForced   = "forced"
+	PushUpToDate = "up-to-date"
+)
+
+// PushOptions selects what Push sends where. Remote defaults to the
+// branch's upstream remote, or origin, and RemoteBranch to Branch.
+type PushOptions struct {
+	Remote       string
+	Branch       string
+	RemoteBranch string
+	// Force allows rewriting the remote branch, but only if it is still
+	// where it was when last fetched
+	Force bool
+}
+
+// PushResult describes a push. Old is empty when the remote branch was
+// created.
+type PushResult struct {
+	Remote       string `json:"remote"`
+	Branch       string `json:"branch"`
+	RemoteBranch string `json:"remoteBranch"`
+	Upstream     string `json:"upstream"`
+	Status       string `json:"status"`
+	Old          string `json:"old,omitempty"`
+	New          string `json:"new"`
+	// Reason is git's explanation when the push was rejected
+	Reason string `json:"reason,omitempty"`
+}
+
+// PatchFile is one commit exported by git format-patch
+type PatchFile struct {
+	Name    string `json:"name"`
+	Content string `json:"content"`
+}
+
+// Push pushes a branch to a remote and makes the remote branch its
+// upstream. Without Force only fast-forwards are allowed; with it the push
+// is a force-with-lease against the remote-tracking branch, so work pushed
+// by someone else since the last fetch is never overwritten.
+func (g *GitProvider) Push(ctx context.Context, repo string, opts PushOptions) (PushResult, error) {
+	if opts.Branch == "" {
+		return PushResult{}, errors.New("branch required")
+	}
+	if opts.RemoteBranch == "" {
+		opts.RemoteBranch = opts.Branch
+	}
+	for _, name := range []string{opts.Branch, opts.RemoteBranch} {
+		if _, err := runGit(ctx, repo, "check-ref-format", "--branch", name); err != nil || strings.HasPrefix(name, "-") {
+			return PushResult{}, fmt.Errorf("invalid branch %q", name)
+		}
+	}
+
+	if opts.Remote == "" {
+		opts.Remote = "origin"
+		if remote, err := runGit(ctx, repo, "config", "--get", "branch."+opts.Branch+".remote"); err == nil && strings.TrimSpace(remote) != "." {
+			opts.Remote = strings.TrimSpace(remote)
+		}
+	}
+	remotes, err := runGit(ctx, repo, "remote")
+	if err != nil {
+		return PushResult{}, err
+	}
+	known := false
+	for _, remote := range strings.Fields(remotes) {
+		known = known || remote == opts.Remote
+	}
+	if !known {
+		return PushResult{}, fmt.Errorf("%w %q", ErrUnknownRemote, opts.Remote)
+	}
+
+	result := PushResult{
+		Remote:       opts.Remote,
+		Branch:       opts.Branch,
+		RemoteBranch: opts.RemoteBranch,
+		Upstream:     opts.Remote + "/" + opts.RemoteBranch,
+	}
+
+	local := "refs/heads/" + opts.Branch
+	tip, err := runGit(ctx, repo, "rev-parse", "--verify", "--quiet", local+"^{commit}")
+	if err != nil {
+		return result, fmt.Errorf("unknown branch %q", opts.Branch)
+	}
+	result.New = strings.TrimSpace(tip)
+
+	remoteRef := "refs/heads/" + opts.RemoteBranch
+	args := []string{"push", "--porcelain", "--set-upstream"}
+	if opts.Force {
+		// The lease is the remote-tracking branch; without one the remote
+		// branch must not exist yet
+		expected, _ := runGit(ctx, repo, "rev-parse", "--verify", "--quiet", "refs/remotes/"+result.Upstream)
+		args = append(args, "--force-with-lease="+remoteRef+":"+strings.TrimSpace(expected))
+	}
+	args = append(args, opts.Remote, local+":"+remoteRef)
+
+	// Never wait on a credential prompt nobody can answer
+	out, err := runGitWith(ctx, repo, []string{"GIT_TERMINAL_PROMPT=0"}, "", args...)
+	flag, summary, reason, found := parsePushStatus(out, remoteRef)
+	if !found {
+		if err != nil {
+			return result, err
+		}
+		return result, errors.New("push reported no result")
+	}
+
+	switch flag {
+	case "!":
+		result.Reason = reason
+		return result, fmt.Errorf("%w: %s", ErrPushRejected, reason)
+	case "*":
+		result.Status = PushNew
+	case "+":
+		result.Status = PushForced
+	case "=":
+		result.Status = PushUpToDate
+	default:
+		result.Status = PushUpdated
+	}
+	if old, _, ok := strings.Cut(summary, ".."); ok {
+		result.Old = strings.TrimRight(old, ".")
+	}
+	if err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
+
+// parsePushStatus finds the line for remoteRef in git push --porcelain
+// output, "<flag>\t<from>:<to>\t<summary> (<reason>)", and splits it up
+func parsePushStatus(out, remoteRef string) (string, string, string, bool) {
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.SplitN(line, "\t", 3)
+		if len(fields) != 3 || !strings.HasSuffix(fields[1], ":"+remoteRef) {
+			continue
+		}
+
+		summary, reason := fields[2], ""
+		if i := strings.Index(summary, " ("); i >= 0 && strings.HasSuffix(summary, ")") {
+			summary, reason = summary[:i], summary[i+2:len(summary)-1]
+		}
+		return fields[0], summary, reason, true
+	}
+	return "", "", "", false
+}
+
+// FormatPatch exports commits, oldest first, as git format-patch files
+// numbered as one series
+func (g *GitProvider) FormatPatch(ctx context.Context, repo string, commits []string) ([]PatchFile, error) {
+	if len(commits) == 0 {
+		return nil, errors.New("no commits to export")
+	}
+	for _, commit := range commits {
+		if strings.HasPrefix(commit, "-") {
+			return nil, fmt.Errorf("invalid commit %q", commit)
+		}
+	}
+	if err := verifyCommit(ctx, repo, commits...); err != nil {
+		return nil, err
+	}
+
+	tmp, err := os.MkdirTemp("", "cockpit-format-patch-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+
+	// format-patch numbers the commits it is given from last to first
+	args := []string{"format-patch", "--quiet", "--no-color", "--no-walk=unsorted", "-o", tmp}
+	for i := len(commits) - 1; i >= 0; i-- {
+		args = append(args, commits[i])
+	}
+	if _, err := runGit(ctx, repo, args...); err != nil {
+		return nil, err
+	}
+
+	names, err := filepath.Glob(filepath.Join(tmp, "*.patch"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+
+	files := make([]PatchFile, 0, len(names))
+	for _, name := range names {
+		content, err := os.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, PatchFile{Name: filepath.Base(name), Content: string(content)})
+	}
+	return files, nil
+}
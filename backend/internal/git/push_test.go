@@ -0,0 +1,82 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPush(t *testing.T) {
+	ctx := context.Background()
+	dir := initRepo(t)
+	g := NewProvider()
+
+	remote := filepath.Join(t.TempDir(), "remote.git")
+	gitCmd(t, dir, "init", "-q", "--bare", remote)
+	gitCmd(t, dir, "remote", "add", "origin", remote)
+	gitCmd(t, dir, "checkout", "-q", "-b", "task")
+	first := commitFile(t, dir, "a.txt", "a\n")
+
+	result, err := g.Push(ctx, dir, PushOptions{Branch: "task"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Status != PushNew || result.New != first || result.Upstream != "origin/task" {
+		t.Errorf("Unexpected result %+v", result)
+	}
+	if upstream := strings.TrimSpace(gitCmd(t, dir, "rev-parse", "--abbrev-ref", "task@{upstream}")); upstream != "origin/task" {
+		t.Errorf("Expected origin/task as upstream, got %q", upstream)
+	}
+
+	// Someone else pushes to the branch
+	clone := filepath.Join(t.TempDir(), "clone")
+	gitCmd(t, dir, "clone", "-q", "-b", "task", remote, clone)
+	theirs := commitFile(t, clone, "b.txt", "b\n")
+	gitCmd(t, clone, "push", "-q", "origin", "task")
+
+	gitCmd(t, dir, "reset", "-q", "--hard", "HEAD~1")
+	ours := commitFile(t, dir, "c.txt", "c\n")
+
+	if _, err := g.Push(ctx, dir, PushOptions{Branch: "task"}); !errors.Is(err, ErrPushRejected) {
+		t.Fatalf("Expected a non-fast-forward push to be rejected, got %v", err)
+	}
+	result, err = g.Push(ctx, dir, PushOptions{Branch: "task", Force: true})
+	if !errors.Is(err, ErrPushRejected) || result.Reason != "stale info" {
+		t.Fatalf("Expected the lease to protect the unseen commit, got %v %+v", err, result)
+	}
+
+	gitCmd(t, dir, "fetch", "-q", "origin")
+	result, err = g.Push(ctx, dir, PushOptions{Branch: "task", Force: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Status != PushForced || result.New != ours || !strings.HasPrefix(theirs, result.Old) {
+		t.Errorf("Unexpected forced push %+v", result)
+	}
+
+	if _, err := g.Push(ctx, dir, PushOptions{Remote: "nope", Branch: "task"}); !errors.Is(err, ErrUnknownRemote) {
+		t.Errorf("Expected an unknown remote to be refused, got %v", err)
+	}
+}
+
+func TestFormatPatch(t *testing.T) {
+	ctx := context.Background()
+	dir := initRepo(t)
+
+	first := commitFile(t, dir, "a.txt", "a\n")
+	commitFile(t, dir, "other.txt", "unrelated\n")
+	third := commitFile(t, dir, "b.txt", "b\n")
+
+	files, err := NewProvider().FormatPatch(ctx, dir, []string{first, third})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 || files[0].Name != "0001-Change-a.txt.patch" || files[1].Name != "0002-Change-b.txt.patch" {
+		t.Fatalf("Unexpected files %+v", files)
+	}
+	if !strings.HasPrefix(files[0].Content, "From "+first) || !strings.Contains(files[1].Content, "Subject: [PATCH 2/2] Change b.txt") {
+		t.Errorf("Unexpected patch:\n%s", files[0].Content)
+	}
+}
@@ -0,0 +1,95 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrNotWorkTree is returned for paths that are not inside a git work tree
+var ErrNotWorkTree = errors.New("not a git work tree")
+
+// Commit summarizes a commit
+type Commit struct {
+	SHA     string    `json:"sha"`
+	Subject string    `json:"subject"`
+	Author  string    `json:"author"`
+	Date    time.Time `json:"date"`
+}
+
+// RepoInfo describes the state of a repository's work tree
+type RepoInfo struct {
+	Name       string   `json:"name"`
+	Path       string   `json:"path"`
+	Branch     string   `json:"branch"`
+	Detached   bool     `json:"detached"`
+	Dirty      bool     `json:"dirty"`
+	LastCommit *Commit  `json:"lastCommit,omitempty"`
+	Remotes    []string `json:"remotes"`
+}
+
+// WorkTreeRoot returns the top level of the work tree containing path
+func WorkTreeRoot(ctx context.Context, path string) (string, error) {
+	out, err := runGit(ctx, path, "rev-parse", "--is-inside-work-tree", "--show-toplevel")
+	if err != nil {
+		return "", ErrNotWorkTree
+	}
+
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 2 || lines[0] != "true" {
+		return "", ErrNotWorkTree
+	}
+	return lines[1], nil
+}
+
+// Inspect reports the branch, dirty state, last commit and remotes of the
+// repository at path
+func Inspect(ctx context.Context, path string) (RepoInfo, error) {
+	root, err := WorkTreeRoot(ctx, path)
+	if err != nil {
+		return RepoInfo{}, err
+	}
+
+	info := RepoInfo{
+		Name:    filepath.Base(root),
+		Path:    root,
+		Remotes: []string{},
+	}
+
+	if branch, err := runGit(ctx, root, "symbolic-ref", "--quiet", "--short", "HEAD"); err == nil {
+		info.Branch = strings.TrimSpace(branch)
+	} else {
+		info.Detached = true
+	}
+
+	status, err := runGit(ctx, root, "status", "--porcelain")
+	if err != nil {
+		return RepoInfo{}, err
+	}
+	info.Dirty = strings.TrimSpace(status) != ""
+
+	// A repository without commits yet has no last commit
+	if out, err := runGit(ctx, root, "log", "-1", "--format=%H%x00%s%x00%an%x00%cI"); err == nil {
+		if fields := strings.Split(strings.TrimSpace(out), "\x00"); len(fields) == 4 {
+			date, _ := time.Parse(time.RFC3339, fields[3])
+			info.LastCommit = &Commit{
+				SHA:     fields[0],
+				Subject: fields[1],
+				Author:  fields[2],
+				Date:    date,
+			}
+		}
+	}
+
+	remotes, err := runGit(ctx, root, "remote")
+	if err != nil {
+		return RepoInfo{}, err
+	}
+	for _, remote := range strings.Fields(remotes) {
+		info.Remotes = append(info.Remotes, remote)
+	}
+
+	return info, nil
+}
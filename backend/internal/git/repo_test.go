@@ -0,0 +1,66 @@
+package git
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// initRepo creates a repository with one commit in a temp dir
+func initRepo(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	gitCmd(t, dir, "init", "-q", "-b", "main")
+	if err := os.WriteFile(filepath.Join(dir, "README.md"), []byte("hello\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	gitCmd(t, dir, "add", ".")
+	gitCmd(t, dir, "commit", "-q", "-m", "Initial commit")
+	return dir
+}
+
+func gitCmd(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=Test", "GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=Test", "GIT_COMMITTER_EMAIL=test@example.com",
+	)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v: %v\n%s", args, err, out)
+	}
+	return string(out)
+}
+
+func TestInspect(t *testing.T) {
+	ctx := context.Background()
+	dir := initRepo(t)
+	gitCmd(t, dir, "remote", "add", "origin", "https://example.com/repo.git")
+
+	info, err := Inspect(ctx, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Branch != "main" || info.Detached || info.Dirty {
+		t.Errorf("Unexpected state: %+v", info)
+	}
+	if info.LastCommit == nil || info.LastCommit.Subject != "Initial commit" || len(info.LastCommit.SHA) != 40 {
+		t.Errorf("Unexpected last commit: %+v", info.LastCommit)
+	}
+	if len(info.Remotes) != 1 || info.Remotes[0] != "origin" {
+		t.Errorf("Unexpected remotes: %v", info.Remotes)
+	}
+
+	os.WriteFile(filepath.Join(dir, "new.txt"), []byte("x"), 0o644)
+	if info, _ := Inspect(ctx, dir); !info.Dirty {
+		t.Error("Expected untracked file to make the repo dirty")
+	}
+
+	if _, err := Inspect(ctx, t.TempDir()); err != ErrNotWorkTree {
+		t.Errorf("Expected ErrNotWorkTree, got %v", err)
+	}
+}
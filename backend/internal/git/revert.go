@@ -0,0 +1,214 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Revert modes
+const (
+	// RevertCommit adds a commit undoing the changes
+	RevertCommit = "revert"
+	// RevertReset moves the branch back to before the commits
+	RevertReset = "reset"
+)
+
+// ErrDirtyWorkTree is returned when the work tree that has the branch checked
+// out has local changes
+var ErrDirtyWorkTree = errors.New("work tree has local changes")
+
+// ErrLaterCommits is returned when commits made after the ones being undone
+// stand in the way
+var ErrLaterCommits = errors.New("later commits depend on these changes")
+
+// RevertResult describes how a branch was rolled back
+type RevertResult struct {
+	Mode   string `json:"mode"`
+	Branch string `json:"branch"`
+	// Commit is the new revert commit; a reset makes none
+	Commit   string   `json:"commit,omitempty"`
+	Head     string   `json:"head"`
+	Previous string   `json:"previous"`
+	Files    []string `json:"files"`
+	// Blocking lists the later commits that prevented the revert
+	Blocking []string `json:"blocking,omitempty"`
+}
+
+// Revert undoes commits on branch, oldest first in commits. RevertCommit adds
+// a commit restoring the files they touched, and is refused when later
+// commits on the branch touch the same files. RevertReset moves the branch
+// back to the parent of the oldest commit, and is refused when anything else
+// has been committed since. Both are refused when the branch is checked out
+// in a work tree with local changes; otherwise that work tree is updated.
+func (g *GitProvider) Revert(ctx context.Context, repo, branch string, commits []string, mode, commitMsg string) (RevertResult, error) {
+	if mode != RevertCommit && mode != RevertReset {
+		return RevertResult{}, fmt.Errorf("unknown revert mode %q", mode)
+	}
+	if len(commits) == 0 {
+		return RevertResult{}, errors.New("no commits to revert")
+	}
+
+	repo, err := WorkTreeRoot(ctx, repo)
+	if err != nil {
+		return RevertResult{}, err
+	}
+	if _, err := runGit(ctx, repo, "check-ref-format", "--branch", branch); err != nil || strings.HasPrefix(branch, "-") {
+		return RevertResult{}, fmt.Errorf("invalid branch %q", branch)
+	}
+	ref := "refs/heads/" + branch
+
+	tip, err := runGit(ctx, repo, "rev-parse", "--verify", "--quiet", ref+"^{commit}")
+	if err != nil {
+		return RevertResult{}, fmt.Errorf("unknown branch %q", branch)
+	}
+	tip = strings.TrimSpace(tip)
+	result := RevertResult{Mode: mode, Branch: branch, Previous: tip}
+
+	own := make(map[string]bool, len(commits))
+	for _, commit := range commits {
+		if strings.HasPrefix(commit, "-") {
+			return result, fmt.Errorf("invalid commit %q", commit)
+		}
+		if _, err := runGit(ctx, repo, "merge-base", "--is-ancestor", commit, tip); err != nil {
+			return result, fmt.Errorf("%w: %s is no longer on %s", ErrBranchMoved, commit, branch)
+		}
+		own[commit] = true
+	}
+
+	result.Files, err = changedFiles(ctx, repo, commits)
+	if err != nil {
+		return result, err
+	}
+
+	// Anything committed on top must leave the reverted files alone, or for
+	// a reset not exist at all
+	base := commits[0] + "^"
+	args := []string{"rev-list", base + ".." + tip}
+	if mode == RevertCommit {
+		args = append(append(args, "--"), result.Files...)
+	}
+	later, err := runGit(ctx, repo, args...)
+	if err != nil {
+		return result, err
+	}
+	for _, commit := range strings.Fields(later) {
+		if !own[commit] {
+			result.Blocking = append(result.Blocking, commit)
+		}
+	}
+	if len(result.Blocking) > 0 {
+		return result, ErrLaterCommits
+	}
+
+	worktree := checkedOutAt(ctx, repo, ref)
+	if worktree != "" {
+		status, err := runGit(ctx, worktree, "status", "--porcelain", "--untracked-files=no")
+		if err != nil {
+			return result, err
+		}
+		if strings.TrimSpace(status) != "" {
+			return result, ErrDirtyWorkTree
+		}
+	}
+
+	var head string
+	if mode == RevertReset {
+		head, err = runGit(ctx, repo, "rev-parse", "--verify", "--quiet", base+"^{commit}")
+		if err != nil {
+			return result, fmt.Errorf("%s has no parent to reset to", commits[0])
+		}
+		head = strings.TrimSpace(head)
+	} else {
+		head, err = revertCommit(ctx, repo, tip, commits, commitMsg)
+		if err != nil {
+			return result, err
+		}
+		result.Commit = head
+	}
+
+	if _, err := runGit(ctx, repo, "update-ref", "-m", "cockpit: "+mode, ref, head, tip); err != nil {
+		return result, ErrBranchMoved
+	}
+	result.Head = head
+
+	// The work tree was clean, so it can simply follow the branch
+	if worktree != "" {
+		runGit(ctx, worktree, "reset", "-q", "--hard")
+	}
+
+	return result, nil
+}
+
+// revertCommit makes a commit on top of tip that reverses commits, newest
+// first, using a temporary index so no work tree is touched
+func revertCommit(ctx context.Context, repo, tip string, commits []string, commitMsg string) (string, error) {
+	tmp, err := os.MkdirTemp("", "cockpit-revert-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmp)
+	env := []string{"GIT_INDEX_FILE=" + filepath.Join(tmp, "index")}
+
+	if _, err := runGitWith(ctx, repo, env, "", "read-tree", tip); err != nil {
+		return "", err
+	}
+	for i := len(commits) - 1; i >= 0; i-- {
+		patch, err := runGit(ctx, repo, "diff", "--binary", "--full-index", "--no-color", "--no-ext-diff", commits[i]+"^", commits[i])
+		if err != nil {
+			return "", err
+		}
+		if patch == "" {
+			continue
+		}
+		if _, err := runGitWith(ctx, repo, env, patch, "apply", "--cached", "-R", "-"); err != nil {
+			return "", fmt.Errorf("%w: %v", ErrLaterCommits, err)
+		}
+	}
+
+	tree, err := runGitWith(ctx, repo, env, "", "write-tree")
+	if err != nil {
+		return "", err
+	}
+
+	if strings.TrimSpace(commitMsg) == "" {
+		commitMsg = "Revert changes"
+	}
+	noun := "commit"
+	if len(commits) > 1 {
+		noun = "commits"
+	}
+	commitMsg = fmt.Sprintf("%s\n\nThis reverts %s %s.\n", strings.TrimRight(commitMsg, "\n"), noun, strings.Join(commits, ", "))
+	commit, err := runGitWith(ctx, repo, nil, commitMsg, "commit-tree", strings.TrimSpace(tree), "-p", tip)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(commit), nil
+}
+
+// changedFiles returns the sorted paths touched by commits
+func changedFiles(ctx context.Context, repo string, commits []string) ([]string, error) {
+	seen := make(map[string]bool)
+	for _, commit := range commits {
+		out, err := runGit(ctx, repo, "diff-tree", "-r", "--no-commit-id", "--name-only", "-z", "--root", commit)
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range strings.Split(out, "\x00") {
+			if path != "" {
+				seen[path] = true
+			}
+		}
+	}
+
+	files := make([]string, 0, len(seen))
+	for path := range seen {
+		files = append(files, path)
+	}
+	sort.Strings(files)
+	return files, nil
+}
@@ -0,0 +1,97 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// commitFile writes a file in dir and commits it, returning the commit SHA
+func commitFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	gitCmd(t, dir, "add", name)
+	gitCmd(t, dir, "commit", "-q", "-m", "Change "+name)
+	return strings.TrimSpace(gitCmd(t, dir, "rev-parse", "HEAD"))
+}
+
+func TestRevertCommit(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("GIT_AUTHOR_NAME", "Test")
+	t.Setenv("GIT_AUTHOR_EMAIL", "test@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "Test")
+	t.Setenv("GIT_COMMITTER_EMAIL", "test@example.com")
+	dir := initRepo(t)
+	g := NewProvider()
+
+	applied := commitFile(t, dir, "README.md", "hello\napplied\n")
+	later := commitFile(t, dir, "other.txt", "other\n")
+
+	if _, err := g.Revert(ctx, dir, "main", []string{applied}, RevertReset, ""); !errors.Is(err, ErrLaterCommits) {
+		t.Fatalf("Expected a reset under a later commit to be refused, got %v", err)
+	}
+
+	os.WriteFile(filepath.Join(dir, "README.md"), []byte("local\n"), 0o644)
+	if _, err := g.Revert(ctx, dir, "main", []string{applied}, RevertCommit, ""); !errors.Is(err, ErrDirtyWorkTree) {
+		t.Fatalf("Expected a dirty work tree to be refused, got %v", err)
+	}
+	gitCmd(t, dir, "checkout", "--", "README.md")
+
+	result, err := g.Revert(ctx, dir, "main", []string{applied}, RevertCommit, "Undo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Previous != later || result.Commit == "" || result.Head != result.Commit {
+		t.Errorf("Unexpected result: %+v", result)
+	}
+	if len(result.Files) != 1 || result.Files[0] != "README.md" {
+		t.Errorf("Expected README.md to be reverted, got %v", result.Files)
+	}
+	if readme, _ := os.ReadFile(filepath.Join(dir, "README.md")); string(readme) != "hello\n" {
+		t.Errorf("Expected the checked-out README to be restored, got %q", readme)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "other.txt")); err != nil {
+		t.Errorf("Expected the later commit to be kept: %v", err)
+	}
+	if msg := gitCmd(t, dir, "log", "-1", "--format=%B"); !strings.Contains(msg, "This reverts commit "+applied) {
+		t.Errorf("Unexpected message: %q", msg)
+	}
+
+	commitFile(t, dir, "README.md", "hello\nagain\n")
+	result, err = g.Revert(ctx, dir, "main", []string{applied}, RevertCommit, "")
+	if !errors.Is(err, ErrLaterCommits) || len(result.Blocking) != 2 {
+		t.Errorf("Expected later changes to README.md to block the revert, got %v %+v", err, result)
+	}
+}
+
+func TestRevertReset(t *testing.T) {
+	ctx := context.Background()
+	dir := initRepo(t)
+	g := NewProvider()
+
+	base := strings.TrimSpace(gitCmd(t, dir, "rev-parse", "HEAD"))
+	gitCmd(t, dir, "checkout", "-q", "-b", "task")
+	first := commitFile(t, dir, "a.txt", "a\n")
+	second := commitFile(t, dir, "b.txt", "b\n")
+	gitCmd(t, dir, "checkout", "-q", "main")
+
+	result, err := g.Revert(ctx, dir, "task", []string{first, second}, RevertReset, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Head != base || result.Commit != "" || result.Previous != second {
+		t.Errorf("Unexpected result: %+v", result)
+	}
+	if tip := strings.TrimSpace(gitCmd(t, dir, "rev-parse", "task")); tip != base {
+		t.Errorf("Expected task to be reset to %s, got %s", base, tip)
+	}
+
+	if _, err := g.Revert(ctx, dir, "task", []string{first}, RevertReset, ""); !errors.Is(err, ErrBranchMoved) {
+		t.Errorf("Expected commits no longer on the branch to be refused, got %v", err)
+	}
+}
@@ -0,0 +1,125 @@
+package git
+
+import (
+	"context"
+	"strconv"
+	"strings"
+)
+
+// Kinds of status entries, following git's porcelain v2 record types
+const (
+	StatusChanged   = "changed"
+	StatusRenamed   = "renamed"
+	StatusUnmerged  = "unmerged"
+	StatusUntracked = "untracked"
+)
+
+// StatusFile is one changed path in a work tree. Index and WorkTree are
+// git's status letters for the staged and unstaged sides, "." when a side is
+// unchanged.
+type StatusFile struct {
+	Path     string `json:"path"`
+	OrigPath string `json:"origPath,omitempty"`
+	Kind     string `json:"kind"`
+	Index    string `json:"index"`
+	WorkTree string `json:"workTree"`
+}
+
+// Status describes the branch and changes of a work tree
+type Status struct {
+	Branch   string `json:"branch"`
+	Detached bool   `json:"detached"`
+	// Head is empty until the first commit
+	Head     string       `json:"head"`
+	Upstream string       `json:"upstream,omitempty"`
+	Ahead    int          `json:"ahead"`
+	Behind   int          `json:"behind"`
+	Files    []StatusFile `json:"files"`
+}
+
+// Status reports the branch, upstream divergence and changed files of the
+// work tree at repo
+func (g *GitProvider) Status(ctx context.Context, repo string) (Status, error) {
+	out, err := runGit(ctx, repo, "status", "--porcelain=v2", "--branch", "-z", "--untracked-files=all")
+	if err != nil {
+		return Status{}, err
+	}
+	return parseStatus(out), nil
+}
+
+// parseStatus reads git status --porcelain=v2 --branch -z output
+func parseStatus(out string) Status {
+	status := Status{Files: []StatusFile{}}
+
+	entries := strings.Split(out, "\x00")
+	for i := 0; i < len(entries); i++ {
+		entry := entries[i]
+		if entry == "" {
+			continue
+		}
+
+		switch entry[0] {
+		case '#':
+			parseStatusHeader(&status, entry)
+		case '1':
+			// 1 XY sub mH mI mW hH hI path
+			if fields := strings.SplitN(entry, " ", 9); len(fields) == 9 {
+				status.Files = append(status.Files, statusFile(StatusChanged, fields[1], fields[8]))
+			}
+		case '2':
+			// 2 XY sub mH mI mW hH hI Xscore path, then the original path
+			if fields := strings.SplitN(entry, " ", 10); len(fields) == 10 {
+				file := statusFile(StatusRenamed, fields[1], fields[9])
+				if i+1 < len(entries) {
+					i++
+					file.OrigPath = entries[i]
+				}
+				status.Files = append(status.Files, file)
+			}
+		case 'u':
+			// u XY sub m1 m2 m3 mW h1 h2 h3 path
+			if fields := strings.SplitN(entry, " ", 11); len(fields) == 11 {
+				status.Files = append(status.Files, statusFile(StatusUnmerged, fields[1], fields[10]))
+			}
+		case '?':
+			status.Files = append(status.Files, StatusFile{Path: entry[2:], Kind: StatusUntracked, Index: "?", WorkTree: "?"})
+		}
+	}
+
+	return status
+}
+
+func parseStatusHeader(status *Status, line string) {
+	fields := strings.Fields(line)
+	if len(fields) < 3 {
+		return
+	}
+
+	switch fields[1] {
+	case "branch.oid":
+		if fields[2] != "(initial)" {
+			status.Head = fields[2]
+		}
+	case "branch.head":
+		if fields[2] == "(detached)" {
+			status.Detached = true
+		} else {
+			status.Branch = fields[2]
+		}
+	case "branch.upstream":
+		status.Upstream = fields[2]
+	case "branch.ab":
+		if len(fields) == 4 {
+			status.Ahead, _ = strconv.Atoi(strings.TrimPrefix(fields[2], "+"))
+			status.Behind, _ = strconv.Atoi(strings.TrimPrefix(fields[3], "-"))
+		}
+	}
+}
+
+func statusFile(kind, xy, path string) StatusFile {
+	file := StatusFile{Path: path, Kind: kind, Index: ".", WorkTree: "."}
+	if len(xy) == 2 {
+		file.Index, file.WorkTree = xy[:1], xy[1:]
+	}
+	return file
+}
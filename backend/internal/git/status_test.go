@@ -0,0 +1,77 @@
+package git
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseStatus(t *testing.T) {
+	out := "# branch.oid 1234\x00# branch.head main\x00# branch.upstream origin/main\x00# branch.ab +2 -1\x00" +
+		"1 .M N... 100644 100644 100644 aaa aaa has space.txt\x00" +
+		"2 R. N... 100644 100644 100644 aaa aaa R100 new.txt\x00old.txt\x00" +
+		"u UU N... 100644 100644 100644 100644 aaa bbb ccc both.txt\x00" +
+		"? untracked.txt\x00"
+
+	status := parseStatus(out)
+	if status.Branch != "main" || status.Head != "1234" || status.Upstream != "origin/main" || status.Ahead != 2 || status.Behind != 1 {
+		t.Errorf("Unexpected branch state: %+v", status)
+	}
+
+	expected := []StatusFile{
+		{Path: "has space.txt", Kind: StatusChanged, Index: ".", WorkTree: "M"},
+		{Path: "new.txt", OrigPath: "old.txt", Kind: StatusRenamed, Index: "R", WorkTree: "."},
+		{Path: "both.txt", Kind: StatusUnmerged, Index: "U", WorkTree: "U"},
+		{Path: "untracked.txt", Kind: StatusUntracked, Index: "?", WorkTree: "?"},
+	}
+	if len(status.Files) != len(expected) {
+		t.Fatalf("Expected %d files, got %+v", len(expected), status.Files)
+	}
+	for i, want := range expected {
+		if status.Files[i] != want {
+			t.Errorf("File %d: expected %+v, got %+v", i, want, status.Files[i])
+		}
+	}
+}
+
+func TestStatusAndBranches(t *testing.T) {
+	ctx := context.Background()
+	dir := initRepo(t)
+	g := NewProvider()
+
+	// A clone tracking dir gives the branch an upstream to compare with
+	clone := filepath.Join(t.TempDir(), "clone")
+	gitCmd(t, dir, "clone", "-q", dir, clone)
+	commitFile(t, clone, "local.txt", "local\n")
+	os.WriteFile(filepath.Join(clone, "README.md"), []byte("changed\n"), 0o644)
+
+	status, err := g.Status(ctx, clone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Branch != "main" || status.Upstream != "origin/main" || status.Ahead != 1 || status.Behind != 0 {
+		t.Errorf("Unexpected status: %+v", status)
+	}
+	if len(status.Files) != 1 || status.Files[0].Path != "README.md" || status.Files[0].WorkTree != "M" {
+		t.Errorf("Expected README.md to be modified, got %+v", status.Files)
+	}
+
+	branches, err := g.Branches(ctx, clone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(branches) != 2 {
+		t.Fatalf("Expected main and origin/main, got %+v", branches)
+	}
+	local, remote := branches[0], branches[1]
+	if local.Name != "main" || !local.Current || local.Remote || local.Upstream != "origin/main" || local.Ahead != 1 {
+		t.Errorf("Unexpected local branch: %+v", local)
+	}
+	if local.LastCommit.Subject != "Change local.txt" {
+		t.Errorf("Unexpected last commit: %+v", local.LastCommit)
+	}
+	if remote.Name != "origin/main" || !remote.Remote || remote.Current || remote.LastCommit.Subject != "Initial commit" {
+		t.Errorf("Unexpected remote branch: %+v", remote)
+	}
+}
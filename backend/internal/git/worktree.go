@@ -0,0 +1,302 @@
+package git
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrDiskCap is returned when task worktrees already use their disk budget
+var ErrDiskCap = errors.New("worktree disk cap reached")
+
+// ErrNoWorktree is returned when a task has no worktree
+var ErrNoWorktree = errors.New("worktree not found")
+
+// Worktree is a checkout dedicated to one task, on its own branch
+type Worktree struct {
+	TaskID    string    `json:"taskId"`
+	SessionID string    `json:"sessionId"`
+	Repo      string    `json:"repo"`
+	Path      string    `json:"path"`
+	Branch    string    `json:"branch"`
+	Base      string    `json:"base"`
+	Commit    string    `json:"commit"` // the commit Base named when the worktree was created
+	CreatedAt time.Time `json:"createdAt"`
+	SizeBytes int64     `json:"sizeBytes"`
+}
+
+// WorktreeManager keeps a git worktree per task under one directory. Each
+// worktree is recorded next to it so it can be cleaned up after a restart.
+// Worktrees are removed when their task is applied or discarded, or once
+// they are older than the TTL and their task is done with them, and new ones
+// are refused while the existing ones use more than the disk cap.
+type WorktreeManager struct {
+	dir       string
+	maxBytes  int64
+	ttl       time.Duration
+	inUse     func(taskID string) bool
+	worktrees map[string]*Worktree
+	mu        sync.Mutex
+}
+
+// NewWorktreeManager creates a manager keeping worktrees under dir. A zero
+// maxBytes or ttl disables the cap or expiry. inUse reports whether a task
+// still needs its worktree; worktrees of other tasks, including ones this
+// process does not know, are expired, and those left by earlier runs are
+// removed at once. A nil inUse treats every task as done.
+func NewWorktreeManager(dir string, maxBytes int64, ttl time.Duration, inUse func(taskID string) bool) (*WorktreeManager, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create worktrees directory: %w", err)
+	}
+
+	m := &WorktreeManager{
+		dir:       dir,
+		maxBytes:  maxBytes,
+		ttl:       ttl,
+		inUse:     inUse,
+		worktrees: make(map[string]*Worktree),
+	}
+	m.load()
+
+	if ttl > 0 {
+		go m.expireLoop()
+	}
+
+	return m, nil
+}
+
+// Create adds a worktree for a task on a new branch starting at base, or at
+// HEAD when base is empty
+func (m *WorktreeManager) Create(ctx context.Context, repo, sessionID, taskID, base string) (Worktree, error) {
+	if strings.HasPrefix(base, "-") {
+		return Worktree{}, fmt.Errorf("invalid base %q", base)
+	}
+	if base == "" {
+		base = "HEAD"
+	}
+
+	root, err := WorkTreeRoot(ctx, repo)
+	if err != nil {
+		return Worktree{}, err
+	}
+	commit, err := runGit(ctx, root, "rev-parse", "--verify", "--quiet", base+"^{commit}")
+	if err != nil {
+		return Worktree{}, fmt.Errorf("unknown ref %q", base)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.worktrees[taskID]; exists {
+		return Worktree{}, fmt.Errorf("task %s already has a worktree", taskID)
+	}
+	if m.maxBytes > 0 && m.usageLocked() >= m.maxBytes {
+		return Worktree{}, ErrDiskCap
+	}
+
+	branch := taskBranch(ctx, root, taskID)
+	wt := &Worktree{
+		TaskID:    taskID,
+		SessionID: sessionID,
+		Repo:      root,
+		Path:      filepath.Join(m.dir, taskID),
+		Branch:    branch,
+		Base:      base,
+		Commit:    strings.TrimSpace(commit),
+		CreatedAt: time.Now(),
+	}
+
+	if _, err := runGit(ctx, root, "worktree", "add", "--quiet", "-b", branch, wt.Path, base); err != nil {
+		return Worktree{}, err
+	}
+
+	m.worktrees[taskID] = wt
+	m.saveLocked(wt)
+	return *wt, nil
+}
+
+// Get returns a task's worktree
+func (m *WorktreeManager) Get(taskID string) (Worktree, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	wt, exists := m.worktrees[taskID]
+	if !exists {
+		return Worktree{}, false
+	}
+	return *wt, true
+}
+
+// List returns a session's worktrees with their current size, oldest first
+func (m *WorktreeManager) List(sessionID string) []Worktree {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	list := make([]Worktree, 0)
+	for _, wt := range m.worktrees {
+		if wt.SessionID == sessionID {
+			wt.SizeBytes = dirSize(wt.Path)
+			list = append(list, *wt)
+		}
+	}
+
+	sort.Slice(list, func(i, k int) bool {
+		return list[i].CreatedAt.Before(list[k].CreatedAt)
+	})
+	return list
+}
+
+// Remove deletes a task's worktree. The branch is deleted too when
+// deleteBranch is set; otherwise it stays with whatever was committed on it.
+func (m *WorktreeManager) Remove(ctx context.Context, taskID string, deleteBranch bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	wt, exists := m.worktrees[taskID]
+	if !exists {
+		return ErrNoWorktree
+	}
+	return m.removeLocked(ctx, wt, deleteBranch)
+}
+
+func (m *WorktreeManager) removeLocked(ctx context.Context, wt *Worktree, deleteBranch bool) error {
+	if _, err := runGit(ctx, wt.Repo, "worktree", "remove", "--force", wt.Path); err != nil {
+		// The repository may be gone; the files still have to go
+		log.Printf("Failed to remove worktree %s: %v", wt.Path, err)
+		os.RemoveAll(wt.Path)
+		runGit(ctx, wt.Repo, "worktree", "prune")
+	}
+	if deleteBranch {
+		if _, err := runGit(ctx, wt.Repo, "branch", "-D", wt.Branch); err != nil {
+			log.Printf("Failed to delete branch %s: %v", wt.Branch, err)
+		}
+	}
+
+	delete(m.worktrees, wt.TaskID)
+	os.Remove(m.metaPath(wt.TaskID))
+	return nil
+}
+
+// usageLocked returns the disk space used by all worktrees
+func (m *WorktreeManager) usageLocked() int64 {
+	var total int64
+	for _, wt := range m.worktrees {
+		total += dirSize(wt.Path)
+	}
+	return total
+}
+
+// expireLoop periodically removes worktrees older than the TTL whose task is
+// done with them. Their branches are kept so committed work survives.
+func (m *WorktreeManager) expireLoop() {
+	interval := m.ttl / 4
+	if interval > time.Hour {
+		interval = time.Hour
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		m.expire()
+	}
+}
+
+func (m *WorktreeManager) expire() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, wt := range m.worktrees {
+		if time.Since(wt.CreatedAt) > m.ttl && !m.needed(wt.TaskID) {
+			log.Printf("Removing expired worktree for task %s", wt.TaskID)
+			m.removeLocked(context.Background(), wt, false)
+		}
+	}
+}
+
+// needed reports whether a task still needs its worktree
+func (m *WorktreeManager) needed(taskID string) bool {
+	return m.inUse != nil && m.inUse(taskID)
+}
+
+func (m *WorktreeManager) metaPath(taskID string) string {
+	return filepath.Join(m.dir, taskID+".json")
+}
+
+// saveLocked records a worktree; the caller holds m.mu
+func (m *WorktreeManager) saveLocked(wt *Worktree) {
+	data, err := json.Marshal(wt)
+	if err != nil {
+		return
+	}
+	if err := os.WriteFile(m.metaPath(wt.TaskID), data, 0o600); err != nil {
+		log.Printf("Failed to save worktree %s: %v", wt.TaskID, err)
+	}
+}
+
+// load restores the worktrees recorded by earlier runs whose tasks still
+// need them and removes the rest, keeping their branches, so orphans do not
+// count against the disk cap
+func (m *WorktreeManager) load() {
+	paths, err := filepath.Glob(filepath.Join(m.dir, "*.json"))
+	if err != nil {
+		return
+	}
+
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+
+		var wt Worktree
+		if err := json.Unmarshal(data, &wt); err != nil || wt.TaskID == "" {
+			continue
+		}
+		if !m.needed(wt.TaskID) {
+			log.Printf("Removing worktree of unknown task %s", wt.TaskID)
+			m.removeLocked(context.Background(), &wt, false)
+			continue
+		}
+		m.worktrees[wt.TaskID] = &wt
+	}
+}
+
+// taskBranch picks a branch name for a task that is not taken yet
+func taskBranch(ctx context.Context, repo, taskID string) string {
+	short := taskID
+	if len(short) > 8 {
+		short = short[:8]
+	}
+
+	branch := "cockpit/task-" + short
+	if _, err := runGit(ctx, repo, "rev-parse", "--verify", "--quiet", "refs/heads/"+branch); err == nil {
+		branch = "cockpit/task-" + taskID
+	}
+	return branch
+}
+
+// dirSize sums the sizes of the files under path
+func dirSize(path string) int64 {
+	var total int64
+	filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.Type().IsRegular() {
+			if info, err := d.Info(); err == nil {
+				total += info.Size()
+			}
+		}
+		return nil
+	})
+	return total
+}
@@ -0,0 +1,130 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWorktreeLifecycle(t *testing.T) {
+	ctx := context.Background()
+	repo := initRepo(t)
+	m, err := NewWorktreeManager(t.TempDir(), 0, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wt, err := m.Create(ctx, repo, "sess", "task1234abcd", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wt.Branch != "cockpit/task-task1234" {
+		t.Errorf("Unexpected branch %q", wt.Branch)
+	}
+	if _, err := os.Stat(filepath.Join(wt.Path, "README.md")); err != nil {
+		t.Errorf("Expected a checkout in the worktree: %v", err)
+	}
+
+	// Changes in the worktree stay out of the user's checkout
+	os.WriteFile(filepath.Join(wt.Path, "README.md"), []byte("task edit\n"), 0o644)
+	if status := gitCmd(t, repo, "status", "--porcelain"); status != "" {
+		t.Errorf("Expected the main checkout to stay clean, got %q", status)
+	}
+
+	list := m.List("sess")
+	if len(list) != 1 || list[0].SizeBytes == 0 || len(m.List("other")) != 0 {
+		t.Errorf("Unexpected listing: %+v", list)
+	}
+
+	// Worktrees are remembered across restarts while their task needs them
+	inUse := func(taskID string) bool { return taskID == "task1234abcd" }
+	reloaded, err := NewWorktreeManager(filepath.Dir(wt.Path), 0, 0, inUse)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := reloaded.Get("task1234abcd"); !ok {
+		t.Error("Expected the worktree to be reloaded")
+	}
+
+	if err := m.Remove(ctx, "task1234abcd", true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(wt.Path); !os.IsNotExist(err) {
+		t.Error("Expected the worktree directory to be gone")
+	}
+	if branches := gitCmd(t, repo, "branch", "--list", "cockpit/*"); strings.TrimSpace(branches) != "" {
+		t.Errorf("Expected the discarded branch to be deleted, got %q", branches)
+	}
+	if err := m.Remove(ctx, "task1234abcd", true); !errors.Is(err, ErrNoWorktree) {
+		t.Errorf("Expected ErrNoWorktree, got %v", err)
+	}
+}
+
+func TestWorktreeCapAndExpiry(t *testing.T) {
+	ctx := context.Background()
+	repo := initRepo(t)
+	running := map[string]bool{"first": true}
+	m, err := NewWorktreeManager(t.TempDir(), 1, 0, func(taskID string) bool { return running[taskID] })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := m.Create(ctx, repo, "sess", "first", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Create(ctx, repo, "sess", "second", ""); !errors.Is(err, ErrDiskCap) {
+		t.Errorf("Expected the disk cap to refuse a second worktree, got %v", err)
+	}
+
+	// Worktrees are not expired while their task still needs them
+	m.ttl = time.Nanosecond
+	m.expire()
+	if _, ok := m.Get("first"); !ok {
+		t.Fatal("Expected the worktree of a running task to be kept")
+	}
+
+	running["first"] = false
+	m.expire()
+	if _, ok := m.Get("first"); ok {
+		t.Error("Expected the expired worktree to be removed")
+	}
+	if branches := gitCmd(t, repo, "branch", "--list", "cockpit/task-first"); strings.TrimSpace(branches) == "" {
+		t.Error("Expected an expired worktree's branch to be kept")
+	}
+}
+
+func TestWorktreeOrphansRemovedOnLoad(t *testing.T) {
+	ctx := context.Background()
+	repo := initRepo(t)
+	dir := t.TempDir()
+	m, err := NewWorktreeManager(dir, 0, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wt, err := m.Create(ctx, repo, "sess", "orphan", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// After a restart no session knows the task any more
+	reloaded, err := NewWorktreeManager(dir, 0, 0, func(string) bool { return false })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := reloaded.Get("orphan"); ok {
+		t.Error("Expected the orphaned worktree not to be restored")
+	}
+	if _, err := os.Stat(wt.Path); !os.IsNotExist(err) {
+		t.Error("Expected the orphaned worktree directory to be gone")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "orphan.json")); !os.IsNotExist(err) {
+		t.Error("Expected the orphaned worktree's record to be gone")
+	}
+	if branches := gitCmd(t, repo, "branch", "--list", wt.Branch); strings.TrimSpace(branches) == "" {
+		t.Error("Expected the orphaned worktree's branch to be kept")
+	}
+}
@@ -0,0 +1,68 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// chatRequest is a message a client sends over the events socket to talk
+// with a task's agent: a user_message with content for the task's agent,
+// or the answer to a confirmation the agent asked for. Messages without a
+// taskId go to the session's running task.
+type chatRequest struct {
+	Type      string `json:"type"`
+	TaskID    string `json:"taskId"`
+	Content   string `json:"content"`
+	MessageID string `json:"messageId"`
+	Confirmed bool   `json:"confirmed"`
+}
+
+// handleChat passes a chat message from a client of the session on to the
+// task's agent. Other messages are ignored.
+func (s *Server) handleChat(sessionID string, req chatRequest) error {
+	switch req.Type {
+	case "user_message":
+		taskID := req.TaskID
+		if taskID == "" {
+			active, err := s.sessionManager.ActiveTask(sessionID)
+			if err != nil {
+				return err
+			}
+			taskID = active
+		} else if task, err := s.sessionManager.GetTask(taskID); err != nil || task.SessionID != sessionID {
+			return errors.New("task not found")
+		}
+		_, err := s.orchestrator.Say(taskID, req.Content)
+		return err
+
+	case "confirmation":
+		taskID, err := s.sessionManager.FindTaskMessage(sessionID, req.MessageID)
+		if err != nil {
+			return err
+		}
+		return s.orchestrator.Confirm(taskID, req.MessageID, req.Confirmed)
+	}
+	return nil
+}
+
+// getTaskTranscript returns a task's conversation with its agent, oldest
+// first
+func (s *Server) getTaskTranscript(w http.ResponseWriter, r *http.Request) {
+	task, ok := s.ownedTask(w, r)
+	if !ok {
+		return
+	}
+
+	messages, err := s.sessionManager.GetTaskTranscript(task.ID)
+	if err != nil {
+		http.Error(w, "Failed to get transcript", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"taskId":   task.ID,
+		"messages": messages,
+	})
+}
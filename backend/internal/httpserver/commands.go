@@ -0,0 +1,209 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PeterShin23/cockpit-coder/backend/internal/auth"
+	"github.com/PeterShin23/cockpit-coder/backend/internal/cmdexec"
+	"github.com/PeterShin23/cockpit-coder/backend/internal/jobs"
+	"github.com/gorilla/mux"
+)
+
+const (
+	defaultLogLimit = 64 * 1024
+	maxLogLimit     = 1024 * 1024
+)
+
+// runCommand starts an allow-listed command in the session repo, or in the
+// worktree of taskId, as a job and replies with its ID right away. Output and
+// the exit code follow on the events socket as cmd_output and cmd_exit
+// events, and stay available through the jobs endpoints.
+func (s *Server) runCommand(w http.ResponseWriter, r *http.Request) {
+	var req CmdRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	sessionID, err := auth.GetSessionIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	dir, err := s.workDir(sessionID, req.TaskID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if err := s.policy.CheckCmd(req.Cmd); err != nil {
+		http.Error(w, "Command rejected: "+err.Error(), http.StatusForbidden)
+		return
+	}
+
+	cwd, err := resolveCwd(dir, req.Cwd)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	timeout := s.policy.MaxCmdDuration
+	if requested := time.Duration(req.TimeoutMs) * time.Millisecond; requested > 0 && requested < timeout {
+		timeout = requested
+	}
+
+	job, err := s.jobs.Start(cmdexec.Request{
+		SessionID: sessionID,
+		TaskID:    req.TaskID,
+		Cmd:       req.Cmd,
+		Cwd:       cwd,
+		Timeout:   timeout,
+	})
+	if err != nil {
+		log.Printf("Failed to start command %q: %v", req.Cmd, err)
+		http.Error(w, "Failed to start command", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"ok":        true,
+		"jobId":     job.ID,
+		"cmd":       job.Cmd,
+		"cwd":       job.Cwd,
+		"timeoutMs": job.TimeoutMs,
+	})
+}
+
+func (s *Server) listJobs(w http.ResponseWriter, r *http.Request) {
+	sessionID, err := auth.GetSessionIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"jobs": s.jobs.List(sessionID),
+	})
+}
+
+func (s *Server) getJob(w http.ResponseWriter, r *http.Request) {
+	job, ok := s.ownedJob(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
+
+// getJobLog returns a byte range of a job's output. offset defaults to 0 and
+// may be negative to tail the log; limit defaults to 64 KiB. Clients follow a
+// running job by passing nextOffset back as offset.
+func (s *Server) getJobLog(w http.ResponseWriter, r *http.Request) {
+	job, ok := s.ownedJob(w, r)
+	if !ok {
+		return
+	}
+
+	offset, err := queryInt64(r, "offset", 0)
+	if err != nil {
+		http.Error(w, "Invalid offset", http.StatusBadRequest)
+		return
+	}
+	limit, err := queryInt64(r, "limit", defaultLogLimit)
+	if err != nil || limit <= 0 {
+		http.Error(w, "Invalid limit", http.StatusBadRequest)
+		return
+	}
+	if limit > maxLogLimit {
+		limit = maxLogLimit
+	}
+
+	data, start, size, err := s.jobs.ReadLog(job.ID, offset, limit)
+	if err != nil {
+		http.Error(w, "Failed to read job log", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"jobId":      job.ID,
+		"status":     job.Status,
+		"offset":     start,
+		"nextOffset": start + int64(len(data)),
+		"size":       size,
+		"data":       string(data),
+	})
+}
+
+func (s *Server) killJob(w http.ResponseWriter, r *http.Request) {
+	job, ok := s.ownedJob(w, r)
+	if !ok {
+		return
+	}
+
+	if err := s.jobs.Kill(job.ID); err != nil {
+		http.Error(w, "Failed to kill job", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"ok": true})
+}
+
+// ownedJob looks up the job named in the route, writing an error response
+// unless it belongs to the caller's session
+func (s *Server) ownedJob(w http.ResponseWriter, r *http.Request) (jobs.Job, bool) {
+	sessionID, err := auth.GetSessionIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return jobs.Job{}, false
+	}
+
+	job, ok := s.jobs.Get(mux.Vars(r)["id"])
+	if !ok || job.SessionID != sessionID {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return jobs.Job{}, false
+	}
+
+	return job, true
+}
+
+// queryInt64 parses an integer query param, falling back to def when absent
+func queryInt64(r *http.Request, key string, def int64) (int64, error) {
+	value := r.URL.Query().Get(key)
+	if value == "" {
+		return def, nil
+	}
+	return strconv.ParseInt(value, 10, 64)
+}
+
+// resolveCwd turns a working directory from a request into an absolute path,
+// relative paths being taken from the repo root, and refuses anything that
+// escapes the repo
+func resolveCwd(repo, cwd string) (string, error) {
+	if cwd == "" {
+		return repo, nil
+	}
+	if !filepath.IsAbs(cwd) {
+		cwd = filepath.Join(repo, cwd)
+	}
+	cwd = filepath.Clean(cwd)
+
+	rel, err := filepath.Rel(repo, cwd)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", errors.New("cwd must be inside the session repository")
+	}
+	return cwd, nil
+}
@@ -0,0 +1,135 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/PeterShin23/cockpit-coder/backend/internal/auth"
+	"github.com/PeterShin23/cockpit-coder/backend/internal/events"
+)
+
+// handleEventsWebSocket forwards the session's events to the client. Every
+// event carries a per-session seq; a client reconnecting with ?since=<seq>
+// first receives the events it missed. If some of them are no longer
+// retained, a "replay_truncated" event says so before the replay starts.
+// Chat messages the client sends are passed on to the task's agent; the
+// ones that cannot be are answered with an error.
+func (s *Server) handleEventsWebSocket(w http.ResponseWriter, r *http.Request) {
+	sessionID, err := auth.GetSessionIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var since uint64
+	replay := r.URL.Query().Has("since")
+	if replay {
+		parsed, err := strconv.ParseUint(r.URL.Query().Get("since"), 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid since", http.StatusBadRequest)
+			return
+		}
+		since = parsed
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("WebSocket upgrade failed: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	// Subscribe before reading the history so nothing published in between
+	// is missed; events already sent are skipped by seq
+	ch, unsubscribe := s.events.Subscribe(sessionID)
+	defer unsubscribe()
+
+	// catchUp sends the retained events after last and before until, or all
+	// of them when until is 0
+	last := since
+	catchUp := func(until uint64) error {
+		missed, complete := s.events.History(sessionID, last)
+		if !complete {
+			if err := conn.WriteJSON(events.Event{
+				Type:   "replay_truncated",
+				Fields: map[string]any{"since": last},
+			}); err != nil {
+				return err
+			}
+		}
+		for _, event := range missed {
+			if until > 0 && event.Seq >= until {
+				break
+			}
+			if err := conn.WriteJSON(event); err != nil {
+				return err
+			}
+			last = event.Seq
+		}
+		return nil
+	}
+
+	if replay {
+		if err := catchUp(0); err != nil {
+			return
+		}
+	}
+
+	// Errors for the client's messages are sent by the loop below, which
+	// owns the connection's write side
+	notices := make(chan events.Event, 16)
+
+	gone := make(chan struct{})
+	go func() {
+		defer close(gone)
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+
+			var req chatRequest
+			if json.Unmarshal(data, &req) != nil {
+				continue
+			}
+			if err := s.handleChat(sessionID, req); err != nil {
+				select {
+				case notices <- events.Event{
+					Type:   "error",
+					Fields: map[string]any{"message": err.Error(), "request": req.Type, "messageId": req.MessageID},
+				}:
+				default:
+				}
+			}
+		}
+	}()
+
+	for {
+		select {
+		case event := <-ch:
+			if last > 0 && event.Seq <= last {
+				continue
+			}
+			// The subscription drops events when this connection falls
+			// behind; fill the gap from the history, then send the event.
+			// Transient events are not in the history and stay missed.
+			if last > 0 && event.Seq > last+1 {
+				if err := catchUp(event.Seq); err != nil {
+					return
+				}
+			}
+			if err := conn.WriteJSON(event); err != nil {
+				return
+			}
+			last = event.Seq
+		case notice := <-notices:
+			if err := conn.WriteJSON(notice); err != nil {
+				return
+			}
+		case <-gone:
+			return
+		}
+	}
+}
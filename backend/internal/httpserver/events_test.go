@@ -0,0 +1,69 @@
+package httpserver
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/PeterShin23/cockpit-coder/backend/internal/events"
+	"github.com/PeterShin23/cockpit-coder/backend/internal/session"
+)
+
+func TestEventsReconnectWhileJobStreams(t *testing.T) {
+	sessions := session.NewMemoryManager()
+	bus := events.NewMemoryBus()
+	s := NewServer(Deps{Sessions: sessions, Events: bus})
+	srv := httptest.NewServer(s.router)
+	defer srv.Close()
+
+	sessionID, token, _ := sessions.CreateSession(t.TempDir(), "", "")
+	output := func(data string) events.Event {
+		return events.Event{Type: "cmd_output", Fields: map[string]any{"jobId": "j", "data": data}, Transient: true}
+	}
+
+	// Output the client missed while it was away is not replayed
+	bus.Publish(sessionID, events.Event{Type: "cmd_start", Fields: map[string]any{"jobId": "j"}})
+	bus.Publish(sessionID, output("missed 1"))
+	bus.Publish(sessionID, output("missed 2"))
+
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws/events?since=0&token=" + token
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	read := func() map[string]any {
+		t.Helper()
+		var got map[string]any
+		if err := conn.ReadJSON(&got); err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+
+	// The replay comes after subscribing, so live events are seen from here
+	if got := read(); got["type"] != "cmd_start" {
+		t.Fatalf("Expected the replayed cmd_start, got %v", got)
+	}
+
+	bus.Publish(sessionID, output("live 1"))
+	bus.Publish(sessionID, output("live 2"))
+	bus.Publish(sessionID, events.Event{Type: "cmd_exit", Fields: map[string]any{"jobId": "j"}})
+
+	want := []string{"cmd_output live 1", "cmd_output live 2", "cmd_exit "}
+	for i, w := range want {
+		got := read()
+		data, _ := got["data"].(string)
+		if got["type"].(string)+" "+data != w {
+			t.Fatalf("Event %d: expected %q, got %v", i, w, got)
+		}
+		if got["seq"] != float64(i+4) {
+			t.Errorf("Event %d: expected seq %d, got %v", i, i+4, got["seq"])
+		}
+	}
+}
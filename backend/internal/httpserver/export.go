@@ -0,0 +1,160 @@
+package httpserver
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/PeterShin23/cockpit-coder/backend/internal/git"
+)
+
+// PushRequest pushes a task's branch. Remote defaults to PUSH_REMOTE, then
+// the branch's upstream remote, then origin; RemoteBranch defaults to the
+// task's branch.
+type PushRequest struct {
+	Remote       string `json:"remote"`
+	RemoteBranch string `json:"remoteBranch"`
+	Force        bool   `json:"force"`
+}
+
+// pushTask pushes a task's branch to a remote and tracks it there
+func (s *Server) pushTask(w http.ResponseWriter, r *http.Request) {
+	task, ok := s.ownedTask(w, r)
+	if !ok {
+		return
+	}
+
+	var req PushRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if task.Branch == "" {
+		http.Error(w, "Task has no branch", http.StatusConflict)
+		return
+	}
+	if req.Remote == "" {
+		req.Remote = getEnv("PUSH_REMOTE", "")
+	}
+
+	sess, err := s.sessionManager.GetSession(task.SessionID)
+	if err != nil {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+
+	result, err := s.gitProvider.Push(r.Context(), sess.Repo, git.PushOptions{
+		Remote:       req.Remote,
+		Branch:       task.Branch,
+		RemoteBranch: req.RemoteBranch,
+		Force:        req.Force,
+	})
+	if err != nil {
+		log.Printf("Push failed for task %s: %v", task.ID, err)
+		if errors.Is(err, git.ErrUnknownRemote) {
+			http.Error(w, "Unknown remote", http.StatusBadRequest)
+			return
+		}
+
+		status := http.StatusBadGateway
+		if errors.Is(err, git.ErrPushRejected) {
+			status = http.StatusConflict
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"ok":     false,
+			"error":  err.Error(),
+			"remote": result.Remote,
+			"branch": result.Branch,
+			"reason": result.Reason,
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"ok":           true,
+		"remote":       result.Remote,
+		"branch":       result.Branch,
+		"remoteBranch": result.RemoteBranch,
+		"upstream":     result.Upstream,
+		"status":       result.Status,
+		"old":          result.Old,
+		"new":          result.New,
+	})
+}
+
+// formatPatch downloads a task's applied commits as git format-patch files,
+// either concatenated into one mbox (the default) or as a zip
+func (s *Server) formatPatch(w http.ResponseWriter, r *http.Request) {
+	task, ok := s.ownedTask(w, r)
+	if !ok {
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "mbox"
+	}
+	if format != "mbox" && format != "zip" {
+		http.Error(w, "Format must be mbox or zip", http.StatusBadRequest)
+		return
+	}
+	if len(task.Commits) == 0 {
+		http.Error(w, "Task has no applied commits", http.StatusConflict)
+		return
+	}
+
+	sess, err := s.sessionManager.GetSession(task.SessionID)
+	if err != nil {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+
+	files, err := s.gitProvider.FormatPatch(r.Context(), sess.Repo, task.Commits)
+	if err != nil {
+		log.Printf("Format-patch failed for task %s: %v", task.ID, err)
+		http.Error(w, "Failed to export commits", http.StatusInternalServerError)
+		return
+	}
+
+	name := "task-" + task.ID
+	if format == "mbox" {
+		var mbox strings.Builder
+		for _, file := range files {
+			mbox.WriteString(file.Content)
+		}
+		w.Header().Set("Content-Type", "application/mbox")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+".mbox"))
+		io.WriteString(w, mbox.String())
+		return
+	}
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for _, file := range files {
+		entry, err := archive.Create(name + "/" + file.Name)
+		if err == nil {
+			_, err = io.WriteString(entry, file.Content)
+		}
+		if err != nil {
+			http.Error(w, "Failed to build archive", http.StatusInternalServerError)
+			return
+		}
+	}
+	if err := archive.Close(); err != nil {
+		http.Error(w, "Failed to build archive", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+".zip"))
+	w.Write(buf.Bytes())
+}
@@ -0,0 +1,293 @@
+package httpserver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/PeterShin23/cockpit-coder/backend/internal/auth"
+	"github.com/PeterShin23/cockpit-coder/backend/internal/pty"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+)
+
+// ptyWriteTimeout bounds how long a stalled viewer may hold up the process
+const ptyWriteTimeout = 10 * time.Second
+
+// ptyControl is a JSON control message sent by the terminal alongside raw
+// input: "resize", or one of the input lease messages "input_request",
+// "input_grant" (with viewer), "input_release" and "input_revoke"
+type ptyControl struct {
+	Type   string `json:"type"`
+	Cols   int    `json:"cols"`
+	Rows   int    `json:"rows"`
+	Viewer string `json:"viewer"`
+}
+
+type PtyRenameRequest struct {
+	Name string `json:"name"`
+}
+
+// handlePtyWebSocket attaches the client to a terminal. Without a ptyId a new
+// shell is started in the session repo, or in the worktree of taskId; with
+// one, the client joins an existing shell and receives its scrollback first.
+// Any number of clients may watch the same shell, but only the holder of the
+// input lease can type; passing the viewerId from a previous connection
+// resumes that viewer and its lease. Closing the socket only detaches: the
+// shell keeps running until it exits, is killed or is reaped.
+func (s *Server) handlePtyWebSocket(w http.ResponseWriter, r *http.Request) {
+	sessionID, err := auth.GetSessionIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	taskID := r.URL.Query().Get("taskId")
+	dir, err := s.workDir(sessionID, taskID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	var proc pty.Proc
+	if ptyID := r.URL.Query().Get("ptyId"); ptyID != "" {
+		existing, ok := s.ptyManager.Get(ptyID)
+		if !ok || existing.Info().Owner != sessionID {
+			http.Error(w, "PTY not found", http.StatusNotFound)
+			return
+		}
+		proc = existing
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("WebSocket upgrade failed: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	if proc == nil {
+		// The shell outlives this connection, so it is not bound to the request
+		proc, err = s.ptyManager.Spawn(context.Background(), pty.Spec{
+			Owner:  sessionID,
+			TaskID: taskID,
+			Name:   r.URL.Query().Get("name"),
+			Cmd:    userShell(),
+			Cwd:    dir,
+			Env:    []string{"TERM=xterm-256color"},
+		})
+		if err != nil {
+			log.Printf("Failed to start shell for session %s: %v", sessionID, err)
+			conn.WriteJSON(map[string]interface{}{
+				"type":    "error",
+				"message": "Failed to start shell",
+			})
+			return
+		}
+	}
+
+	attachment := proc.Attach(r.URL.Query().Get("viewerId"))
+	defer attachment.Detach()
+
+	info := proc.Info()
+	conn.WriteJSON(map[string]interface{}{
+		"type":     "attached",
+		"ptyId":    info.ID,
+		"viewerId": attachment.ID,
+		"name":     info.Name,
+		"cols":     info.Cols,
+		"rows":     info.Rows,
+	})
+	if len(attachment.Replay) > 0 {
+		conn.WriteMessage(websocket.BinaryMessage, attachment.Replay)
+	}
+
+	// Replies to control messages are written by the output loop below,
+	// which owns the connection's write side
+	notices := make(chan map[string]interface{}, 16)
+	notify := func(notice map[string]interface{}) {
+		select {
+		case notices <- notice:
+		default:
+		}
+	}
+
+	// WebSocket -> PTY
+	go func() {
+		defer attachment.Detach()
+		for {
+			msgType, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+
+			if msgType == websocket.TextMessage && len(data) > 0 && data[0] == '{' {
+				var ctrl ptyControl
+				if json.Unmarshal(data, &ctrl) == nil && ctrl.Type != "" {
+					if err := handlePtyControl(attachment, ctrl); err != nil {
+						notify(map[string]interface{}{
+							"type":    "error",
+							"message": err.Error(),
+						})
+					}
+					continue
+				}
+			}
+
+			if _, err := attachment.Write(data); err != nil {
+				if err == pty.ErrNoInputLease {
+					notify(map[string]interface{}{"type": "input_denied"})
+					continue
+				}
+				return
+			}
+		}
+	}()
+
+	// PTY -> WebSocket. Output goes out as binary frames: raw chunks may split
+	// multi-byte characters, which text frames are not allowed to carry.
+	for {
+		select {
+		case chunk, ok := <-attachment.Output:
+			if !ok {
+				state := <-proc.Done()
+				conn.WriteJSON(map[string]interface{}{
+					"type":       "exit",
+					"code":       state.ExitCode,
+					"durationMs": state.Duration.Milliseconds(),
+				})
+				return
+			}
+			conn.SetWriteDeadline(time.Now().Add(ptyWriteTimeout))
+			if err := conn.WriteMessage(websocket.BinaryMessage, chunk); err != nil {
+				return
+			}
+		case lease := <-attachment.Leases:
+			conn.SetWriteDeadline(time.Now().Add(ptyWriteTimeout))
+			if err := conn.WriteJSON(map[string]interface{}{
+				"type":     "input_lease",
+				"holder":   lease.Holder,
+				"grantor":  lease.Grantor,
+				"requests": lease.Requests,
+			}); err != nil {
+				return
+			}
+		case notice := <-notices:
+			conn.SetWriteDeadline(time.Now().Add(ptyWriteTimeout))
+			if err := conn.WriteJSON(notice); err != nil {
+				return
+			}
+		case <-attachment.Detached:
+			conn.WriteJSON(map[string]interface{}{
+				"type":  "detached",
+				"ptyId": info.ID,
+			})
+			return
+		}
+	}
+}
+
+// handlePtyControl applies a control message from a viewer
+func handlePtyControl(attachment *pty.Attachment, ctrl ptyControl) error {
+	switch ctrl.Type {
+	case "resize":
+		if ctrl.Cols <= 0 || ctrl.Rows <= 0 {
+			return nil
+		}
+		// Only the viewer at the keyboard decides the size; others just watch
+		if err := attachment.Resize(ctrl.Cols, ctrl.Rows); err != nil && err != pty.ErrNoInputLease {
+			log.Printf("PTY resize failed: %v", err)
+		}
+		return nil
+	case "input_request":
+		attachment.RequestInput()
+		return nil
+	case "input_grant":
+		return attachment.GrantInput(ctrl.Viewer)
+	case "input_release":
+		return attachment.ReleaseInput()
+	case "input_revoke":
+		return attachment.RevokeInput()
+	default:
+		return fmt.Errorf("unknown control message %q", ctrl.Type)
+	}
+}
+
+func (s *Server) listPtys(w http.ResponseWriter, r *http.Request) {
+	sessionID, err := auth.GetSessionIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"ptys": s.ptyManager.List(sessionID),
+	})
+}
+
+func (s *Server) renamePty(w http.ResponseWriter, r *http.Request) {
+	proc, ok := s.ownedPty(w, r)
+	if !ok {
+		return
+	}
+
+	var req PtyRenameRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Name == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.ptyManager.Rename(proc.ID(), req.Name); err != nil {
+		http.Error(w, "PTY not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(proc.Info())
+}
+
+func (s *Server) killPty(w http.ResponseWriter, r *http.Request) {
+	proc, ok := s.ownedPty(w, r)
+	if !ok {
+		return
+	}
+
+	if err := s.ptyManager.Kill(proc.ID()); err != nil {
+		http.Error(w, "PTY not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"ok": true})
+}
+
+// ownedPty looks up the PTY named in the route, writing an error response
+// unless it belongs to the caller's session
+func (s *Server) ownedPty(w http.ResponseWriter, r *http.Request) (pty.Proc, bool) {
+	sessionID, err := auth.GetSessionIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	proc, ok := s.ptyManager.Get(mux.Vars(r)["id"])
+	if !ok || proc.Info().Owner != sessionID {
+		http.Error(w, "PTY not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	return proc, true
+}
+
+// userShell returns the login shell used for interactive terminals
+func userShell() string {
+	if shell := os.Getenv("SHELL"); shell != "" {
+		return shell
+	}
+	return "/bin/sh"
+}
@@ -0,0 +1,198 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/PeterShin23/cockpit-coder/backend/internal/auth"
+	"github.com/PeterShin23/cockpit-coder/backend/internal/recording"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+)
+
+// maxPlaybackSpeed keeps accelerated playback from degenerating into a dump
+const maxPlaybackSpeed = 64
+
+func (s *Server) listRecordings(w http.ResponseWriter, r *http.Request) {
+	sessionID, err := auth.GetSessionIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	taskID := r.URL.Query().Get("taskId")
+	recordings, err := s.recordings.List(func(meta recording.Meta) bool {
+		return meta.SessionID == sessionID && (taskID == "" || meta.TaskID == taskID)
+	})
+	if err != nil {
+		http.Error(w, "Failed to list recordings", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"recordings": recordings,
+	})
+}
+
+// getRecording downloads the raw asciicast file
+func (s *Server) getRecording(w http.ResponseWriter, r *http.Request) {
+	sessionID, err := auth.GetSessionIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+	meta, err := s.recordings.Get(id)
+	if err != nil || meta.SessionID != sessionID {
+		http.Error(w, "Recording not found", http.StatusNotFound)
+		return
+	}
+
+	f, err := s.recordings.Open(id)
+	if err != nil {
+		http.Error(w, "Recording not found", http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+
+	w.Header().Set("Content-Type", "application/x-asciicast")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", id+".cast"))
+	io.Copy(w, f)
+}
+
+// handleRecordingWebSocket plays a recording back with its original timing.
+// The speed query param scales playback and idle caps pauses, in seconds.
+// Output goes out as binary frames; header, resize, input and end events go
+// out as JSON text frames.
+func (s *Server) handleRecordingWebSocket(w http.ResponseWriter, r *http.Request) {
+	sessionID, err := auth.GetSessionIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+	meta, err := s.recordings.Get(id)
+	if err != nil || meta.SessionID != sessionID {
+		http.Error(w, "Recording not found", http.StatusNotFound)
+		return
+	}
+
+	speed := 1.0
+	if v := r.URL.Query().Get("speed"); v != "" {
+		parsed, err := strconv.ParseFloat(v, 64)
+		if err != nil || parsed <= 0 || parsed > maxPlaybackSpeed {
+			http.Error(w, "Invalid speed", http.StatusBadRequest)
+			return
+		}
+		speed = parsed
+	}
+
+	var idleLimit float64
+	if v := r.URL.Query().Get("idle"); v != "" {
+		parsed, err := strconv.ParseFloat(v, 64)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "Invalid idle limit", http.StatusBadRequest)
+			return
+		}
+		idleLimit = parsed
+	}
+
+	f, err := s.recordings.Open(id)
+	if err != nil {
+		http.Error(w, "Recording not found", http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+
+	reader, err := recording.NewReader(f)
+	if err != nil {
+		http.Error(w, "Invalid recording", http.StatusInternalServerError)
+		return
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("WebSocket upgrade failed: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	// Reading is only needed to notice the client going away
+	gone := make(chan struct{})
+	go func() {
+		defer close(gone)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	conn.WriteJSON(map[string]interface{}{
+		"type":      "header",
+		"recording": meta,
+		"speed":     speed,
+	})
+
+	start := time.Now()
+	var last, played float64
+	for {
+		event, err := reader.Next()
+		if err != nil {
+			if err != io.EOF {
+				log.Printf("Failed to read recording %s: %v", id, err)
+			}
+			break
+		}
+
+		gap := event.Time - last
+		if idleLimit > 0 && gap > idleLimit {
+			gap = idleLimit
+		}
+		last = event.Time
+		played += gap
+
+		due := start.Add(time.Duration(played / speed * float64(time.Second)))
+		select {
+		case <-time.After(time.Until(due)):
+		case <-gone:
+			return
+		}
+
+		switch event.Code {
+		case "o":
+			err = conn.WriteMessage(websocket.BinaryMessage, []byte(event.Data))
+		case "i":
+			err = conn.WriteJSON(map[string]interface{}{
+				"type": "input",
+				"time": event.Time,
+				"data": event.Data,
+			})
+		case "r":
+			var cols, rows int
+			if _, scanErr := fmt.Sscanf(event.Data, "%dx%d", &cols, &rows); scanErr == nil {
+				err = conn.WriteJSON(map[string]interface{}{
+					"type": "resize",
+					"cols": cols,
+					"rows": rows,
+				})
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+
+	conn.WriteJSON(map[string]interface{}{
+		"type":       "end",
+		"durationMs": int64(last * 1000),
+	})
+}
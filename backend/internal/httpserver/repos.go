@@ -0,0 +1,81 @@
+package httpserver
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+
+	"github.com/PeterShin23/cockpit-coder/backend/internal/auth"
+	"github.com/PeterShin23/cockpit-coder/backend/internal/git"
+)
+
+// repoSummary is all a caller without a session learns about an allowlisted
+// repository: enough to pick it when creating a session
+type repoSummary struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// repoEntry is an allowlisted repository. Error is set instead of the git
+// details when the path cannot be inspected.
+type repoEntry struct {
+	ID string `json:"id"`
+	git.RepoInfo
+	Error string `json:"error,omitempty"`
+}
+
+// repoID is the opaque ID a repository is picked by, so its path is not
+// given away
+func repoID(path string) string {
+	sum := sha256.Sum256([]byte(path))
+	return hex.EncodeToString(sum[:8])
+}
+
+// repoByID returns the allowlisted repository with an ID
+func (s *Server) repoByID(id string) (string, bool) {
+	for _, path := range s.policy.RepoAllowlist {
+		if repoID(path) == id {
+			return path, true
+		}
+	}
+	return "", false
+}
+
+// listRepos describes the allowlisted repositories so clients can offer a
+// picker when creating a session. Callers without a session only get each
+// repository's ID and name; the path, branch, state and remotes need a token.
+func (s *Server) listRepos(w http.ResponseWriter, r *http.Request) {
+	if _, err := auth.GetSessionIDFromRequest(r); err != nil {
+		summaries := make([]repoSummary, 0, len(s.policy.RepoAllowlist))
+		for _, path := range s.policy.RepoAllowlist {
+			summaries = append(summaries, repoSummary{ID: repoID(path), Name: filepath.Base(filepath.Clean(path))})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"repos": summaries,
+		})
+		return
+	}
+
+	repos := make([]repoEntry, 0, len(s.policy.RepoAllowlist))
+	for _, path := range s.policy.RepoAllowlist {
+		info, err := git.Inspect(r.Context(), path)
+		if err != nil {
+			repos = append(repos, repoEntry{
+				ID:       repoID(path),
+				RepoInfo: git.RepoInfo{Name: filepath.Base(filepath.Clean(path)), Path: path, Remotes: []string{}},
+				Error:    err.Error(),
+			})
+			continue
+		}
+		repos = append(repos, repoEntry{ID: repoID(path), RepoInfo: info})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"repos": repos,
+	})
+}
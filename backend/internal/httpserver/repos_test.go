@@ -0,0 +1,77 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PeterShin23/cockpit-coder/backend/internal/events"
+	"github.com/PeterShin23/cockpit-coder/backend/internal/policy"
+	"github.com/PeterShin23/cockpit-coder/backend/internal/session"
+)
+
+func TestListReposHidesDetailsWithoutToken(t *testing.T) {
+	repo := filepath.Join(t.TempDir(), "project")
+	if out, err := exec.Command("git", "init", "-q", repo).CombinedOutput(); err != nil {
+		t.Fatalf("git init: %v\n%s", err, out)
+	}
+
+	sessions := session.NewMemoryManager()
+	s := NewServer(Deps{
+		Sessions: sessions,
+		Events:   events.NewMemoryBus(),
+		Policy:   policy.NewPolicy([]string{repo}, nil, time.Minute, false),
+	})
+
+	list := func(token string) []map[string]any {
+		t.Helper()
+		req := httptest.NewRequest("GET", "/api/repos", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var body struct {
+			Repos []map[string]any `json:"repos"`
+		}
+		json.Unmarshal(rec.Body.Bytes(), &body)
+		if len(body.Repos) != 1 {
+			t.Fatalf("Expected one repository, got %s", rec.Body.String())
+		}
+		return body.Repos
+	}
+
+	public := list("")[0]
+	if len(public) != 2 || public["name"] != "project" || public["id"] == "" {
+		t.Errorf("Expected only an ID and name without a token, got %v", public)
+	}
+
+	// The ID is enough to create a session
+	req := httptest.NewRequest("POST", "/api/session", strings.NewReader(`{"repoId": "`+public["id"].(string)+`"}`))
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected a session for the repository ID, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var created SessionCreateResponse
+	json.Unmarshal(rec.Body.Bytes(), &created)
+
+	if detailed := list(created.Token)[0]; detailed["path"] != repo || detailed["id"] != public["id"] {
+		t.Errorf("Expected the details with a token, got %v", detailed)
+	}
+
+	req = httptest.NewRequest("POST", "/api/session", strings.NewReader(`{"repoId": "nope"}`))
+	rec = httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("Expected an unknown repository ID to be refused, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,208 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/PeterShin23/cockpit-coder/backend/internal/git"
+	"github.com/PeterShin23/cockpit-coder/backend/internal/session"
+)
+
+// CommentRequest attaches a review comment to a task's patch of File. Hunk
+// is an index into the file's hunks and Line a line number on Side, which is
+// "new" (the default) or "old"; both are optional.
+type CommentRequest struct {
+	File string `json:"file"`
+	Hunk *int   `json:"hunk"`
+	Line int    `json:"line"`
+	Side string `json:"side"`
+	Body string `json:"body"`
+}
+
+// RequestChangesRequest sends a task's open comments back to its agent
+type RequestChangesRequest struct {
+	Summary string `json:"summary"`
+}
+
+// addTaskComment stores a review comment on a line or hunk of a task's patches
+func (s *Server) addTaskComment(w http.ResponseWriter, r *http.Request) {
+	task, ok := s.ownedTask(w, r)
+	if !ok {
+		return
+	}
+
+	var req CommentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.File == "" || strings.TrimSpace(req.Body) == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	patches, err := s.sessionManager.GetTaskPatches(task.ID)
+	if err != nil {
+		http.Error(w, "Failed to get patches", http.StatusInternalServerError)
+		return
+	}
+
+	comment, err := locateComment(patches, req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	comment, err = s.sessionManager.AddTaskComment(task.ID, comment)
+	if err != nil {
+		http.Error(w, "Failed to add comment", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(comment)
+}
+
+// listTaskComments returns a task's review comments
+func (s *Server) listTaskComments(w http.ResponseWriter, r *http.Request) {
+	task, ok := s.ownedTask(w, r)
+	if !ok {
+		return
+	}
+
+	comments, err := s.sessionManager.GetTaskComments(task.ID)
+	if err != nil {
+		http.Error(w, "Failed to get comments", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"comments": comments,
+	})
+}
+
+// requestChanges turns a task's open comments into a follow-up instruction
+// and hands it to the task's agent in the task's worktree
+func (s *Server) requestChanges(w http.ResponseWriter, r *http.Request) {
+	task, ok := s.ownedTask(w, r)
+	if !ok {
+		return
+	}
+
+	var req RequestChangesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// The agent picks up where it left off, so its workspace must still exist
+	worktree, exists := s.worktrees.Get(task.ID)
+	if !exists {
+		http.Error(w, "Task has no worktree", http.StatusConflict)
+		return
+	}
+
+	if _, err := s.agents.For(task.Agent); err != nil {
+		http.Error(w, "Unknown agent: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	followUp, err := s.sessionManager.RequestChanges(task.ID, req.Summary)
+	if err != nil {
+		if errors.Is(err, session.ErrNoComments) {
+			http.Error(w, "No open comments", http.StatusConflict)
+			return
+		}
+		if errors.Is(err, session.ErrInvalidTransition) {
+			http.Error(w, "Task is not awaiting review", http.StatusConflict)
+			return
+		}
+		http.Error(w, "Failed to request changes", http.StatusInternalServerError)
+		return
+	}
+
+	if err := s.orchestrator.Start(task.ID, followUp.Instruction, worktree.Path, 0); err != nil {
+		log.Printf("Failed to start follow-up for task %s: %v", task.ID, err)
+		http.Error(w, "Failed to start agent", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"ok":          true,
+		"round":       followUp.Round,
+		"instruction": followUp.Instruction,
+		"comments":    followUp.Comments,
+	})
+}
+
+// locateComment checks that a comment points at a file, hunk and line that
+// exist in the task's patches and quotes what it points at
+func locateComment(patches []session.Patch, req CommentRequest) (session.Comment, error) {
+	comment := session.Comment{
+		File: req.File,
+		Hunk: req.Hunk,
+		Line: req.Line,
+		Side: req.Side,
+		Body: strings.TrimSpace(req.Body),
+	}
+	if comment.Side == "" {
+		comment.Side = "new"
+	}
+	if comment.Side != "new" && comment.Side != "old" {
+		return comment, errors.New("Side must be new or old")
+	}
+
+	var content string
+	found := false
+	for _, patch := range patches {
+		if patch.File == req.File {
+			content, found = patch.Patch, true
+			break
+		}
+	}
+	if !found {
+		return comment, fmt.Errorf("No patch for %s in this task", req.File)
+	}
+
+	hunks, err := git.ParseHunks(content)
+	if err != nil {
+		return comment, fmt.Errorf("Failed to parse patch for %s", req.File)
+	}
+	if req.Hunk != nil && (*req.Hunk < 0 || *req.Hunk >= len(hunks)) {
+		return comment, fmt.Errorf("Hunk %d out of range", *req.Hunk)
+	}
+	if req.Line < 0 {
+		return comment, errors.New("Line must not be negative")
+	}
+
+	if req.Line == 0 {
+		if req.Hunk != nil {
+			comment.Excerpt = hunks[*req.Hunk].String()
+		}
+		return comment, nil
+	}
+
+	for i, hunk := range hunks {
+		if req.Hunk != nil && i != *req.Hunk {
+			continue
+		}
+		for _, line := range hunk.Lines {
+			number := line.NewLine
+			if comment.Side == "old" {
+				number = line.OldLine
+			}
+			if number == req.Line {
+				hunkIndex := i
+				comment.Hunk = &hunkIndex
+				comment.Excerpt = line.Content
+				return comment, nil
+			}
+		}
+	}
+	return comment, fmt.Errorf("Line %d is not part of the patch", req.Line)
+}
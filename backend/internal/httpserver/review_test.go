@@ -0,0 +1,48 @@
+package httpserver
+
+import (
+	"testing"
+
+	"github.com/PeterShin23/cockpit-coder/backend/internal/session"
+)
+
+func TestLocateComment(t *testing.T) {
+	patches := []session.Patch{{
+		File:  "main.go",
+		Patch: "--- a/main.go\n+++ b/main.go\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n@@ -10,2 +10,3 @@\n x\n+y\n z\n",
+	}}
+	hunk := func(i int) *int { return &i }
+
+	tests := []struct {
+		name    string
+		req     CommentRequest
+		hunk    int
+		excerpt string
+		wantErr bool
+	}{
+		{"new line", CommentRequest{File: "main.go", Line: 11, Body: "why?"}, 1, "y", false},
+		{"old line", CommentRequest{File: "main.go", Line: 2, Side: "old", Body: "keep"}, 0, "b", false},
+		{"whole hunk", CommentRequest{File: "main.go", Hunk: hunk(1), Body: "hmm"}, 1, "@@ -10,2 +10,3 @@\n x\n+y\n z\n", false},
+		{"line outside hunk", CommentRequest{File: "main.go", Hunk: hunk(0), Line: 11, Body: "x"}, 0, "", true},
+		{"line outside patch", CommentRequest{File: "main.go", Line: 5, Body: "x"}, 0, "", true},
+		{"unknown file", CommentRequest{File: "other.go", Body: "x"}, 0, "", true},
+		{"bad side", CommentRequest{File: "main.go", Line: 2, Side: "left", Body: "x"}, 0, "", true},
+	}
+
+	for _, tt := range tests {
+		comment, err := locateComment(patches, tt.req)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected an error", tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if comment.Hunk == nil || *comment.Hunk != tt.hunk || comment.Excerpt != tt.excerpt {
+			t.Errorf("%s: unexpected comment %+v", tt.name, comment)
+		}
+	}
+}
@@ -2,14 +2,25 @@ package httpserver
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/PeterShin23/cockpit-coder/backend/internal/agents"
 	"github.com/PeterShin23/cockpit-coder/backend/internal/auth"
+	"github.com/PeterShin23/cockpit-coder/backend/internal/events"
+	"github.com/PeterShin23/cockpit-coder/backend/internal/git"
+	"github.com/PeterShin23/cockpit-coder/backend/internal/jobs"
+	"github.com/PeterShin23/cockpit-coder/backend/internal/orchestrator"
+	"github.com/PeterShin23/cockpit-coder/backend/internal/policy"
+	"github.com/PeterShin23/cockpit-coder/backend/internal/recording"
 	"github.com/PeterShin23/cockpit-coder/backend/internal/session"
 	"github.com/PeterShin23/cockpit-coder/backend/internal/pty"
 	"github.com/gorilla/mux"
@@ -17,16 +28,48 @@ import (
 )
 
 type Server struct {
-	router        *mux.Router
+	router         *mux.Router
 	sessionManager *session.MemoryManager
-	ptyManager    pty.Manager
+	ptyManager     pty.Manager
+	recordings     *recording.Store
+	policy         *policy.Policy
+	jobs           *jobs.Manager
+	events         events.Bus
+	gitProvider    git.Provider
+	worktrees      *git.WorktreeManager
+	agents         agents.Factory
+	orchestrator   *orchestrator.Orchestrator
+	publicRoutes   map[*mux.Route]bool
 }
 
-func NewServer(sessionManager *session.MemoryManager, ptyManager pty.Manager) *Server {
+// Deps bundles the components the server is built on
+type Deps struct {
+	Sessions   *session.MemoryManager
+	PTYs       pty.Manager
+	Recordings *recording.Store
+	Policy     *policy.Policy
+	Jobs       *jobs.Manager
+	Events     events.Bus
+	Git        git.Provider
+	Worktrees  *git.WorktreeManager
+	Agents     agents.Factory
+	Tasks      *orchestrator.Orchestrator
+}
+
+func NewServer(deps Deps) *Server {
 	s := &Server{
-		router:        mux.NewRouter(),
-		sessionManager: sessionManager,
-		ptyManager:    ptyManager,
+		router:         mux.NewRouter(),
+		sessionManager: deps.Sessions,
+		ptyManager:     deps.PTYs,
+		recordings:     deps.Recordings,
+		policy:         deps.Policy,
+		jobs:           deps.Jobs,
+		events:         deps.Events,
+		gitProvider:    deps.Git,
+		worktrees:      deps.Worktrees,
+		agents:         deps.Agents,
+		orchestrator:   deps.Tasks,
+		publicRoutes:   make(map[*mux.Route]bool),
 	}
 
 	s.setupRoutes()
@@ -35,34 +78,73 @@ func NewServer(sessionManager *session.MemoryManager, ptyManager pty.Manager) *S
 
 func (s *Server) setupRoutes() {
 	// Health check
-	s.router.HandleFunc("/healthz", s.healthCheck).Methods("GET")
+	s.public(s.router.HandleFunc("/healthz", s.healthCheck).Methods("GET"))
 
 	// API routes
 	api := s.router.PathPrefix("/api").Subrouter()
 	
 	// Session routes
-	api.HandleFunc("/session", s.createSession).Methods("POST")
+	s.public(api.HandleFunc("/session", s.createSession).Methods("POST"))
+
+	// Repository routes
+	s.public(api.HandleFunc("/repos", s.listRepos).Methods("GET"))
 	api.HandleFunc("/session/{id}", s.getSession).Methods("GET")
 	
 	// Task routes
 	api.HandleFunc("/tasks", s.createTask).Methods("POST")
 	api.HandleFunc("/tasks/{id}", s.getTask).Methods("GET")
 	api.HandleFunc("/tasks/{id}/patches", s.getTaskPatches).Methods("GET")
+	api.HandleFunc("/tasks/{id}/patches/refresh", s.refreshTaskPatches).Methods("POST")
 	api.HandleFunc("/tasks/{id}/apply", s.applyTaskPatches).Methods("POST")
+	api.HandleFunc("/tasks/{id}/revert", s.revertTask).Methods("POST")
+	api.HandleFunc("/tasks/{id}/push", s.pushTask).Methods("POST")
+	api.HandleFunc("/tasks/{id}/format-patch", s.formatPatch).Methods("GET")
+	api.HandleFunc("/tasks/{id}/comments", s.addTaskComment).Methods("POST")
+	api.HandleFunc("/tasks/{id}/comments", s.listTaskComments).Methods("GET")
+	api.HandleFunc("/tasks/{id}/request-changes", s.requestChanges).Methods("POST")
+	api.HandleFunc("/tasks/{id}/cancel", s.cancelTask).Methods("POST")
+	api.HandleFunc("/tasks/{id}/pause", s.pauseTask).Methods("POST")
+	api.HandleFunc("/tasks/{id}/resume", s.resumeTask).Methods("POST")
+	api.HandleFunc("/tasks/{id}/transcript", s.getTaskTranscript).Methods("GET")
+	api.HandleFunc("/tasks/{id}/discard", s.discardTask).Methods("POST")
+	api.HandleFunc("/worktrees", s.listWorktrees).Methods("GET")
 	
 	// Command routes
 	api.HandleFunc("/cmd", s.runCommand).Methods("POST")
+	api.HandleFunc("/jobs", s.listJobs).Methods("GET")
+	api.HandleFunc("/jobs/{id}", s.getJob).Methods("GET")
+	api.HandleFunc("/jobs/{id}/log", s.getJobLog).Methods("GET")
+	api.HandleFunc("/jobs/{id}/kill", s.killJob).Methods("POST")
 	
 	// Git routes
 	api.HandleFunc("/git/diff", s.getGitDiff).Methods("GET")
+	api.HandleFunc("/git/status", s.getGitStatus).Methods("GET")
+	api.HandleFunc("/git/branches", s.getGitBranches).Methods("GET")
+	api.HandleFunc("/git/log", s.getGitLog).Methods("GET")
+
+	// PTY routes
+	api.HandleFunc("/pty", s.listPtys).Methods("GET")
+	api.HandleFunc("/pty/{id}/rename", s.renamePty).Methods("POST")
+	api.HandleFunc("/pty/{id}/kill", s.killPty).Methods("POST")
+
+	// Recording routes
+	api.HandleFunc("/recordings", s.listRecordings).Methods("GET")
+	api.HandleFunc("/recordings/{id}", s.getRecording).Methods("GET")
 	
 	// WebSocket endpoints
 	s.router.HandleFunc("/ws/pty", s.handlePtyWebSocket)
 	s.router.HandleFunc("/ws/events", s.handleEventsWebSocket)
+	s.router.HandleFunc("/ws/recordings/{id}", s.handleRecordingWebSocket)
 	
 	// CORS middleware
 	s.router.Use(s.corsMiddleware)
 	s.router.Use(s.loggingMiddleware)
+	s.router.Use(s.authMiddleware)
+}
+
+// public exempts a route from authentication
+func (s *Server) public(route *mux.Route) {
+	s.publicRoutes[route] = true
 }
 
 func (s *Server) ListenAndServe() error {
@@ -75,6 +157,10 @@ type SessionCreateRequest struct {
 	Repo  string `json:"repo"`
 	Label string `json:"label,omitempty"`
 	Via   string `json:"via,omitempty"`
+
+	// RepoID picks a repository by the ID GET /api/repos lists, instead of
+	// its path
+	RepoID string `json:"repoId,omitempty"`
 }
 
 type SessionCreateResponse struct {
@@ -90,6 +176,8 @@ type TaskStartRequest struct {
 	Branch      string                 `json:"branch,omitempty"`
 	Context     map[string]interface{} `json:"context,omitempty"`
 	Agent       string                 `json:"agent,omitempty"`
+	// MaxRuntimeSeconds stops the agent early; it is capped by TASK_MAX_SECONDS
+	MaxRuntimeSeconds int `json:"maxRuntimeSeconds,omitempty"`
 }
 
 type TaskStatusResponse struct {
@@ -100,24 +188,40 @@ type TaskStatusResponse struct {
 }
 
 type PatchesResponse struct {
-	Patches []FilePatch `json:"patches"`
+	Patches []git.FilePatch `json:"patches"`
+	Version int             `json:"version,omitempty"` // task patch version
 }
 
-type FilePatch struct {
-	File    string `json:"file"`
-	Content string `json:"content"`
-	Type    string `json:"type"`
+type ApplyRequest struct {
+	Select        []HunkSelection `json:"select"`
+	CommitMessage string          `json:"commitMessage"`
 }
 
-type ApplyRequest struct {
-	Select       []interface{} `json:"select"`
-	CommitMessage string        `json:"commitMessage"`
+// RevertRequest undoes a task's applied commits. Mode is "revert" (the
+// default) or "reset".
+type RevertRequest struct {
+	Mode          string `json:"mode"`
+	CommitMessage string `json:"commitMessage"`
+}
+
+// CancelRequest stops a task's agent. The task's worktree is removed unless
+// KeepWorkspace is set; its branch stays either way.
+type CancelRequest struct {
+	KeepWorkspace bool   `json:"keepWorkspace"`
+	Reason        string `json:"reason"`
+}
+
+// HunkSelection picks hunks of one file in a task's patches by index
+type HunkSelection struct {
+	File  string `json:"file"`
+	Hunks []int  `json:"hunks"`
 }
 
 type CmdRequest struct {
 	Cmd       string `json:"cmd"`
 	Cwd       string `json:"cwd"`
 	TimeoutMs int    `json:"timeoutMs,omitempty"`
+	TaskID    string `json:"taskId,omitempty"`
 }
 
 // Handlers
@@ -133,12 +237,30 @@ func (s *Server) createSession(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Validate repo path - for now, just check it's not empty
+	if req.RepoID != "" {
+		path, ok := s.repoByID(req.RepoID)
+		if !ok {
+			http.Error(w, "Repository not allowed", http.StatusForbidden)
+			return
+		}
+		req.Repo = path
+	}
 	if req.Repo == "" {
 		http.Error(w, "Repository path required", http.StatusBadRequest)
 		return
 	}
 
+	repo, err := filepath.Abs(req.Repo)
+	if err != nil || !s.policy.IsRepoAllowed(repo) {
+		http.Error(w, "Repository not allowed", http.StatusForbidden)
+		return
+	}
+	if _, err := git.WorkTreeRoot(r.Context(), repo); err != nil {
+		http.Error(w, "Repository is not a git work tree", http.StatusBadRequest)
+		return
+	}
+	req.Repo = repo
+
 	// Create session using existing session manager
 	sessionID, token, err := s.sessionManager.CreateSession(req.Repo, req.Label, req.Via)
 	if err != nil {
@@ -182,8 +304,14 @@ func (s *Server) getSession(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	sessionID := vars["id"]
 
-	session, err := s.sessionManager.GetSession(sessionID)
+	callerID, err := auth.GetSessionIDFromRequest(r)
 	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	session, err := s.sessionManager.GetSession(sessionID)
+	if err != nil || sessionID != callerID {
 		http.Error(w, "Session not found", http.StatusNotFound)
 		return
 	}
@@ -206,6 +334,17 @@ func (s *Server) createTask(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	sess, err := s.sessionManager.GetSession(sessionID)
+	if err != nil {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+
+	if _, err := s.agents.For(req.Agent); err != nil {
+		http.Error(w, "Unknown agent: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	// Create task
 	taskID, err := s.sessionManager.CreateTask(sessionID, req.Instruction, req.Branch, req.Context, req.Agent)
 	if err != nil {
@@ -213,10 +352,38 @@ func (s *Server) createTask(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The task works in its own checkout so it cannot trample the user's
+	// or another task's changes
+	worktree, err := s.worktrees.Create(r.Context(), sess.Repo, sessionID, taskID, req.Branch)
+	if err != nil {
+		log.Printf("Failed to create worktree for task %s: %v", taskID, err)
+		s.sessionManager.TransitionTask(taskID, session.StatusFailed, "failed to create worktree: "+err.Error())
+		status := http.StatusInternalServerError
+		if errors.Is(err, git.ErrDiskCap) {
+			status = http.StatusInsufficientStorage
+		}
+		http.Error(w, "Failed to create worktree: "+err.Error(), status)
+		return
+	}
+	s.sessionManager.SetTaskWorktree(taskID, worktree.Path, worktree.Branch, worktree.Commit)
+
+	// A task whose agent fails to start is marked failed and reported as such
+	maxRuntime := time.Duration(req.MaxRuntimeSeconds) * time.Second
+	if err := s.orchestrator.Start(taskID, req.Instruction, worktree.Path, maxRuntime); err != nil {
+		log.Printf("Failed to start agent for task %s: %v", taskID, err)
+	}
+	task, err := s.sessionManager.GetTask(taskID)
+	if err != nil {
+		http.Error(w, "Task not found", http.StatusNotFound)
+		return
+	}
+
 	response := map[string]interface{}{
 		"taskId": taskID,
-		"status": "planning",
-		"startedAt": time.Now().Format(time.RFC3339),
+		"status": task.Status,
+		"startedAt": task.CreatedAt.Format(time.RFC3339),
+		"branch": worktree.Branch,
+		"worktree": worktree.Path,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -225,166 +392,621 @@ func (s *Server) createTask(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) getTask(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	taskID := vars["id"]
-
-	task, err := s.sessionManager.GetTask(taskID)
-	if err != nil {
-		http.Error(w, "Task not found", http.StatusNotFound)
+	task, ok := s.ownedTask(w, r)
+	if !ok {
 		return
 	}
+	taskID := task.ID
 
 	response := map[string]interface{}{
-		"taskId":    taskID,
-		"status":    task.Status,
-		"startedAt": task.CreatedAt.Format(time.RFC3339),
-		"endedAt":   task.UpdatedAt.Format(time.RFC3339),
+		"taskId":      taskID,
+		"status":      task.Status,
+		"branch":      task.Branch,
+		"agent":       task.Agent,
+		"startedAt":   task.CreatedAt.Format(time.RFC3339),
+		"transitions": task.Transitions,
+		"patchVersion": task.PatchVersion,
+	}
+	if endedAt := task.EndedAt(); endedAt != nil {
+		response["endedAt"] = endedAt.Format(time.RFC3339)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
 
+// getTaskPatches returns a task's latest harvested patches. The response
+// carries the patch version, also sent as the ETag, so a client can ask for
+// the patches only if they changed since it last looked.
 func (s *Server) getTaskPatches(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	taskID := vars["id"]
+	task, ok := s.ownedTask(w, r)
+	if !ok {
+		return
+	}
 
-	patches, err := s.sessionManager.GetTaskPatches(taskID)
+	s.writeTaskPatches(w, r, task.ID)
+}
+
+// refreshTaskPatches harvests a task's changes from its worktree, even while
+// its agent is still at work, and returns the resulting patches
+func (s *Server) refreshTaskPatches(w http.ResponseWriter, r *http.Request) {
+	task, ok := s.ownedTask(w, r)
+	if !ok {
+		return
+	}
+	if _, exists := s.worktrees.Get(task.ID); !exists {
+		http.Error(w, "Task has no workspace", http.StatusConflict)
+		return
+	}
+
+	if _, err := s.orchestrator.Harvest(r.Context(), task.ID); err != nil {
+		if errors.Is(err, orchestrator.ErrNoWorkspace) {
+			http.Error(w, "Task has no workspace", http.StatusConflict)
+			return
+		}
+		log.Printf("Failed to harvest changes of task %s: %v", task.ID, err)
+		http.Error(w, "Failed to harvest changes", http.StatusInternalServerError)
+		return
+	}
+
+	s.writeTaskPatches(w, r, task.ID)
+}
+
+// writeTaskPatches sends a task's patches, or Not Modified if the client
+// already has their version
+func (s *Server) writeTaskPatches(w http.ResponseWriter, r *http.Request, taskID string) {
+	task, err := s.sessionManager.GetTask(taskID)
 	if err != nil {
 		http.Error(w, "Failed to get patches", http.StatusInternalServerError)
 		return
 	}
 
+	etag := fmt.Sprintf(`"%d"`, task.PatchVersion)
+	w.Header().Set("ETag", etag)
+	if r.Method == http.MethodGet && r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
 	// Convert to the expected format
-	filePatches := make([]FilePatch, len(patches))
-	for i, patch := range patches {
-		filePatches[i] = FilePatch{
+	filePatches := make([]git.FilePatch, len(task.Patches))
+	for i, patch := range task.Patches {
+		hunks, err := git.ParseHunks(patch.Patch)
+		if err != nil {
+			log.Printf("Failed to parse patch for %s in task %s: %v", patch.File, task.ID, err)
+			hunks = []git.Hunk{}
+		}
+		kind := patch.Type
+		if kind == "" {
+			kind = "modified"
+		}
+		filePatches[i] = git.FilePatch{
 			File:    patch.File,
 			Content: patch.Patch,
-			Type:    "modified",
+			Type:    kind,
+			Hunks:   hunks,
 		}
 	}
 
 	response := PatchesResponse{
 		Patches: filePatches,
+		Version: task.PatchVersion,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
 
+// applyTaskPatches commits the selected hunks of a task's patches onto the
+// task branch. Nothing is committed unless every selected file applies; the
+// per-file results say which did not. Files changed since their patch was
+// made are merged, and the results list the hunks that conflicted.
 func (s *Server) applyTaskPatches(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	taskID := vars["id"]
+	task, ok := s.ownedTask(w, r)
+	if !ok {
+		return
+	}
+	taskID := task.ID
 
 	var req ApplyRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Select) == 0 {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
+	if task.Status != session.StatusApplied && !session.CanTransition(task.Status, session.StatusApplied) {
+		http.Error(w, "Task cannot be applied while "+task.Status, http.StatusConflict)
+		return
+	}
+
+	sess, err := s.sessionManager.GetSession(task.SessionID)
+	if err != nil {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+
+	patches, err := s.sessionManager.GetTaskPatches(taskID)
+	if err != nil {
+		http.Error(w, "Failed to get patches", http.StatusInternalServerError)
+		return
+	}
+	byPath := make(map[string]int, len(patches))
+	for i, patch := range patches {
+		byPath[patch.File] = i
+	}
 
-	// Convert interface{} to map[string]interface{}
-	selections := make([]map[string]interface{}, len(req.Select))
-	for i, item := range req.Select {
-		if mapItem, ok := item.(map[string]interface{}); ok {
-			selections[i] = mapItem
+	// The app sends one entry per hunk, so selections of a file are merged
+	var selections []git.PatchSelection
+	byFile := make(map[string]int)
+	for _, sel := range req.Select {
+		p, ok := byPath[sel.File]
+		if !ok {
+			http.Error(w, fmt.Sprintf("No patch for %s in this task", sel.File), http.StatusBadRequest)
+			return
+		}
+		if i, seen := byFile[sel.File]; seen {
+			selections[i].Hunks = append(selections[i].Hunks, sel.Hunks...)
+			continue
 		}
+		byFile[sel.File] = len(selections)
+		selections = append(selections, git.PatchSelection{
+			File:    sel.File,
+			Content: patches[p].Patch,
+			Hunks:   append([]int{}, sel.Hunks...),
+			Blob:    patches[p].Blob,
+		})
 	}
 
-	if err := s.sessionManager.ApplyTaskPatches(taskID, selections, req.CommitMessage); err != nil {
-		http.Error(w, "Failed to apply patches", http.StatusInternalServerError)
+	message := req.CommitMessage
+	if strings.TrimSpace(message) == "" {
+		message = fmt.Sprintf("Apply changes from task %s", taskID)
+	}
+
+	result, err := s.gitProvider.ApplySelection(r.Context(), sess.Repo, selections, message, task.Branch)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, git.ErrApplyFailed) || errors.Is(err, git.ErrBranchMoved) {
+			status = http.StatusConflict
+		}
+		log.Printf("Apply failed for task %s: %v", taskID, err)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"ok":     false,
+			"error":  err.Error(),
+			"branch": result.Branch,
+			"files":  result.Files,
+		})
 		return
 	}
 
+	if err := s.sessionManager.RecordTaskCommit(taskID, result.Commit); err != nil {
+		log.Printf("Failed to record commit for task %s: %v", taskID, err)
+	}
+
+	// The commit stays on the task branch, so once every change went in the
+	// checkout is no longer needed. Changes left out still live only there.
+	remaining := make(map[string]string, len(patches))
+	for _, patch := range patches {
+		remaining[patch.File] = patch.Patch
+	}
+	if result.Covers(remaining) {
+		if err := s.worktrees.Remove(r.Context(), taskID, false); err != nil && !errors.Is(err, git.ErrNoWorktree) {
+			log.Printf("Failed to prune worktree of task %s: %v", taskID, err)
+		}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"ok": true,
-		"commit": "mock-commit-hash",
-		"branch": "main",
+		"ok":     true,
+		"commit": result.Commit,
+		"branch": result.Branch,
+		"parent": result.Parent,
+		"files":  result.Files,
 	})
 }
 
-func (s *Server) runCommand(w http.ResponseWriter, r *http.Request) {
-	var req CmdRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+// revertTask undoes the commits a task applied, with a revert commit or by
+// resetting the task branch
+func (s *Server) revertTask(w http.ResponseWriter, r *http.Request) {
+	task, ok := s.ownedTask(w, r)
+	if !ok {
+		return
+	}
+
+	var req RevertRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
+	if req.Mode == "" {
+		req.Mode = git.RevertCommit
+	}
+	if req.Mode != git.RevertCommit && req.Mode != git.RevertReset {
+		http.Error(w, "Mode must be revert or reset", http.StatusBadRequest)
+		return
+	}
+	if task.Status != session.StatusApplied || len(task.Commits) == 0 {
+		http.Error(w, "Task has no applied commits", http.StatusConflict)
+		return
+	}
+
+	sess, err := s.sessionManager.GetSession(task.SessionID)
+	if err != nil {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+
+	message := req.CommitMessage
+	if strings.TrimSpace(message) == "" {
+		message = fmt.Sprintf("Revert changes from task %s", task.ID)
+	}
+
+	result, err := s.gitProvider.Revert(r.Context(), sess.Repo, task.Branch, task.Commits, req.Mode, message)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, git.ErrDirtyWorkTree) || errors.Is(err, git.ErrLaterCommits) || errors.Is(err, git.ErrBranchMoved) {
+			status = http.StatusConflict
+		}
+		log.Printf("Revert failed for task %s: %v", task.ID, err)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"ok":       false,
+			"error":    err.Error(),
+			"branch":   result.Branch,
+			"blocking": result.Blocking,
+		})
+		return
+	}
+
+	s.sessionManager.RecordTaskRevert(task.ID, session.Revert{
+		Mode:       result.Mode,
+		Commit:     result.Commit,
+		Head:       result.Head,
+		RevertedAt: time.Now(),
+	})
 
-	// For now, just return 202 accepted
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusAccepted)
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"ok": true,
-		"code": 0,
+		"ok":       true,
+		"mode":     result.Mode,
+		"commit":   result.Commit,
+		"head":     result.Head,
+		"previous": result.Previous,
+		"branch":   result.Branch,
+		"files":    result.Files,
+	})
+}
+
+// cancelTask stops a task's agent along with everything it started, keeping
+// the changes it made so far as the task's patches
+func (s *Server) cancelTask(w http.ResponseWriter, r *http.Request) {
+	task, ok := s.ownedTask(w, r)
+	if !ok {
+		return
+	}
+
+	var req CancelRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	reason := strings.TrimSpace(req.Reason)
+	if reason == "" {
+		reason = "cancelled by user"
+	}
+
+	if err := s.orchestrator.Cancel(task.ID, reason); err != nil {
+		if errors.Is(err, session.ErrInvalidTransition) {
+			http.Error(w, "Task cannot be cancelled while "+task.Status, http.StatusConflict)
+			return
+		}
+		http.Error(w, "Failed to cancel task", http.StatusInternalServerError)
+		return
+	}
+
+	if !req.KeepWorkspace {
+		if err := s.worktrees.Remove(r.Context(), task.ID, false); err != nil && !errors.Is(err, git.ErrNoWorktree) {
+			log.Printf("Failed to remove worktree of task %s: %v", task.ID, err)
+		}
+	}
+
+	patches, _ := s.sessionManager.GetTaskPatches(task.ID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"ok":            true,
+		"status":        session.StatusCancelled,
+		"patches":       len(patches),
+		"keepWorkspace": req.KeepWorkspace,
 	})
 }
 
+// pauseTask freezes a running task's agent and everything it started
+func (s *Server) pauseTask(w http.ResponseWriter, r *http.Request) {
+	s.signalTask(w, r, s.orchestrator.Pause)
+}
+
+// resumeTask lets a paused task's agent carry on
+func (s *Server) resumeTask(w http.ResponseWriter, r *http.Request) {
+	s.signalTask(w, r, s.orchestrator.Resume)
+}
+
+// signalTask pauses or resumes the task named in the route
+func (s *Server) signalTask(w http.ResponseWriter, r *http.Request, signal func(taskID string) error) {
+	task, ok := s.ownedTask(w, r)
+	if !ok {
+		return
+	}
+
+	if err := signal(task.ID); err != nil {
+		if errors.Is(err, session.ErrInvalidTransition) || errors.Is(err, orchestrator.ErrNotRunning) {
+			http.Error(w, "Task agent is not running", http.StatusConflict)
+			return
+		}
+		log.Printf("Failed to signal agent of task %s: %v", task.ID, err)
+		http.Error(w, "Failed to signal agent", http.StatusInternalServerError)
+		return
+	}
+
+	task, _ = s.sessionManager.GetTask(task.ID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"ok":     true,
+		"status": task.Status,
+	})
+}
+
+// discardTask throws away a task's worktree and branch
+func (s *Server) discardTask(w http.ResponseWriter, r *http.Request) {
+	task, ok := s.ownedTask(w, r)
+	if !ok {
+		return
+	}
+
+	if !session.CanTransition(task.Status, session.StatusDiscarded) {
+		http.Error(w, "Task cannot be discarded while "+task.Status, http.StatusConflict)
+		return
+	}
+
+	if err := s.worktrees.Remove(r.Context(), task.ID, true); err != nil && !errors.Is(err, git.ErrNoWorktree) {
+		http.Error(w, "Failed to remove worktree", http.StatusInternalServerError)
+		return
+	}
+	s.sessionManager.TransitionTask(task.ID, session.StatusDiscarded, "discarded by user")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"ok": true})
+}
+
+func (s *Server) listWorktrees(w http.ResponseWriter, r *http.Request) {
+	sessionID, err := auth.GetSessionIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"worktrees": s.worktrees.List(sessionID),
+	})
+}
+
+// ownedTask looks up the task named in the route, writing an error response
+// unless it belongs to the caller's session
+func (s *Server) ownedTask(w http.ResponseWriter, r *http.Request) (*session.Task, bool) {
+	sessionID, err := auth.GetSessionIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	task, err := s.sessionManager.GetTask(mux.Vars(r)["id"])
+	if err != nil || task.SessionID != sessionID {
+		http.Error(w, "Task not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	return task, true
+}
+
+// workDir returns where work for a session happens: the worktree of the
+// given task, or the session repo when taskID is empty
+func (s *Server) workDir(sessionID, taskID string) (string, error) {
+	if taskID == "" {
+		session, err := s.sessionManager.GetSession(sessionID)
+		if err != nil {
+			return "", errors.New("Session not found")
+		}
+		return session.Repo, nil
+	}
+
+	task, err := s.sessionManager.GetTask(taskID)
+	if err != nil || task.SessionID != sessionID {
+		return "", errors.New("Task not found")
+	}
+	worktree, ok := s.worktrees.Get(taskID)
+	if !ok {
+		return "", errors.New("Task has no worktree")
+	}
+	return worktree.Path, nil
+}
+
+// getGitDiff diffs the session repo, or a task's worktree when taskId is
+// given. Other query params: base and target refs,
+// path (repeatable), mode (all, staged or unstaged), context (lines) and
+// whitespace (ignore-all, ignore-change or ignore-eol).
 func (s *Server) getGitDiff(w http.ResponseWriter, r *http.Request) {
-	// Mock response
-	patches := []FilePatch{
-		{
-			File:    "README.md",
-			Content: "mock diff content",
-			Type:    "modified",
-		},
+	sessionID, err := auth.GetSessionIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
 	}
 
-	response := PatchesResponse{
-		Patches: patches,
+	query := r.URL.Query()
+	dir, err := s.workDir(sessionID, query.Get("taskId"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	opts := git.DiffOptions{
+		Base:       query.Get("base"),
+		Target:     query.Get("target"),
+		Paths:      query["path"],
+		Mode:       git.DiffMode(query.Get("mode")),
+		Whitespace: query.Get("whitespace"),
+	}
+	if v := query.Get("context"); v != "" {
+		opts.Context, err = strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "Invalid context", http.StatusBadRequest)
+			return
+		}
+	}
+	if err := opts.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	patches, err := s.gitProvider.Unified(r.Context(), dir, opts)
+	if err != nil {
+		log.Printf("Diff failed for session %s: %v", sessionID, err)
+		http.Error(w, "Failed to diff: "+err.Error(), http.StatusBadRequest)
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	json.NewEncoder(w).Encode(PatchesResponse{
+		Patches: patches,
+	})
 }
 
-// WebSocket handlers
-var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool {
-		return true
-	},
+// getGitStatus reports the branch, upstream divergence and changed files of
+// the session repo, or of a task's worktree with taskId
+func (s *Server) getGitStatus(w http.ResponseWriter, r *http.Request) {
+	sessionID, err := auth.GetSessionIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	dir, err := s.workDir(sessionID, r.URL.Query().Get("taskId"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	status, err := s.gitProvider.Status(r.Context(), dir)
+	if err != nil {
+		log.Printf("Status failed for session %s: %v", sessionID, err)
+		http.Error(w, "Failed to get status", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
 }
 
-func (s *Server) handlePtyWebSocket(w http.ResponseWriter, r *http.Request) {
-	conn, err := upgrader.Upgrade(w, r, nil)
+// getGitBranches lists the local and remote branches of the session repo
+func (s *Server) getGitBranches(w http.ResponseWriter, r *http.Request) {
+	sessionID, err := auth.GetSessionIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	dir, err := s.workDir(sessionID, "")
 	if err != nil {
-		log.Printf("WebSocket upgrade failed: %v", err)
+		http.Error(w, err.Error(), http.StatusNotFound)
 		return
 	}
-	defer conn.Close()
 
-	// Send mock data
-	for i := 0; i < 3; i++ {
-		conn.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf("Mock output line %d\n", i+1)))
+	branches, err := s.gitProvider.Branches(r.Context(), dir)
+	if err != nil {
+		log.Printf("Listing branches failed for session %s: %v", sessionID, err)
+		http.Error(w, "Failed to list branches", http.StatusInternalServerError)
+		return
 	}
 
-	// Send exit message
-	conn.WriteJSON(map[string]interface{}{
-		"type": "exit",
-		"code": 0,
-		"durationMs": 1000,
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"branches": branches,
 	})
 }
 
-func (s *Server) handleEventsWebSocket(w http.ResponseWriter, r *http.Request) {
-	conn, err := upgrader.Upgrade(w, r, nil)
+// Page sizes for the git log
+const (
+	defaultCommitLimit = 50
+	maxCommitLimit     = 500
+)
+
+// getGitLog pages through the history of the session repo, or of a task's
+// worktree with taskId. Query params: ref, path (repeatable), since, skip
+// and limit.
+func (s *Server) getGitLog(w http.ResponseWriter, r *http.Request) {
+	sessionID, err := auth.GetSessionIDFromRequest(r)
 	if err != nil {
-		log.Printf("WebSocket upgrade failed: %v", err)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
-	defer conn.Close()
 
-	// Send mock events
-	events := []map[string]interface{}{
-		{"type": "status", "phase": "planning"},
-		{"type": "patch", "count": 1},
-		{"type": "exit", "code": 0},
+	query := r.URL.Query()
+	dir, err := s.workDir(sessionID, query.Get("taskId"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
 	}
 
-	for _, event := range events {
-		conn.WriteJSON(event)
-		time.Sleep(500 * time.Millisecond)
+	skip, err := queryInt64(r, "skip", 0)
+	if err != nil || skip < 0 {
+		http.Error(w, "Invalid skip", http.StatusBadRequest)
+		return
 	}
+	limit, err := queryInt64(r, "limit", defaultCommitLimit)
+	if err != nil || limit <= 0 {
+		http.Error(w, "Invalid limit", http.StatusBadRequest)
+		return
+	}
+	if limit > maxCommitLimit {
+		limit = maxCommitLimit
+	}
+
+	// One extra commit tells whether there is another page
+	entries, err := s.gitProvider.Log(r.Context(), dir, git.LogOptions{
+		Ref:   query.Get("ref"),
+		Paths: query["path"],
+		Since: query.Get("since"),
+		Skip:  int(skip),
+		Limit: int(limit) + 1,
+	})
+	if err != nil {
+		log.Printf("Log failed for session %s: %v", sessionID, err)
+		http.Error(w, "Failed to get log: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	hasMore := len(entries) > int(limit)
+	if hasMore {
+		entries = entries[:limit]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"commits":  entries,
+		"skip":     skip,
+		"limit":    limit,
+		"hasMore":  hasMore,
+		"nextSkip": skip + int64(len(entries)),
+	})
+}
+
+// WebSocket handlers
+var upgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool {
+		return true
+	},
 }
 
 // Middleware
@@ -424,9 +1046,47 @@ func (s *Server) loggingMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// authMiddleware requires a valid token for the session it names on every
+// route not marked public, and stores the session ID in the request context.
+// WebSocket clients pass the token as a query param; a sessionId param, if
+// given, must match it.
+func (s *Server) authMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if route := mux.CurrentRoute(r); route != nil && s.publicRoutes[route] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token, err := auth.TokenFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		sessionID, err := auth.ValidateToken(token)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if claimed := r.URL.Query().Get("sessionId"); claimed != "" && claimed != sessionID {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		// Tokens outlive sessions that have expired or were lost in a restart
+		if _, err := s.sessionManager.GetSession(sessionID); err != nil {
+			http.Error(w, "Session expired", http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(auth.WithSessionID(r.Context(), sessionID)))
+	})
+}
+
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
 	}
 	return defaultValue
 }
+
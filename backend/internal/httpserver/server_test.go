@@ -0,0 +1,66 @@
+package httpserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/PeterShin23/cockpit-coder/backend/internal/events"
+	"github.com/PeterShin23/cockpit-coder/backend/internal/session"
+)
+
+func TestAuthMiddleware(t *testing.T) {
+	sessions := session.NewMemoryManager()
+	s := NewServer(Deps{Sessions: sessions, Events: events.NewMemoryBus()})
+
+	owner, ownerToken, _ := sessions.CreateSession(t.TempDir(), "", "")
+	_, otherToken, _ := sessions.CreateSession(t.TempDir(), "", "")
+	taskID, err := sessions.CreateTask(owner, "fix it", "", nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		want   int
+	}{
+		{"public route", "GET", "/healthz", "", http.StatusOK},
+		{"missing token", "GET", "/api/tasks/" + taskID, "", http.StatusUnauthorized},
+		{"bad token", "GET", "/api/tasks/" + taskID, "nope", http.StatusUnauthorized},
+		{"owner", "GET", "/api/tasks/" + taskID, ownerToken, http.StatusOK},
+		{"other session", "GET", "/api/tasks/" + taskID, otherToken, http.StatusNotFound},
+		{"other session apply", "POST", "/api/tasks/" + taskID + "/apply", otherToken, http.StatusNotFound},
+		{"other session info", "GET", "/api/session/" + owner, otherToken, http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader("{}"))
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+			s.router.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("Expected %d, got %d: %s", tt.want, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestQueryTokenOnlyForWebSockets(t *testing.T) {
+	sessions := session.NewMemoryManager()
+	s := NewServer(Deps{Sessions: sessions, Events: events.NewMemoryBus()})
+	_, token, _ := sessions.CreateSession(t.TempDir(), "", "")
+
+	req := httptest.NewRequest("GET", "/api/session/x?token="+token, nil)
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected query token to be refused outside WebSockets, got %d", rec.Code)
+	}
+}
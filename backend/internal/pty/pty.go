@@ -1,88 +1,217 @@
 package pty
 
 import (
-	"bufio"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"log"
 	"os"
 	"os/exec"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
+	"unsafe"
 
 	"github.com/creack/pty"
 )
 
+// ErrNotFound is returned when a PTY ID is unknown to the manager
+var ErrNotFound = errors.New("pty not found")
+
 // Proc represents a running process
 type Proc interface {
+	ID() string
 	Write([]byte) (int, error)
 	Resize(cols, rows int) error
 	Close() error
-	Stream() <-chan []byte
+	Signal(sig syscall.Signal) error
+	Attach(viewerID string) *Attachment
 	Done() <-chan State
+	Dropped() uint64
+	Info() Info
 }
 
-// State represents the final state of a process
+// State represents the final state of a process. Err is the error of the
+// context the process was started with when that context stopped it, such
+// as context.DeadlineExceeded.
 type State struct {
 	ExitCode int
 	Err      error
 	Duration time.Duration
 }
 
+// Spec describes a process to start under a PTY
+type Spec struct {
+	Owner  string // session that owns the process
+	TaskID string // task the process works on, if any
+	Name   string
+	Cmd    string
+	Args   []string
+	Cwd    string
+	Env    []string
+	// KeepAlive exempts a running process from idle reaping, for processes
+	// such as task agents that nobody watches but something else bounds
+	KeepAlive bool
+}
+
+// Info is a snapshot of a managed process
+type Info struct {
+	ID          string    `json:"id"`
+	Owner       string    `json:"sessionId,omitempty"`
+	TaskID      string    `json:"taskId,omitempty"`
+	Name        string    `json:"name"`
+	Cmd         string    `json:"cmd"`
+	Args        []string  `json:"args,omitempty"`
+	Cwd         string    `json:"cwd"`
+	Cols        int       `json:"cols"`
+	Rows        int       `json:"rows"`
+	StartedAt   time.Time `json:"startedAt"`
+	LastActive  time.Time `json:"lastActive"`
+	Attached    bool      `json:"attached"`
+	Viewers     []string  `json:"viewers"`
+	InputHolder string    `json:"inputHolder,omitempty"`
+	Running     bool      `json:"running"`
+	ExitCode    *int      `json:"exitCode,omitempty"`
+}
+
+// Recorder receives a copy of a process's terminal traffic
+type Recorder interface {
+	Output(data []byte)
+	Input(data []byte)
+	Resize(cols, rows int)
+	Close() error
+}
+
+// RecorderFactory starts a recording for a newly spawned process
+type RecorderFactory func(Info) (Recorder, error)
+
 // Manager interface for PTY operations
 type Manager interface {
 	Start(ctx context.Context, cmd string, args []string, cwd string, env []string) (Proc, error)
+	Spawn(ctx context.Context, spec Spec) (Proc, error)
+	Get(id string) (Proc, bool)
+	List(owner string) []Info
+	Rename(id, name string) error
+	Kill(id string) error
 }
 
+const (
+	// readChunkSize is the largest chunk handed to a viewer in one read
+	readChunkSize = 32 * 1024
+	// streamBuffer bounds how many chunks may queue before reads stall
+	streamBuffer = 64
+	// scrollbackSize is how much recent output is kept for reattaching viewers
+	scrollbackSize = 256 * 1024
+)
+
 // managerImpl implements the Manager interface
 type managerImpl struct {
-	sessions map[string]*ptySession
-	mu       sync.RWMutex
+	sessions    map[string]*ptySession
+	mu          sync.RWMutex
+	idleTimeout time.Duration
+	record      RecorderFactory
 }
 
 // ptySession implements the Proc interface
 type ptySession struct {
-	ID       string
-	Cmd      *exec.Cmd
-	PtyFile  *os.File
-	Size     *pty.Winsize
-	StreamCh chan []byte
-	DoneCh   chan State
-	Cancel   context.CancelFunc
-	start    time.Time
+	id      string
+	spec    Spec
+	ctx     context.Context
+	Cmd     *exec.Cmd
+	PtyFile *os.File
+	Size    *pty.Winsize
+	start   time.Time
+
+	mu         sync.Mutex
+	scrollback *scrollback
+	recorder   Recorder
+	viewers    []*Attachment
+	nextViewer int
+	lease      Lease
+	lastActive time.Time
+	exited     chan struct{}
+	state      State
+	// reaping is set just before the exited process is waited on, after
+	// which its pid may be reused and must not be signalled
+	reaping bool
+
+	closed    chan struct{}
+	closeOnce sync.Once
+	dropped   atomic.Uint64
 }
 
-// NewManager creates a new PTY manager
-func NewManager() Manager {
-	return &managerImpl{
-		sessions: make(map[string]*ptySession),
+// NewManager creates a new PTY manager. Processes with no viewer attached
+// for longer than idleTimeout are reaped; zero disables reaping. When record
+// is set, every process is recorded through it.
+func NewManager(idleTimeout time.Duration, record RecorderFactory) Manager {
+	manager := &managerImpl{
+		sessions:    make(map[string]*ptySession),
+		idleTimeout: idleTimeout,
+		record:      record,
+	}
+
+	if idleTimeout > 0 {
+		go manager.reapIdle()
 	}
+
+	return manager
 }
 
 // Start creates and starts a new PTY process
 func (m *managerImpl) Start(ctx context.Context, cmd string, args []string, cwd string, env []string) (Proc, error) {
+	return m.Spawn(ctx, Spec{Cmd: cmd, Args: args, Cwd: cwd, Env: env})
+}
+
+// Spawn creates and starts a new PTY process described by spec
+func (m *managerImpl) Spawn(ctx context.Context, spec Spec) (Proc, error) {
 	// Create command
-	fullCmd := exec.CommandContext(ctx, cmd, args...)
-	fullCmd.Dir = cwd
-	if env != nil {
-		fullCmd.Env = append(os.Environ(), env...)
+	fullCmd := exec.CommandContext(ctx, spec.Cmd, spec.Args...)
+	fullCmd.Dir = spec.Cwd
+	if spec.Env != nil {
+		fullCmd.Env = append(os.Environ(), spec.Env...)
+	}
+	if spec.Name == "" {
+		spec.Name = spec.Cmd
+	}
+
+	// Create session
+	size := &pty.Winsize{Cols: 80, Rows: 24}
+	session := &ptySession{
+		id:         generateID(),
+		spec:       spec,
+		ctx:        ctx,
+		Cmd:        fullCmd,
+		Size:       size,
+		scrollback: newScrollback(scrollbackSize),
+		exited:     make(chan struct{}),
+		closed:     make(chan struct{}),
+	}
+
+	// The process leads its own session and process group under the PTY,
+	// so cancelling takes down everything it started along with it
+	fullCmd.Cancel = func() error {
+		return session.Signal(syscall.SIGKILL)
 	}
 
 	// Create PTY
-	ptyFile, err := pty.Start(fullCmd)
+	ptyFile, err := pty.StartWithSize(fullCmd, size)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create PTY: %v", err)
 	}
+	now := time.Now()
+	session.PtyFile = ptyFile
+	session.start = now
+	session.lastActive = now
 
-	// Create session
-	session := &ptySession{
-		ID:       generateID(),
-		Cmd:      fullCmd,
-		PtyFile:  ptyFile,
-		Size:     &pty.Winsize{Cols: 80, Rows: 24},
-		StreamCh: make(chan []byte, 1000),
-		DoneCh:   make(chan State, 1),
-		start:    time.Now(),
+	if m.record != nil {
+		recorder, err := m.record(session.Info())
+		if err != nil {
+			log.Printf("Failed to record PTY %s: %v", session.id, err)
+		} else {
+			session.recorder = recorder
+		}
 	}
 
 	// Start reading from PTY
@@ -90,89 +219,292 @@ func (m *managerImpl) Start(ctx context.Context, cmd string, args []string, cwd
 
 	// Store session
 	m.mu.Lock()
-	m.sessions[session.ID] = session
+	m.sessions[session.id] = session
 	m.mu.Unlock()
 
 	return session, nil
 }
 
-// readFromPty reads data from PTY and streams it
+// Get returns a managed process by ID
+func (m *managerImpl) Get(id string) (Proc, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	session, exists := m.sessions[id]
+	if !exists {
+		return nil, false
+	}
+	return session, true
+}
+
+// List returns the processes owned by a session, or all of them if owner is empty
+func (m *managerImpl) List(owner string) []Info {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	infos := make([]Info, 0, len(m.sessions))
+	for _, session := range m.sessions {
+		if owner != "" && session.spec.Owner != owner {
+			continue
+		}
+		infos = append(infos, session.Info())
+	}
+	return infos
+}
+
+// Rename changes the display name of a process
+func (m *managerImpl) Rename(id, name string) error {
+	m.mu.RLock()
+	session, exists := m.sessions[id]
+	m.mu.RUnlock()
+	if !exists {
+		return ErrNotFound
+	}
+
+	session.mu.Lock()
+	session.spec.Name = name
+	session.mu.Unlock()
+	return nil
+}
+
+// Kill stops a process and forgets it
+func (m *managerImpl) Kill(id string) error {
+	m.mu.Lock()
+	session, exists := m.sessions[id]
+	delete(m.sessions, id)
+	m.mu.Unlock()
+	if !exists {
+		return ErrNotFound
+	}
+
+	return session.Close()
+}
+
+// reapIdle periodically stops processes nobody has been attached to for
+// longer than the idle timeout, and forgets exited ones after the same delay
+func (m *managerImpl) reapIdle() {
+	interval := m.idleTimeout / 4
+	if interval <= 0 || interval > time.Minute {
+		interval = time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		var idle []*ptySession
+
+		m.mu.Lock()
+		for id, session := range m.sessions {
+			if session.idleFor() > m.idleTimeout {
+				delete(m.sessions, id)
+				idle = append(idle, session)
+			}
+		}
+		m.mu.Unlock()
+
+		for _, session := range idle {
+			session.Close()
+		}
+	}
+}
+
+// readFromPty reads raw chunks from the PTY and streams them as they arrive,
+// so prompts and partial lines are flushed without waiting for a newline
 func (s *ptySession) readFromPty() {
-	defer close(s.StreamCh)
-	defer close(s.DoneCh)
 	defer s.PtyFile.Close()
 
-	reader := bufio.NewReader(s.PtyFile)
+	buf := make([]byte, readChunkSize)
 	for {
-		// Read with timeout
-		s.PtyFile.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
-		line, err := reader.ReadBytes('\n')
+		n, err := s.PtyFile.Read(buf)
+		if n > 0 {
+			chunk := make([]byte, n)
+			copy(chunk, buf[:n])
+			s.deliver(chunk)
+		}
 		if err != nil {
-			if os.IsTimeout(err) {
-				continue
-			}
-			if err != io.EOF {
-				select {
-				case s.StreamCh <- []byte(fmt.Sprintf("\nError reading PTY: %v\n", err)):
-				default:
-				}
+			// Linux reports EIO on the master once the child side is gone
+			if err != io.EOF && !errors.Is(err, syscall.EIO) && !s.isClosed() {
+				s.deliver([]byte(fmt.Sprintf("\r\nError reading PTY: %v\r\n", err)))
 			}
 			// Process finished
 			s.handleProcessExit()
 			return
 		}
+	}
+}
+
+// deliver records a chunk in the scrollback and fans it out to every
+// attached viewer, blocking until each has taken it. While blocked no further
+// reads happen, so the kernel buffer fills and the child stalls on write
+// instead of losing output; the slowest viewer sets the pace. With no viewer
+// attached the chunk only goes to the scrollback. Chunks a viewer abandons
+// by detaching mid-delivery, or that are cut off by Close, count in Dropped.
+func (s *ptySession) deliver(chunk []byte) {
+	s.mu.Lock()
+	s.scrollback.Write(chunk)
+	if s.recorder != nil {
+		s.recorder.Output(chunk)
+	}
+	viewers := append([]*Attachment(nil), s.viewers...)
+	s.mu.Unlock()
+
+	for _, viewer := range viewers {
 		select {
-		case s.StreamCh <- line:
-		default:
-			// Channel full, drop data
+		case viewer.out <- chunk:
+		case <-viewer.gone:
+			s.dropped.Add(uint64(len(chunk)))
+		case <-s.closed:
+			s.dropped.Add(uint64(len(chunk)))
 		}
 	}
 }
 
+// isClosed reports whether Close has been called
+func (s *ptySession) isClosed() bool {
+	select {
+	case <-s.closed:
+		return true
+	default:
+		return false
+	}
+}
+
 // handleProcessExit handles process completion
 func (s *ptySession) handleProcessExit() {
 	duration := time.Since(s.start)
-	
+
+	// The process stays a zombie, and its pid taken, until it is reaped
+	if err := waitExited(s.Cmd.Process.Pid); err != nil {
+		log.Printf("Failed to wait for process %d: %v", s.Cmd.Process.Pid, err)
+	}
+	s.mu.Lock()
+	s.reaping = true
+	s.mu.Unlock()
+
 	// Get exit code
 	exitCode := 0
+	var stopped error
 	if err := s.Cmd.Wait(); err != nil {
 		if exitErr, ok := err.(*exec.ExitError); ok {
 			exitCode = exitErr.ExitCode()
 		} else {
 			exitCode = -1
 		}
+		// A process that failed once its context was done was killed by it
+		stopped = s.ctx.Err()
 	}
 
-	state := State{
+	s.mu.Lock()
+	s.state = State{
 		ExitCode: exitCode,
-		Err:      nil,
+		Err:      stopped,
 		Duration: duration,
 	}
+	close(s.exited)
+	for _, viewer := range s.viewers {
+		close(viewer.out)
+	}
+	if s.recorder != nil {
+		s.recorder.Close()
+	}
+	s.lastActive = time.Now()
+	s.mu.Unlock()
+}
+
+// idleFor reports how long the process has gone without a viewer. Running
+// processes kept alive never count as idle.
+func (s *ptySession) idleFor() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.viewers) > 0 || (s.spec.KeepAlive && !s.hasExited()) {
+		return 0
+	}
+	return time.Since(s.lastActive)
+}
+
+// ID returns the process identifier
+func (s *ptySession) ID() string {
+	return s.id
+}
+
+// Info returns a snapshot of the process
+func (s *ptySession) Info() Info {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	info := Info{
+		ID:          s.id,
+		Owner:       s.spec.Owner,
+		TaskID:      s.spec.TaskID,
+		Name:        s.spec.Name,
+		Cmd:         s.spec.Cmd,
+		Args:        s.spec.Args,
+		Cwd:         s.spec.Cwd,
+		Cols:        int(s.Size.Cols),
+		Rows:        int(s.Size.Rows),
+		StartedAt:   s.start,
+		LastActive:  s.lastActive,
+		Attached:    len(s.viewers) > 0,
+		Viewers:     make([]string, 0, len(s.viewers)),
+		InputHolder: s.lease.Holder,
+		Running:     true,
+	}
+	for _, viewer := range s.viewers {
+		info.Viewers = append(info.Viewers, viewer.ID)
+	}
 
 	select {
-	case s.DoneCh <- state:
+	case <-s.exited:
+		exitCode := s.state.ExitCode
+		info.Running = false
+		info.ExitCode = &exitCode
 	default:
 	}
+
+	return info
 }
 
-// Write writes data to the PTY
+// Write writes data to the PTY, bypassing the input lease. Viewers write
+// through their Attachment instead.
 func (s *ptySession) Write(data []byte) (int, error) {
+	s.mu.Lock()
+	s.lastActive = time.Now()
+	if s.recorder != nil {
+		s.recorder.Input(data)
+	}
+	s.mu.Unlock()
+
 	return s.PtyFile.Write(data)
 }
 
 // Resize resizes the PTY
 func (s *ptySession) Resize(cols, rows int) error {
+	s.mu.Lock()
 	s.Size = &pty.Winsize{Cols: uint16(cols), Rows: uint16(rows)}
-	return pty.Setsize(s.PtyFile, s.Size)
+	size := s.Size
+	if s.recorder != nil {
+		s.recorder.Resize(cols, rows)
+	}
+	s.mu.Unlock()
+
+	return pty.Setsize(s.PtyFile, size)
 }
 
 // Close closes the PTY session
 func (s *ptySession) Close() error {
-	// Cancel the context to stop the command
+	s.closeOnce.Do(func() { close(s.closed) })
+
+	// Kill the process and everything it started, unless it has already
+	// been waited on and its pid may belong to someone else by now
 	if s.Cmd != nil && s.Cmd.Process != nil {
-		s.Cmd.Process.Kill()
+		s.mu.Lock()
+		if !s.reaping {
+			signalGroup(s.Cmd.Process, syscall.SIGKILL)
+		}
+		s.mu.Unlock()
 	}
-	
+
 	// Close the PTY file
 	if s.PtyFile != nil {
 		s.PtyFile.Close()
@@ -181,14 +513,72 @@ func (s *ptySession) Close() error {
 	return nil
 }
 
-// Stream returns the output stream channel
-func (s *ptySession) Stream() <-chan []byte {
-	return s.StreamCh
+// Signal sends sig to the process and everything it started, such as
+// SIGSTOP and SIGCONT to pause and resume them all
+func (s *ptySession) Signal(sig syscall.Signal) error {
+	if s.Cmd == nil || s.Cmd.Process == nil {
+		return ErrNotFound
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.reaping {
+		return os.ErrProcessDone
+	}
+	return signalGroup(s.Cmd.Process, sig)
+}
+
+// hasExited reports whether the process has been waited on
+func (s *ptySession) hasExited() bool {
+	select {
+	case <-s.exited:
+		return true
+	default:
+		return false
+	}
+}
+
+// waitExited blocks until the process has exited, without reaping it
+func waitExited(pid int) error {
+	const pPID = 1     // P_PID: wait for the process with the given pid
+	var info [128]byte // siginfo_t
+	for {
+		_, _, errno := syscall.Syscall6(syscall.SYS_WAITID, pPID, uintptr(pid), uintptr(unsafe.Pointer(&info[0])), syscall.WEXITED|syscall.WNOWAIT, 0, 0)
+		if errno != syscall.EINTR {
+			if errno != 0 {
+				return errno
+			}
+			return nil
+		}
+	}
 }
 
-// Done returns the completion channel
+// signalGroup signals the process group led by proc, falling back to proc
+// alone if the group is already gone
+func signalGroup(proc *os.Process, sig syscall.Signal) error {
+	if err := syscall.Kill(-proc.Pid, sig); err == nil {
+		return nil
+	}
+	return proc.Signal(sig)
+}
+
+// Done returns a channel that receives the final state once the process exits
 func (s *ptySession) Done() <-chan State {
-	return s.DoneCh
+	ch := make(chan State, 1)
+	go func() {
+		<-s.exited
+		s.mu.Lock()
+		ch <- s.state
+		s.mu.Unlock()
+		close(ch)
+	}()
+	return ch
+}
+
+// Dropped returns the number of output bytes viewers lost because they
+// detached or the session was closed before the bytes could be delivered
+func (s *ptySession) Dropped() uint64 {
+	return s.dropped.Load()
 }
 
 // generateID creates a random ID
@@ -0,0 +1,302 @@
+package pty
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestStreamFlushesPartialLines(t *testing.T) {
+	m := NewManager(0, nil)
+	proc, err := m.Start(context.Background(), "/bin/sh", []string{"-c", "sleep 0.2; printf 'prompt> '; sleep 1"}, t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer proc.Close()
+
+	a := proc.Attach("")
+	select {
+	case chunk := <-a.Output:
+		if !bytes.Contains(chunk, []byte("prompt> ")) {
+			t.Errorf("Expected partial line, got %q", chunk)
+		}
+	case <-time.After(700 * time.Millisecond):
+		t.Fatal("Partial line was not flushed before the process exited")
+	}
+}
+
+func TestStreamIsLossless(t *testing.T) {
+	m := NewManager(0, nil)
+	proc, err := m.Start(context.Background(), "/bin/sh", []string{"-c", "sleep 0.1; seq 1 20000"}, t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer proc.Close()
+
+	a := proc.Attach("")
+
+	// Let the process run well past the viewer buffer before reading
+	time.Sleep(300 * time.Millisecond)
+
+	var out bytes.Buffer
+	out.Write(a.Replay)
+	for chunk := range a.Output {
+		out.Write(chunk)
+	}
+
+	state := <-proc.Done()
+	if state.ExitCode != 0 {
+		t.Errorf("Expected exit code 0, got %d", state.ExitCode)
+	}
+	if lines := bytes.Count(out.Bytes(), []byte("\n")); lines != 20000 {
+		t.Errorf("Expected 20000 lines, got %d", lines)
+	}
+	if proc.Dropped() != 0 {
+		t.Errorf("Expected no dropped bytes, got %d", proc.Dropped())
+	}
+}
+
+func TestReattachReplaysScrollback(t *testing.T) {
+	m := NewManager(0, nil)
+	proc, err := m.Spawn(context.Background(), Spec{Owner: "sess", Cmd: "/bin/sh", Cwd: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Kill(proc.ID())
+
+	first := proc.Attach("")
+	first.Detach()
+
+	// Output produced while nobody is attached must not block the shell
+	proc.Write([]byte("echo detached-$((6*7))\n"))
+	time.Sleep(300 * time.Millisecond)
+
+	second := proc.Attach("")
+	defer second.Detach()
+	if !bytes.Contains(second.Replay, []byte("detached-42")) {
+		t.Errorf("Expected scrollback to contain output, got %q", second.Replay)
+	}
+
+	infos := m.List("sess")
+	if len(infos) != 1 || !infos[0].Attached || !infos[0].Running {
+		t.Errorf("Unexpected listing: %+v", infos)
+	}
+	if len(m.List("other")) != 0 {
+		t.Error("Expected no processes for another owner")
+	}
+}
+
+func TestReconnectReplacesViewer(t *testing.T) {
+	m := NewManager(0, nil)
+	proc, err := m.Start(context.Background(), "/bin/sh", nil, t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer proc.Close()
+
+	first := proc.Attach("")
+	second := proc.Attach(first.ID)
+	defer second.Detach()
+
+	select {
+	case <-first.Detached:
+	case <-time.After(time.Second):
+		t.Fatal("Expected first connection to be detached")
+	}
+	if second.ID != first.ID {
+		t.Errorf("Expected viewer ID %s to be resumed, got %s", first.ID, second.ID)
+	}
+	if holder := proc.Info().InputHolder; holder != second.ID {
+		t.Errorf("Expected resumed viewer to keep the lease, holder is %q", holder)
+	}
+}
+
+func TestFanOutToAllViewers(t *testing.T) {
+	m := NewManager(0, nil)
+	proc, err := m.Start(context.Background(), "/bin/sh", []string{"-c", "sleep 0.2; echo shared"}, t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer proc.Close()
+
+	viewers := []*Attachment{proc.Attach(""), proc.Attach("")}
+	for _, v := range viewers {
+		var out bytes.Buffer
+		for chunk := range v.Output {
+			out.Write(chunk)
+		}
+		if !bytes.Contains(out.Bytes(), []byte("shared")) {
+			t.Errorf("Viewer %s missed output, got %q", v.ID, out.Bytes())
+		}
+	}
+}
+
+func TestInputLeaseHandoff(t *testing.T) {
+	m := NewManager(0, nil)
+	proc, err := m.Start(context.Background(), "/bin/sh", nil, t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer proc.Close()
+
+	phone := proc.Attach("")
+	laptop := proc.Attach("")
+
+	if _, err := laptop.Write([]byte("true\n")); err != ErrNoInputLease {
+		t.Fatalf("Expected write without lease to fail, got %v", err)
+	}
+	if err := laptop.GrantInput(phone.ID); err != ErrNotLeaseHolder {
+		t.Errorf("Expected grant from non-holder to fail, got %v", err)
+	}
+
+	laptop.RequestInput()
+	if err := phone.GrantInput(laptop.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := laptop.Write([]byte("true\n")); err != nil {
+		t.Errorf("Expected holder to write, got %v", err)
+	}
+	if _, err := phone.Write([]byte("true\n")); err != ErrNoInputLease {
+		t.Errorf("Expected former holder to be refused, got %v", err)
+	}
+
+	if err := phone.RevokeInput(); err != nil {
+		t.Fatal(err)
+	}
+	if holder := proc.Info().InputHolder; holder != phone.ID {
+		t.Errorf("Expected lease back with grantor, holder is %q", holder)
+	}
+
+	// A departing holder hands the lease to the next viewer waiting for it
+	laptop.RequestInput()
+	phone.Detach()
+	if holder := proc.Info().InputHolder; holder != laptop.ID {
+		t.Errorf("Expected lease to pass to requester, holder is %q", holder)
+	}
+}
+
+func TestReapIdle(t *testing.T) {
+	m := NewManager(100*time.Millisecond, nil)
+	proc, err := m.Start(context.Background(), "/bin/sh", []string{"-c", "sleep 10"}, t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-proc.Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected orphaned process to be reaped")
+	}
+	if _, ok := m.Get(proc.ID()); ok {
+		t.Error("Expected reaped process to be forgotten")
+	}
+}
+
+func TestSignalReachesChildren(t *testing.T) {
+	dir := t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	m := NewManager(0, nil)
+	proc, err := m.Start(ctx, "/bin/sh", []string{"-c", "sleep 30 & echo $! > child.pid; sleep 30"}, dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer proc.Close()
+
+	var child int
+	for deadline := time.Now().Add(2 * time.Second); child == 0; time.Sleep(20 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("Child never started")
+		}
+		data, _ := os.ReadFile(filepath.Join(dir, "child.pid"))
+		child, _ = strconv.Atoi(strings.TrimSpace(string(data)))
+	}
+
+	waitState := func(want string) {
+		t.Helper()
+		for deadline := time.Now().Add(2 * time.Second); ; time.Sleep(20 * time.Millisecond) {
+			state := processState(child)
+			if strings.Contains(want, state) {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("Expected child state in %q, got %q", want, state)
+			}
+		}
+	}
+
+	if err := proc.Signal(syscall.SIGSTOP); err != nil {
+		t.Fatal(err)
+	}
+	waitState("T")
+	if err := proc.Signal(syscall.SIGCONT); err != nil {
+		t.Fatal(err)
+	}
+	waitState("SR")
+
+	// Cancelling kills the whole group, not just the shell
+	cancel()
+	select {
+	case <-proc.Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected the process to exit once cancelled")
+	}
+	waitState("ZX")
+
+	// Once waited on, the pid may be reused, so nothing is signalled
+	if err := proc.Signal(syscall.SIGCONT); !errors.Is(err, os.ErrProcessDone) {
+		t.Errorf("Expected ErrProcessDone after exit, got %v", err)
+	}
+}
+
+// processState returns the state letter of a process from /proc, or X if it
+// no longer exists
+func processState(pid int) string {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return "X"
+	}
+	// pid (comm) state ...
+	fields := strings.Fields(string(data[bytes.LastIndexByte(data, ')')+1:]))
+	if len(fields) == 0 {
+		return "X"
+	}
+	return fields[0]
+}
+
+func TestCloseKillsProcessThatLeftThePTY(t *testing.T) {
+	m := NewManager(0, nil)
+	proc, err := m.Start(context.Background(), "/bin/sh", []string{"-c", "exec >/dev/null 2>&1 </dev/null; sleep 30"}, t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The PTY reports the child side gone while the process still runs,
+	// so it must not count as reaped yet
+	time.Sleep(200 * time.Millisecond)
+	if err := proc.Signal(syscall.Signal(0)); err != nil {
+		t.Fatalf("Expected the running process to be signalled, got %v", err)
+	}
+
+	proc.Close()
+	select {
+	case state := <-proc.Done():
+		if state.ExitCode != -1 {
+			t.Errorf("Expected the process to be killed, got exit code %d", state.ExitCode)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected Close to kill the process")
+	}
+	if err := proc.Signal(syscall.SIGTERM); !errors.Is(err, os.ErrProcessDone) {
+		t.Errorf("Expected the reaped process not to be signalled, got %v", err)
+	}
+}
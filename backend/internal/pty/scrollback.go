@@ -0,0 +1,30 @@
+package pty
+
+import "unicode/utf8"
+
+// scrollback keeps the most recent output of a process, up to a byte limit
+type scrollback struct {
+	limit int
+	buf   []byte
+}
+
+func newScrollback(limit int) *scrollback {
+	return &scrollback{limit: limit}
+}
+
+// Write appends output, discarding the oldest bytes once over the limit
+func (s *scrollback) Write(p []byte) {
+	s.buf = append(s.buf, p...)
+	if over := len(s.buf) - s.limit; over > 0 {
+		// Don't start the replay in the middle of a multi-byte character
+		for over < len(s.buf) && !utf8.RuneStart(s.buf[over]) {
+			over++
+		}
+		s.buf = append(s.buf[:0:0], s.buf[over:]...)
+	}
+}
+
+// Bytes returns a copy of the retained output
+func (s *scrollback) Bytes() []byte {
+	return append([]byte(nil), s.buf...)
+}
@@ -0,0 +1,322 @@
+package recording
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/PeterShin23/cockpit-coder/backend/internal/pty"
+)
+
+// ErrNotFound is returned when a recording ID is unknown
+var ErrNotFound = errors.New("recording not found")
+
+// Meta identifies a recording and what it captured
+type Meta struct {
+	ID        string    `json:"id"`
+	SessionID string    `json:"sessionId,omitempty"`
+	TaskID    string    `json:"taskId,omitempty"`
+	Name      string    `json:"name,omitempty"`
+	Command   string    `json:"command,omitempty"`
+	Cols      int       `json:"cols"`
+	Rows      int       `json:"rows"`
+	StartedAt time.Time `json:"startedAt"`
+}
+
+// header is the first line of an asciicast v2 file. Cockpit-specific
+// metadata rides along under its own key, which players ignore.
+type header struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp"`
+	Command   string            `json:"command,omitempty"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+	Cockpit   Meta              `json:"cockpit"`
+}
+
+// Event is one asciicast v2 event: output ("o"), input ("i") or resize ("r")
+type Event struct {
+	Time float64
+	Code string
+	Data string
+}
+
+// Store keeps recordings as .cast files in a directory
+type Store struct {
+	dir string
+}
+
+// NewStore creates a store rooted at dir, creating it if needed
+func NewStore(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create recordings directory: %w", err)
+	}
+	return &Store{dir: dir}, nil
+}
+
+// Create starts a new recording
+func (s *Store) Create(meta Meta) (*Writer, error) {
+	f, err := os.OpenFile(s.path(meta.ID), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create recording: %w", err)
+	}
+
+	h := header{
+		Version:   2,
+		Width:     meta.Cols,
+		Height:    meta.Rows,
+		Timestamp: meta.StartedAt.Unix(),
+		Command:   meta.Command,
+		Title:     meta.Name,
+		Env:       map[string]string{"TERM": "xterm-256color", "SHELL": os.Getenv("SHELL")},
+		Cockpit:   meta,
+	}
+	line, err := json.Marshal(h)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to write recording header: %w", err)
+	}
+
+	return &Writer{f: f, start: meta.StartedAt}, nil
+}
+
+// Record starts a recording for a PTY process. It satisfies pty.RecorderFactory.
+func (s *Store) Record(info pty.Info) (pty.Recorder, error) {
+	command := strings.Join(append([]string{info.Cmd}, info.Args...), " ")
+	return s.Create(Meta{
+		ID:        info.ID,
+		SessionID: info.Owner,
+		TaskID:    info.TaskID,
+		Name:      info.Name,
+		Command:   command,
+		Cols:      info.Cols,
+		Rows:      info.Rows,
+		StartedAt: info.StartedAt,
+	})
+}
+
+// List returns recordings matching the filter, newest first
+func (s *Store) List(match func(Meta) bool) ([]Meta, error) {
+	paths, err := filepath.Glob(filepath.Join(s.dir, "*.cast"))
+	if err != nil {
+		return nil, err
+	}
+
+	metas := make([]Meta, 0, len(paths))
+	for _, path := range paths {
+		meta, err := readMeta(path)
+		if err != nil {
+			continue
+		}
+		if match == nil || match(meta) {
+			metas = append(metas, meta)
+		}
+	}
+
+	sort.Slice(metas, func(i, j int) bool {
+		return metas[i].StartedAt.After(metas[j].StartedAt)
+	})
+	return metas, nil
+}
+
+// Get returns the metadata of a recording
+func (s *Store) Get(id string) (Meta, error) {
+	if !validID(id) {
+		return Meta{}, ErrNotFound
+	}
+	meta, err := readMeta(s.path(id))
+	if os.IsNotExist(err) {
+		return Meta{}, ErrNotFound
+	}
+	return meta, err
+}
+
+// Open returns the raw asciicast file of a recording
+func (s *Store) Open(id string) (*os.File, error) {
+	if !validID(id) {
+		return nil, ErrNotFound
+	}
+	f, err := os.Open(s.path(id))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+func (s *Store) path(id string) string {
+	return filepath.Join(s.dir, id+".cast")
+}
+
+// validID rejects IDs that could escape the store directory
+func validID(id string) bool {
+	return id != "" && !strings.ContainsAny(id, `/\`) && !strings.HasPrefix(id, ".")
+}
+
+func readMeta(path string) (Meta, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Meta{}, err
+	}
+	defer f.Close()
+
+	line, err := bufio.NewReader(f).ReadBytes('\n')
+	if err != nil && err != io.EOF {
+		return Meta{}, err
+	}
+
+	var h header
+	if err := json.Unmarshal(line, &h); err != nil {
+		return Meta{}, fmt.Errorf("invalid recording header: %w", err)
+	}
+	return h.Cockpit, nil
+}
+
+// Writer appends events to a recording. It is safe for concurrent use.
+type Writer struct {
+	mu    sync.Mutex
+	f     *os.File
+	start time.Time
+
+	// Partial UTF-8 sequences held back until the rest of the character arrives
+	pendingOut []byte
+	pendingIn  []byte
+}
+
+// Output records bytes written by the process
+func (w *Writer) Output(data []byte) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.pendingOut = w.writeText("o", w.pendingOut, data)
+}
+
+// Input records bytes sent to the process
+func (w *Writer) Input(data []byte) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.pendingIn = w.writeText("i", w.pendingIn, data)
+}
+
+// Resize records a terminal size change
+func (w *Writer) Resize(cols, rows int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.write("r", fmt.Sprintf("%dx%d", cols, rows))
+}
+
+// Close finishes the recording
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.f == nil {
+		return nil
+	}
+	err := w.f.Close()
+	w.f = nil
+	return err
+}
+
+// writeText records data after any held-back bytes, and returns the
+// incomplete character at the end of it, if any, to hold back for next time.
+// Process output is read in raw chunks that may split a character, and
+// asciicast stores text.
+func (w *Writer) writeText(code string, pending, data []byte) []byte {
+	buf := append(pending, data...)
+
+	cut := len(buf)
+	for i := len(buf) - 1; i >= 0 && i >= len(buf)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(buf[i]) {
+			if !utf8.FullRune(buf[i:]) {
+				cut = i
+			}
+			break
+		}
+	}
+
+	if cut > 0 {
+		w.write(code, string(buf[:cut]))
+	}
+	return append([]byte(nil), buf[cut:]...)
+}
+
+// write appends one event; the caller holds w.mu
+func (w *Writer) write(code, data string) {
+	if w.f == nil {
+		return
+	}
+
+	elapsed := time.Since(w.start).Seconds()
+	line, err := json.Marshal([]interface{}{elapsed, code, data})
+	if err != nil {
+		return
+	}
+	w.f.Write(append(line, '\n'))
+}
+
+// Reader decodes the events of a recording
+type Reader struct {
+	scanner *bufio.Scanner
+	Meta    Meta
+}
+
+// NewReader reads the header from r and prepares to decode events
+func NewReader(r io.Reader) (*Reader, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, errors.New("empty recording")
+	}
+
+	var h header
+	if err := json.Unmarshal(scanner.Bytes(), &h); err != nil {
+		return nil, fmt.Errorf("invalid recording header: %w", err)
+	}
+	if h.Version != 2 {
+		return nil, fmt.Errorf("unsupported asciicast version %d", h.Version)
+	}
+
+	return &Reader{scanner: scanner, Meta: h.Cockpit}, nil
+}
+
+// Next returns the next event, or io.EOF at the end of the recording
+func (r *Reader) Next() (Event, error) {
+	for r.scanner.Scan() {
+		var raw []interface{}
+		if err := json.Unmarshal(r.scanner.Bytes(), &raw); err != nil || len(raw) != 3 {
+			// A recording still being written may end in a partial line
+			continue
+		}
+
+		t, ok1 := raw[0].(float64)
+		code, ok2 := raw[1].(string)
+		data, ok3 := raw[2].(string)
+		if !ok1 || !ok2 || !ok3 {
+			continue
+		}
+		return Event{Time: t, Code: code, Data: data}, nil
+	}
+
+	if err := r.scanner.Err(); err != nil {
+		return Event{}, err
+	}
+	return Event{}, io.EOF
+}
@@ -0,0 +1,81 @@
+package recording
+
+import (
+	"io"
+	"testing"
+	"time"
+)
+
+func TestRecordAndRead(t *testing.T) {
+	store, err := NewStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := store.Create(Meta{ID: "pty_1", SessionID: "sess", TaskID: "task", Cols: 80, Rows: 24, StartedAt: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A character split across two reads must come out whole
+	snowman := []byte("☃")
+	w.Output(append([]byte("a"), snowman[:1]...))
+	w.Output(append(snowman[1:], 'b'))
+	w.Input([]byte("ls\r"))
+	w.Resize(100, 30)
+	w.Close()
+
+	metas, err := store.List(func(m Meta) bool { return m.TaskID == "task" })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(metas) != 1 || metas[0].SessionID != "sess" {
+		t.Fatalf("Unexpected listing: %+v", metas)
+	}
+
+	f, err := store.Open("pty_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	reader, err := NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var events []Event
+	for {
+		event, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, event)
+	}
+
+	want := []Event{{Code: "o", Data: "a"}, {Code: "o", Data: "☃b"}, {Code: "i", Data: "ls\r"}, {Code: "r", Data: "100x30"}}
+	if len(events) != len(want) {
+		t.Fatalf("Expected %d events, got %+v", len(want), events)
+	}
+	for i, event := range events {
+		if event.Code != want[i].Code || event.Data != want[i].Data {
+			t.Errorf("Event %d: expected %s %q, got %s %q", i, want[i].Code, want[i].Data, event.Code, event.Data)
+		}
+		if i > 0 && event.Time < events[i-1].Time {
+			t.Errorf("Event %d goes back in time", i)
+		}
+	}
+}
+
+func TestRejectsPathIDs(t *testing.T) {
+	store, err := NewStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Open("../secret"); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
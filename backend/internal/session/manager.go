@@ -5,6 +5,7 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"errors"
+	"reflect"
 	"sync"
 	"time"
 
@@ -23,19 +24,49 @@ type Task struct {
 	CreatedAt   time.Time              `json:"createdAt"`
 	UpdatedAt   time.Time              `json:"updatedAt"`
 	Patches     []Patch                `json:"patches"`
+	Commits     []string               `json:"commits,omitempty"`
+	Worktree    string                 `json:"worktree,omitempty"`
+	Base        string                 `json:"base,omitempty"`
+	Reverts     []Revert               `json:"reverts,omitempty"`
+	Comments    []Comment              `json:"comments,omitempty"`
+	FollowUps   []FollowUp             `json:"followUps,omitempty"`
+	Transcript  []Message              `json:"transcript,omitempty"`
+	Transitions []Transition           `json:"transitions"`
+
+	// PatchVersion counts the changes to Patches, so clients can tell whether
+	// the patches moved on since they last looked
+	PatchVersion int `json:"patchVersion"`
 }
 
-// Patch represents a code patch
+// Revert records the undoing of a task's applied commits
+type Revert struct {
+	Mode       string    `json:"mode"`
+	Commits    []string  `json:"commits"`
+	Commit     string    `json:"commit,omitempty"`
+	Head       string    `json:"head"`
+	RevertedAt time.Time `json:"revertedAt"`
+}
+
+// Patch represents a code patch. Base and Blob record the commit and the
+// file's blob the patch was made against, so it can be merged if the file
+// changes before it is applied.
 type Patch struct {
 	File  string `json:"file"`
 	Patch string `json:"patch"`
+	Type  string `json:"type,omitempty"`
+	Base  string `json:"base,omitempty"`
+	Blob  string `json:"blob,omitempty"`
 }
 
 // MemoryManager handles session and task management
 type MemoryManager struct {
-	sessions map[string]*Session
-	tasks    map[string]*Task
-	mu       sync.RWMutex
+	sessions     map[string]*Session
+	tasks        map[string]*Task
+	onTransition func(Task, Transition)
+	mu           sync.RWMutex
+
+	// onEnd is called with the ID of every session that is ended or expires
+	onEnd func(sessionID string)
 }
 
 // NewMemoryManager creates a new in-memory session manager
@@ -103,26 +134,53 @@ func (m *MemoryManager) Touch(ctx context.Context, id string) error {
 // End removes a session
 func (m *MemoryManager) End(ctx context.Context, id string) error {
 	m.mu.Lock()
-	defer m.mu.Unlock()
-
+	_, exists := m.sessions[id]
 	delete(m.sessions, id)
+	onEnd := m.onEnd
+	m.mu.Unlock()
+
+	if exists && onEnd != nil {
+		onEnd(id)
+	}
 	return nil
 }
 
+// OnEnd sets a function called with the ID of every session that is ended
+// or removed on expiry, once it is gone
+func (m *MemoryManager) OnEnd(fn func(sessionID string)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.onEnd = fn
+}
+
 // cleanupExpiredSessions removes expired sessions periodically
 func (m *MemoryManager) cleanupExpiredSessions() {
 	ticker := time.NewTicker(10 * time.Minute)
 	defer ticker.Stop()
 
 	for range ticker.C {
-		m.mu.Lock()
-		now := time.Now()
-		for id, session := range m.sessions {
-			if now.After(session.ExpiresAt) {
-				delete(m.sessions, id)
-			}
+		m.removeExpired(time.Now())
+	}
+}
+
+// removeExpired removes the sessions that expired before now
+func (m *MemoryManager) removeExpired(now time.Time) {
+	m.mu.Lock()
+	var expired []string
+	for id, session := range m.sessions {
+		if now.After(session.ExpiresAt) {
+			delete(m.sessions, id)
+			expired = append(expired, id)
+		}
+	}
+	onEnd := m.onEnd
+	m.mu.Unlock()
+
+	if onEnd != nil {
+		for _, id := range expired {
+			onEnd(id)
 		}
-		m.mu.Unlock()
 	}
 }
 
@@ -200,15 +258,17 @@ func (m *MemoryManager) CreateTask(sessionID, instruction, branch string, contex
 		Branch:      branch,
 		Context:     context,
 		Agent:       agent,
-		Status:      "pending",
 		CreatedAt:   time.Now(),
 		UpdatedAt:   time.Now(),
 	}
 
 	m.tasks[taskID] = task
+	m.transitionLocked(task, StatusQueued, "created")
 	return taskID, nil
 }
 
+// GetTask returns a copy of a task, so it can be read while the task's
+// agent moves it along
 func (m *MemoryManager) GetTask(taskID string) (*Task, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
@@ -218,7 +278,8 @@ func (m *MemoryManager) GetTask(taskID string) (*Task, error) {
 		return nil, errors.New("task not found")
 	}
 
-	return task, nil
+	copied := *task
+	return &copied, nil
 }
 
 func (m *MemoryManager) GetTaskPatches(taskID string) ([]Patch, error) {
@@ -233,7 +294,9 @@ func (m *MemoryManager) GetTaskPatches(taskID string) ([]Patch, error) {
 	return task.Patches, nil
 }
 
-func (m *MemoryManager) ApplyTaskPatches(taskID string, selections []map[string]interface{}, commitMessage string) error {
+// SetTaskWorktree records the worktree and branch a task works in and the
+// commit the branch started at
+func (m *MemoryManager) SetTaskWorktree(taskID, path, branch, base string) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -242,15 +305,16 @@ func (m *MemoryManager) ApplyTaskPatches(taskID string, selections []map[string]
 		return errors.New("task not found")
 	}
 
-	// In a real implementation, this would apply the patches to the actual code
-	// For now, we'll just update the task status
-	task.Status = "completed"
+	task.Worktree = path
+	task.Branch = branch
+	task.Base = base
 	task.UpdatedAt = time.Now()
-
 	return nil
 }
 
-func (m *MemoryManager) UpdateTaskStatus(taskID, status string) error {
+// RecordTaskCommit notes a commit made from the task's patches and marks the
+// task applied. Further commits of an applied task are added to its list.
+func (m *MemoryManager) RecordTaskCommit(taskID, commit string) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -259,12 +323,21 @@ func (m *MemoryManager) UpdateTaskStatus(taskID, status string) error {
 		return errors.New("task not found")
 	}
 
-	task.Status = status
+	if task.Status != StatusApplied {
+		if _, err := m.transitionLocked(task, StatusApplied, "committed "+commit); err != nil {
+			return err
+		}
+	}
+	task.Commits = append(task.Commits, commit)
 	task.UpdatedAt = time.Now()
+
 	return nil
 }
 
-func (m *MemoryManager) AddPatchesToTask(taskID string, patches []Patch) error {
+// RecordTaskRevert notes that the task's commits were undone and marks the
+// task reverted. The commits move into the revert record, so a later apply
+// starts a fresh list.
+func (m *MemoryManager) RecordTaskRevert(taskID string, revert Revert) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -273,7 +346,32 @@ func (m *MemoryManager) AddPatchesToTask(taskID string, patches []Patch) error {
 		return errors.New("task not found")
 	}
 
-	task.Patches = append(task.Patches, patches...)
-	task.UpdatedAt = time.Now()
+	if _, err := m.transitionLocked(task, StatusReverted, revert.Mode+" of the applied commits"); err != nil {
+		return err
+	}
+	revert.Commits = task.Commits
+	task.Commits = nil
+	task.Reverts = append(task.Reverts, revert)
+
 	return nil
 }
+
+// SetTaskPatches replaces a task's patches with a fresh set and returns the
+// patch version. The version only moves on if the patches changed.
+func (m *MemoryManager) SetTaskPatches(taskID string, patches []Patch) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	task, exists := m.tasks[taskID]
+	if !exists {
+		return 0, errors.New("task not found")
+	}
+
+	if task.PatchVersion > 0 && reflect.DeepEqual(task.Patches, patches) {
+		return task.PatchVersion, nil
+	}
+	task.Patches = patches
+	task.PatchVersion++
+	task.UpdatedAt = time.Now()
+	return task.PatchVersion, nil
+}
@@ -0,0 +1,28 @@
+package session
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestOnEndReportsEndedAndExpiredSessions(t *testing.T) {
+	m := NewMemoryManager()
+	var ended []string
+	m.OnEnd(func(sessionID string) { ended = append(ended, sessionID) })
+
+	closed, _ := m.Create(context.Background(), "/repo", time.Hour)
+	stale, _ := m.Create(context.Background(), "/repo", time.Millisecond)
+	live, _ := m.Create(context.Background(), "/repo", time.Hour)
+
+	m.End(context.Background(), closed.ID)
+	m.End(context.Background(), closed.ID)
+	m.removeExpired(time.Now().Add(time.Second))
+
+	if len(ended) != 2 || ended[0] != closed.ID || ended[1] != stale.ID {
+		t.Errorf("Expected the ended and the expired session, got %v", ended)
+	}
+	if _, ok := m.Get(context.Background(), live.ID); !ok {
+		t.Error("Expected the live session to be kept")
+	}
+}
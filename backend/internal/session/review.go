@@ -0,0 +1,145 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrNoComments is returned when changes are requested without any open
+// comments
+var ErrNoComments = errors.New("no open comments")
+
+// Comment is a review note on a task's patches. It points at a file, and
+// optionally one hunk and one line of it; Side says whether Line counts in
+// the old or new version of the file. Round is the follow-up the comment
+// was sent to the agent in, zero while it is still open.
+type Comment struct {
+	ID        string    `json:"id"`
+	File      string    `json:"file"`
+	Hunk      *int      `json:"hunk,omitempty"`
+	Line      int       `json:"line,omitempty"`
+	Side      string    `json:"side,omitempty"`
+	Excerpt   string    `json:"excerpt,omitempty"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"createdAt"`
+	Round     int       `json:"round,omitempty"`
+}
+
+// FollowUp is an instruction sent back to a task's agent after review
+type FollowUp struct {
+	Round       int       `json:"round"`
+	Instruction string    `json:"instruction"`
+	Comments    []string  `json:"comments"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// AddTaskComment stores a review comment on a task
+func (m *MemoryManager) AddTaskComment(taskID string, comment Comment) (Comment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	task, exists := m.tasks[taskID]
+	if !exists {
+		return Comment{}, errors.New("task not found")
+	}
+
+	comment.ID = generateID()
+	comment.CreatedAt = time.Now()
+	comment.Round = 0
+	task.Comments = append(task.Comments, comment)
+	task.UpdatedAt = time.Now()
+
+	return comment, nil
+}
+
+// GetTaskComments returns a task's review comments, oldest first
+func (m *MemoryManager) GetTaskComments(taskID string) ([]Comment, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	task, exists := m.tasks[taskID]
+	if !exists {
+		return nil, errors.New("task not found")
+	}
+
+	return append([]Comment{}, task.Comments...), nil
+}
+
+// RequestChanges turns a task's open comments into a follow-up instruction
+// for its agent, marks them as sent and moves the task from awaiting_review
+// to changes_requested
+func (m *MemoryManager) RequestChanges(taskID, summary string) (FollowUp, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	task, exists := m.tasks[taskID]
+	if !exists {
+		return FollowUp{}, errors.New("task not found")
+	}
+	if !CanTransition(task.Status, StatusChangesRequested) {
+		return FollowUp{}, fmt.Errorf("%w from %s to %s", ErrInvalidTransition, task.Status, StatusChangesRequested)
+	}
+
+	var open []Comment
+	for _, comment := range task.Comments {
+		if comment.Round == 0 {
+			open = append(open, comment)
+		}
+	}
+	if len(open) == 0 {
+		return FollowUp{}, ErrNoComments
+	}
+
+	followUp := FollowUp{
+		Round:       len(task.FollowUps) + 1,
+		Instruction: ReviewInstruction(task.Instruction, open, summary),
+		CreatedAt:   time.Now(),
+	}
+	for i := range task.Comments {
+		if task.Comments[i].Round == 0 {
+			task.Comments[i].Round = followUp.Round
+			followUp.Comments = append(followUp.Comments, task.Comments[i].ID)
+		}
+	}
+
+	task.FollowUps = append(task.FollowUps, followUp)
+	m.transitionLocked(task, StatusChangesRequested, fmt.Sprintf("review round %d", followUp.Round))
+
+	return followUp, nil
+}
+
+// ReviewInstruction writes review comments up as an instruction for the
+// agent that made the changes
+func ReviewInstruction(original string, comments []Comment, summary string) string {
+	var b strings.Builder
+	b.WriteString("Your changes were reviewed and need another pass.\n\n")
+	fmt.Fprintf(&b, "Original task: %s\n\n", strings.TrimSpace(original))
+	if summary = strings.TrimSpace(summary); summary != "" {
+		fmt.Fprintf(&b, "Reviewer summary: %s\n\n", summary)
+	}
+
+	b.WriteString("Address each review comment:\n")
+	for i, comment := range comments {
+		fmt.Fprintf(&b, "\n%d. %s", i+1, comment.File)
+		if comment.Line > 0 {
+			fmt.Fprintf(&b, ", line %d", comment.Line)
+			if comment.Side == "old" {
+				b.WriteString(" of the old version")
+			}
+		}
+		b.WriteString("\n")
+		if comment.Excerpt != "" {
+			for _, line := range strings.Split(strings.TrimRight(comment.Excerpt, "\n"), "\n") {
+				fmt.Fprintf(&b, "   > %s\n", line)
+			}
+		}
+		for _, line := range strings.Split(strings.TrimSpace(comment.Body), "\n") {
+			fmt.Fprintf(&b, "   %s\n", line)
+		}
+	}
+
+	b.WriteString("\nKeep the rest of your changes as they are and work in the same workspace.\n")
+	return b.String()
+}
@@ -0,0 +1,59 @@
+package session
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRequestChanges(t *testing.T) {
+	m := NewMemoryManager()
+	sessionID, _, err := m.CreateSession("/repo", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	taskID, _ := m.CreateTask(sessionID, "Add a flag", "", nil, "claude")
+	m.AddTaskComment(taskID, Comment{File: "main.go", Body: "Too early"})
+	if _, err := m.RequestChanges(taskID, ""); !errors.Is(err, ErrInvalidTransition) {
+		t.Fatalf("Expected changes not to be requested before review, got %v", err)
+	}
+
+	taskID, _ = m.CreateTask(sessionID, "Add a flag", "", nil, "claude")
+	reachReview := func() {
+		for _, status := range []string{StatusPlanning, StatusRunning, StatusAwaitingReview} {
+			if _, err := m.TransitionTask(taskID, status, ""); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	reachReview()
+
+	if _, err := m.RequestChanges(taskID, ""); !errors.Is(err, ErrNoComments) {
+		t.Fatalf("Expected ErrNoComments, got %v", err)
+	}
+
+	m.AddTaskComment(taskID, Comment{File: "main.go", Line: 12, Side: "new", Excerpt: "flag.Bool(\"x\")", Body: "Name it verbose"})
+	m.AddTaskComment(taskID, Comment{File: "README.md", Body: "Document the flag"})
+
+	followUp, err := m.RequestChanges(taskID, "Nearly there")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"Original task: Add a flag", "Reviewer summary: Nearly there", "1. main.go, line 12\n", "> flag.Bool(\"x\")", "Name it verbose", "2. README.md\n"} {
+		if !strings.Contains(followUp.Instruction, want) {
+			t.Errorf("Expected %q in instruction:\n%s", want, followUp.Instruction)
+		}
+	}
+	if followUp.Round != 1 || len(followUp.Comments) != 2 {
+		t.Errorf("Unexpected follow-up %+v", followUp)
+	}
+
+	task, _ := m.GetTask(taskID)
+	if task.Status != "changes_requested" || task.Comments[0].Round != 1 {
+		t.Errorf("Expected the comments to be sent and the task to wait for changes, got %+v", task)
+	}
+	reachReview()
+	if _, err := m.RequestChanges(taskID, ""); !errors.Is(err, ErrNoComments) {
+		t.Errorf("Expected sent comments not to be sent again, got %v", err)
+	}
+}
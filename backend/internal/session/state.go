@@ -0,0 +1,122 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrInvalidTransition is returned when a task is moved to a status it
+// cannot reach from its current one
+var ErrInvalidTransition = errors.New("invalid task transition")
+
+// Task statuses
+const (
+	StatusQueued           = "queued"
+	StatusPlanning         = "planning"
+	StatusRunning          = "running"
+	StatusPaused           = "paused"
+	StatusAwaitingReview   = "awaiting_review"
+	StatusChangesRequested = "changes_requested"
+	StatusApplied          = "applied"
+	StatusReverted         = "reverted"
+	StatusDiscarded        = "discarded"
+	StatusFailed           = "failed"
+	StatusCancelled        = "cancelled"
+	StatusTimedOut         = "timed_out"
+)
+
+// transitions lists the statuses each status may move to. A task moves from
+// queued through planning and running to awaiting_review, and from there is
+// applied or discarded, or sent back to its agent with changes requested. A
+// running task can be paused and resumed. Failed, cancelled, timed out and
+// discarded tasks go nowhere else.
+var transitions = map[string][]string{
+	StatusQueued:           {StatusPlanning, StatusFailed, StatusCancelled},
+	StatusPlanning:         {StatusRunning, StatusFailed, StatusCancelled, StatusTimedOut},
+	StatusRunning:          {StatusAwaitingReview, StatusPaused, StatusFailed, StatusCancelled, StatusTimedOut},
+	StatusPaused:           {StatusRunning, StatusFailed, StatusCancelled, StatusTimedOut},
+	StatusAwaitingReview:   {StatusApplied, StatusDiscarded, StatusChangesRequested},
+	StatusChangesRequested: {StatusPlanning, StatusDiscarded},
+	StatusApplied:          {StatusReverted},
+	StatusReverted:         {StatusApplied, StatusDiscarded},
+}
+
+// Transition is one change of a task's status
+type Transition struct {
+	From   string    `json:"from,omitempty"`
+	To     string    `json:"to"`
+	Reason string    `json:"reason,omitempty"`
+	At     time.Time `json:"at"`
+}
+
+// CanTransition reports whether a task may move from one status to another
+func CanTransition(from, to string) bool {
+	for _, next := range transitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// IsTerminal reports whether a status is final
+func IsTerminal(status string) bool {
+	_, known := transitions[status]
+	return !known
+}
+
+// WorkspaceDone reports whether a task with status has no further use for
+// its worktree: its changes were applied or it ended
+func WorkspaceDone(status string) bool {
+	return status == StatusApplied || IsTerminal(status)
+}
+
+// EndedAt returns when a task reached a final status, if it has
+func (t *Task) EndedAt() *time.Time {
+	if len(t.Transitions) == 0 || !IsTerminal(t.Status) {
+		return nil
+	}
+	at := t.Transitions[len(t.Transitions)-1].At
+	return &at
+}
+
+// OnTransition sets a function called with a copy of the task after every
+// change of a task's status. It runs with the manager locked, so it must not
+// call back into the manager.
+func (m *MemoryManager) OnTransition(fn func(Task, Transition)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.onTransition = fn
+}
+
+// TransitionTask moves a task to a new status, recording why
+func (m *MemoryManager) TransitionTask(taskID, to, reason string) (Transition, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	task, exists := m.tasks[taskID]
+	if !exists {
+		return Transition{}, errors.New("task not found")
+	}
+
+	return m.transitionLocked(task, to, reason)
+}
+
+// transitionLocked validates and records a change of a task's status
+func (m *MemoryManager) transitionLocked(task *Task, to, reason string) (Transition, error) {
+	if task.Status != "" && !CanTransition(task.Status, to) {
+		return Transition{}, fmt.Errorf("%w from %s to %s", ErrInvalidTransition, task.Status, to)
+	}
+
+	transition := Transition{From: task.Status, To: to, Reason: reason, At: time.Now()}
+	task.Status = to
+	task.Transitions = append(task.Transitions, transition)
+	task.UpdatedAt = transition.At
+
+	if m.onTransition != nil {
+		m.onTransition(*task, transition)
+	}
+	return transition, nil
+}
@@ -0,0 +1,64 @@
+package session
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestTaskTransitions(t *testing.T) {
+	m := NewMemoryManager()
+	sessionID, _, err := m.CreateSession("/repo", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var seen []Transition
+	m.OnTransition(func(task Task, transition Transition) {
+		seen = append(seen, transition)
+	})
+
+	taskID, _ := m.CreateTask(sessionID, "Add a flag", "", nil, "claude")
+	if _, err := m.TransitionTask(taskID, StatusAwaitingReview, ""); !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("Expected queued to awaiting_review to be refused, got %v", err)
+	}
+
+	for _, status := range []string{StatusPlanning, StatusRunning, StatusAwaitingReview} {
+		if _, err := m.TransitionTask(taskID, status, "step"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := m.RecordTaskCommit(taskID, "abc123"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.RecordTaskCommit(taskID, "def456"); err != nil {
+		t.Errorf("Expected an applied task to take more commits, got %v", err)
+	}
+
+	task, _ := m.GetTask(taskID)
+	if task.Status != StatusApplied || len(task.Commits) != 2 {
+		t.Errorf("Expected an applied task with two commits, got %+v", task)
+	}
+	if task.EndedAt() != nil {
+		t.Error("Expected an applied task not to have ended, since it can be reverted")
+	}
+
+	want := []string{StatusQueued, StatusPlanning, StatusRunning, StatusAwaitingReview, StatusApplied}
+	if len(task.Transitions) != len(want) || len(seen) != len(want) {
+		t.Fatalf("Expected %d transitions, got %+v (published %d)", len(want), task.Transitions, len(seen))
+	}
+	for i, transition := range task.Transitions {
+		if transition.To != want[i] || (i > 0 && transition.From != want[i-1]) || transition.At.IsZero() {
+			t.Errorf("Unexpected transition %d: %+v", i, transition)
+		}
+	}
+
+	failedID, _ := m.CreateTask(sessionID, "Break it", "", nil, "claude")
+	m.TransitionTask(failedID, StatusFailed, "unknown agent")
+	if _, err := m.TransitionTask(failedID, StatusPlanning, ""); !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("Expected a failed task to stay failed, got %v", err)
+	}
+	failed, _ := m.GetTask(failedID)
+	if failed.EndedAt() == nil || failed.Transitions[1].Reason != "unknown agent" {
+		t.Errorf("Expected the failure to be recorded with its reason, got %+v", failed.Transitions)
+	}
+}
@@ -0,0 +1,143 @@
+package session
+
+import (
+	"errors"
+	"time"
+)
+
+// Transcript message types
+const (
+	MessageUser         = "user"
+	MessageAgent        = "agent"
+	MessageConfirmation = "confirmation"
+)
+
+var (
+	// ErrNoActiveTask is returned when a message is sent to a session none
+	// of whose tasks has its agent at work
+	ErrNoActiveTask = errors.New("no task is running")
+	// ErrNoConfirmation is returned when answering a message that is not a
+	// confirmation request of the task
+	ErrNoConfirmation = errors.New("confirmation not found")
+	// ErrAnswered is returned when answering a confirmation a second time
+	ErrAnswered = errors.New("confirmation already answered")
+)
+
+// Message is one entry of a task's conversation with its agent. A
+// confirmation is the agent asking the user for approval; Confirmed and
+// AnsweredAt are set once it is answered, and Reason says why when the
+// backend answered for the user, e.g. because nobody did in time.
+type Message struct {
+	ID         string     `json:"id"`
+	Type       string     `json:"type"`
+	Content    string     `json:"content"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	Confirmed  *bool      `json:"confirmed,omitempty"`
+	Reason     string     `json:"reason,omitempty"`
+	AnsweredAt *time.Time `json:"answeredAt,omitempty"`
+}
+
+// AddTaskMessage appends a message to a task's transcript
+func (m *MemoryManager) AddTaskMessage(taskID, kind, content string) (Message, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	task, exists := m.tasks[taskID]
+	if !exists {
+		return Message{}, errors.New("task not found")
+	}
+
+	message := Message{ID: generateID(), Type: kind, Content: content, CreatedAt: time.Now()}
+	task.Transcript = append(task.Transcript, message)
+	task.UpdatedAt = message.CreatedAt
+
+	return message, nil
+}
+
+// AnswerTaskConfirmation records the answer to a confirmation request. Only
+// the first answer counts.
+func (m *MemoryManager) AnswerTaskConfirmation(taskID, messageID string, confirmed bool, reason string) (Message, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	task, exists := m.tasks[taskID]
+	if !exists {
+		return Message{}, errors.New("task not found")
+	}
+
+	for i, message := range task.Transcript {
+		if message.ID != messageID || message.Type != MessageConfirmation {
+			continue
+		}
+		if message.AnsweredAt != nil {
+			return message, ErrAnswered
+		}
+
+		now := time.Now()
+		message.Confirmed = &confirmed
+		message.Reason = reason
+		message.AnsweredAt = &now
+
+		// Copies of the task handed out earlier keep the old transcript
+		transcript := append([]Message{}, task.Transcript...)
+		transcript[i] = message
+		task.Transcript = transcript
+		task.UpdatedAt = now
+		return message, nil
+	}
+	return Message{}, ErrNoConfirmation
+}
+
+// GetTaskTranscript returns a task's conversation with its agent, oldest
+// first
+func (m *MemoryManager) GetTaskTranscript(taskID string) ([]Message, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	task, exists := m.tasks[taskID]
+	if !exists {
+		return nil, errors.New("task not found")
+	}
+
+	return append([]Message{}, task.Transcript...), nil
+}
+
+// FindTaskMessage returns the task of a session whose transcript holds a
+// message
+func (m *MemoryManager) FindTaskMessage(sessionID, messageID string) (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, task := range m.tasks {
+		if task.SessionID != sessionID {
+			continue
+		}
+		for _, message := range task.Transcript {
+			if message.ID == messageID {
+				return task.ID, nil
+			}
+		}
+	}
+	return "", ErrNoConfirmation
+}
+
+// ActiveTask returns the session's most recently created task whose agent
+// is running or paused
+func (m *MemoryManager) ActiveTask(sessionID string) (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var active *Task
+	for _, task := range m.tasks {
+		if task.SessionID != sessionID || (task.Status != StatusRunning && task.Status != StatusPaused) {
+			continue
+		}
+		if active == nil || task.CreatedAt.After(active.CreatedAt) {
+			active = task
+		}
+	}
+	if active == nil {
+		return "", ErrNoActiveTask
+	}
+	return active.ID, nil
+}
@@ -3,20 +3,38 @@ import { View, Text, ScrollView, StyleSheet, TextStyle } from 'react-native'
 import { Card, CardContent, CardHeader, CardTitle } from './ui/Card'
 import { Button } from './ui/Button'
 
+export interface DiffLine {
+  kind: 'context' | 'added' | 'deleted'
+  content: string
+  oldLine?: number
+  newLine?: number
+  noNewline?: boolean
+}
+
 export interface Hunk {
   startOld: number
   lenOld: number
   startNew: number
   lenNew: number
-  lines: string[]
+  section?: string
+  lines: DiffLine[]
 }
 
 export interface Patch {
   file: string
-  patch: string
+  content: string
+  type: 'added' | 'modified' | 'deleted' | 'renamed' | 'copied' | 'binary'
+  oldPath?: string
+  newPath?: string
+  oldMode?: string
+  mode?: string
+  similarity?: number
+  isBinary: boolean
   hunks: Hunk[]
 }
 
+const linePrefix = { context: ' ', added: '+', deleted: '-' }
+
 export interface DiffListProps {
   patches: Patch[]
   onSelectHunk: (file: string, hunkIndex: number) => void
@@ -32,7 +50,7 @@ export function DiffList({ patches, onSelectHunk, selectedHunks }: DiffListProps
       <View key={hunkIndex} style={styles.hunk}>
         <View style={styles.hunkHeader}>
           <Text style={styles.hunkInfo}>
-            @{hunk.startOld},{hunk.lenOld} +{hunk.startNew},{hunk.lenNew}
+            @{hunk.startOld},{hunk.lenOld} +{hunk.startNew},{hunk.lenNew} {hunk.section}
           </Text>
           <Button
             title={isSelected ? 'Deselect' : 'Select'}
@@ -44,17 +62,23 @@ export function DiffList({ patches, onSelectHunk, selectedHunks }: DiffListProps
         <View style={styles.hunkLines}>
           {hunk.lines.map((line, lineIndex) => {
             let lineStyle: TextStyle = styles.line
-            if (line.startsWith('+')) {
+            if (line.kind === 'added') {
               lineStyle = StyleSheet.flatten([styles.line, styles.lineAdded])
-            } else if (line.startsWith('-')) {
+            } else if (line.kind === 'deleted') {
               lineStyle = StyleSheet.flatten([styles.line, styles.lineRemoved])
-            } else if (line.startsWith('\\')) {
-              lineStyle = StyleSheet.flatten([styles.line, styles.lineContext])
             }
             return (
-              <Text key={lineIndex} style={lineStyle}>
-                {line}
-              </Text>
+              <React.Fragment key={lineIndex}>
+                <Text style={lineStyle}>
+                  {linePrefix[line.kind]}
+                  {line.content}
+                </Text>
+                {line.noNewline && (
+                  <Text style={StyleSheet.flatten([styles.line, styles.lineContext])}>
+                    \ No newline at end of file
+                  </Text>
+                )}
+              </React.Fragment>
             )
           })}
         </View>
@@ -67,9 +91,17 @@ export function DiffList({ patches, onSelectHunk, selectedHunks }: DiffListProps
       {patches.map((patch, patchIndex) => (
         <Card key={patchIndex}>
           <CardHeader>
-            <CardTitle style={styles.fileName}>{patch.file}</CardTitle>
+            <CardTitle style={styles.fileName}>
+              {patch.oldPath && patch.oldPath !== patch.file ? `${patch.oldPath} → ${patch.file}` : patch.file}
+            </CardTitle>
+            {patch.oldMode && patch.mode && patch.oldMode !== patch.mode && (
+              <Text style={styles.fileNote}>
+                mode {patch.oldMode} → {patch.mode}
+              </Text>
+            )}
           </CardHeader>
           <CardContent>
+            {patch.isBinary && <Text style={styles.fileNote}>Binary file changed</Text>}
             <View style={styles.patch}>
               {patch.hunks.map((hunk, hunkIndex) =>
                 renderHunk(hunk, hunkIndex, patch.file)
@@ -91,6 +123,10 @@ const styles = StyleSheet.create({
     fontWeight: '600',
     marginBottom: 8,
   },
+  fileNote: {
+    fontSize: 12,
+    color: '#6B7280',
+  },
   patch: {
     marginTop: 8,
   },
@@ -6,28 +6,105 @@ export interface ApiResponse<T = any> {
   error?: string
 }
 
+export type TaskStatus =
+  | 'queued'
+  | 'planning'
+  | 'running'
+  | 'paused'
+  | 'awaiting_review'
+  | 'changes_requested'
+  | 'applied'
+  | 'reverted'
+  | 'discarded'
+  | 'failed'
+  | 'cancelled'
+  | 'timed_out'
+
+export interface TaskTransition {
+  from?: TaskStatus
+  to: TaskStatus
+  reason?: string
+  at: string
+}
+
 export interface Task {
   id: string
   instruction: string
   branch: string
-  status: 'pending' | 'running' | 'completed' | 'failed'
+  status: TaskStatus
   agent: string
   createdAt: string
   updatedAt: string
+  transitions?: TaskTransition[]
+  patchVersion?: number
+}
+
+export interface DiffLine {
+  kind: 'context' | 'added' | 'deleted'
+  content: string
+  oldLine?: number
+  newLine?: number
+  noNewline?: boolean
 }
 
 export interface Patch {
   file: string
-  patch: string
+  content: string
+  type: 'added' | 'modified' | 'deleted' | 'renamed' | 'copied' | 'binary'
+  oldPath?: string
+  newPath?: string
+  oldMode?: string
+  mode?: string
+  similarity?: number
+  isBinary: boolean
   hunks: Array<{
     startOld: number
     lenOld: number
     startNew: number
     lenNew: number
-    lines: string[]
+    section?: string
+    lines: DiffLine[]
   }>
 }
 
+export interface HunkConflict {
+  hunk: number
+  ours: string
+  base: string
+  theirs: string
+}
+
+export interface FileResult {
+  file: string
+  hunks: number[]
+  status: 'applied' | 'failed' | 'conflicted'
+  error?: string
+  drifted?: boolean
+  conflicts?: HunkConflict[]
+}
+
+export interface ReviewComment {
+  id: string
+  file: string
+  hunk?: number
+  line?: number
+  side?: 'new' | 'old'
+  excerpt?: string
+  body: string
+  createdAt: string
+  round?: number
+}
+
+export interface TranscriptMessage {
+  id: string
+  type: 'user' | 'agent' | 'confirmation'
+  content: string
+  createdAt: string
+  confirmed?: boolean
+  reason?: string
+  answeredAt?: string
+}
+
 export interface PatchSelection {
   file: string
   hunks: number[]
@@ -95,10 +172,10 @@ class ApiClient {
     return this.request(`/api/session/${id}`)
   }
 
-  async createTask(instruction: string, branch: string, context: any, agent: string): Promise<Task> {
+  async createTask(instruction: string, branch: string, context: any, agent: string, maxRuntimeSeconds?: number): Promise<Task> {
     return this.request('/api/tasks', {
       method: 'POST',
-      body: JSON.stringify({ instruction, branch, context, agent }),
+      body: JSON.stringify({ instruction, branch, context, agent, maxRuntimeSeconds }),
     })
   }
 
@@ -106,10 +183,18 @@ class ApiClient {
     return this.request(`/api/tasks/${id}`)
   }
 
-  async getTaskPatches(id: string): Promise<{ patches: Patch[] }> {
+  async getTaskPatches(id: string): Promise<{ patches: Patch[]; version?: number }> {
     return this.request(`/api/tasks/${id}/patches`)
   }
 
+  async getTaskTranscript(id: string): Promise<{ taskId: string; messages: TranscriptMessage[] }> {
+    return this.request(`/api/tasks/${id}/transcript`)
+  }
+
+  async refreshTaskPatches(id: string): Promise<{ patches: Patch[]; version?: number }> {
+    return this.request(`/api/tasks/${id}/patches/refresh`, { method: 'POST' })
+  }
+
   async applyTaskPatches(id: string, selections: PatchSelection[], commitMessage: string): Promise<any> {
     return this.request(`/api/tasks/${id}/apply`, {
       method: 'POST',
@@ -117,6 +202,82 @@ class ApiClient {
     })
   }
 
+  async addTaskComment(
+    id: string,
+    comment: { file: string; hunk?: number; line?: number; side?: 'new' | 'old'; body: string }
+  ): Promise<ReviewComment> {
+    return this.request(`/api/tasks/${id}/comments`, {
+      method: 'POST',
+      body: JSON.stringify(comment),
+    })
+  }
+
+  async getTaskComments(id: string): Promise<{ comments: ReviewComment[] }> {
+    return this.request(`/api/tasks/${id}/comments`)
+  }
+
+  async requestChanges(id: string, summary?: string): Promise<any> {
+    return this.request(`/api/tasks/${id}/request-changes`, {
+      method: 'POST',
+      body: JSON.stringify({ summary }),
+    })
+  }
+
+  async cancelTask(id: string, keepWorkspace = false, reason?: string): Promise<any> {
+    return this.request(`/api/tasks/${id}/cancel`, {
+      method: 'POST',
+      body: JSON.stringify({ keepWorkspace, reason }),
+    })
+  }
+
+  async pauseTask(id: string): Promise<any> {
+    return this.request(`/api/tasks/${id}/pause`, { method: 'POST' })
+  }
+
+  async resumeTask(id: string): Promise<any> {
+    return this.request(`/api/tasks/${id}/resume`, { method: 'POST' })
+  }
+
+  async revertTask(id: string, mode: 'revert' | 'reset', commitMessage?: string): Promise<any> {
+    return this.request(`/api/tasks/${id}/revert`, {
+      method: 'POST',
+      body: JSON.stringify({ mode, commitMessage }),
+    })
+  }
+
+  async pushTask(id: string, options: { remote?: string; remoteBranch?: string; force?: boolean } = {}): Promise<any> {
+    return this.request(`/api/tasks/${id}/push`, {
+      method: 'POST',
+      body: JSON.stringify(options),
+    })
+  }
+
+  async formatPatch(id: string, format: 'mbox' | 'zip' = 'mbox'): Promise<Blob> {
+    const response = await fetch(`${this.apiBase}/api/tasks/${id}/format-patch?format=${format}`, {
+      headers: await this.getHeaders(),
+    })
+    if (!response.ok) {
+      throw new Error(`HTTP error! status: ${response.status}`)
+    }
+    return response.blob()
+  }
+
+  async getGitStatus(taskId?: string): Promise<any> {
+    return this.request(`/api/git/status${taskId ? `?taskId=${taskId}` : ''}`)
+  }
+
+  async getGitBranches(): Promise<any> {
+    return this.request('/api/git/branches')
+  }
+
+  async getGitLog(params: { ref?: string; path?: string; since?: string; skip?: number; limit?: number } = {}): Promise<any> {
+    const query = new URLSearchParams()
+    Object.entries(params).forEach(([key, value]) => {
+      if (value !== undefined) query.append(key, String(value))
+    })
+    return this.request(`/api/git/log?${query.toString()}`)
+  }
+
   async runCommand(cmd: string, cwd: string, timeoutMs: number): Promise<any> {
     return this.request('/api/cmd', {
       method: 'POST',
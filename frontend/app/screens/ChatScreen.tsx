@@ -23,14 +23,22 @@ function ChatScreenContent({ navigation }: ChatScreenProps) {
   const [inputText, setInputText] = useState('')
   const scrollViewRef = useRef<ScrollView>(null)
 
-  // Combine local messages with WebSocket messages
-  const allMessages = [...localMessages, ...wsMessages.map((msg: any, index: number) => ({
-    id: `ws-${index}`,
-    type: msg.type === 'user' ? 'user' : 'agent',
-    content: msg.content || JSON.stringify(msg),
-    timestamp: new Date(),
-    status: msg.status
-  }))]
+  // Answers to the agent's confirmations, by message ID
+  const answers = new Map<string, Message['status']>(wsMessages
+    .filter((msg: any) => msg.type === 'confirmation_answered')
+    .map((msg: any) => [msg.messageId, msg.confirmed ? 'confirmed' : 'cancelled']))
+
+  // Combine local messages with the agent's messages from the WebSocket
+  const allMessages = [...localMessages, ...wsMessages
+    .map((msg: any, index: number) => ({ msg, index }))
+    .filter(({ msg }: any) => ['agent', 'confirmation', 'error'].includes(msg.type))
+    .map(({ msg, index }: any): Message => ({
+      id: msg.type === 'error' || !msg.messageId ? `ws-${index}` : msg.messageId,
+      type: msg.type === 'error' ? 'system' : msg.type,
+      content: msg.type === 'error' ? msg.message : msg.content,
+      timestamp: msg.time ? new Date(msg.time) : new Date(),
+      status: answers.get(msg.messageId) ?? msg.status
+    }))]
 
   useEffect(() => {
     const loadConnectionInfo = async () => {
@@ -153,7 +161,7 @@ function ChatScreenContent({ navigation }: ChatScreenProps) {
             {message.content}
           </Text>
           
-          {message.type === 'confirmation' && (
+          {message.type === 'confirmation' && !message.status && (
             <View style={styles.confirmationButtons}>
               <Button
                 title="Confirm"
@@ -3,7 +3,7 @@ import { View, Text, StyleSheet, Alert, ScrollView } from 'react-native'
 import { Button } from '../components/ui/Button'
 import { Card, CardContent, CardHeader, CardTitle } from '../components/ui/Card'
 import { DiffList } from '../components/DiffList'
-import { apiClient } from '../lib/api'
+import { apiClient, FileResult } from '../lib/api'
 import { getConnectionInfo } from '../lib/storage'
 
 interface DiffsScreenProps {
@@ -90,8 +90,18 @@ export function DiffsScreen({ navigation }: DiffsScreenProps) {
         })
       })
 
-      await apiClient.applyTaskPatches(taskId, selections, 'Apply selected hunks')
-      Alert.alert('Success', 'Patches applied successfully!')
+      const result = await apiClient.applyTaskPatches(taskId, selections, 'Apply selected hunks')
+      const conflicts = (result.files as FileResult[]).flatMap(file =>
+        (file.conflicts || []).map(conflict => `${file.file} hunk ${conflict.hunk}\nCurrent:\n${conflict.ours}Patch:\n${conflict.theirs}`)
+      )
+      if (conflicts.length > 0) {
+        Alert.alert(
+          'Applied with conflicts',
+          `Committed ${result.commit.slice(0, 7)} on ${result.branch}. These hunks clash with newer changes and were left out:\n\n${conflicts.join('\n')}`
+        )
+      } else {
+        Alert.alert('Success', `Committed ${result.commit.slice(0, 7)} on ${result.branch}`)
+      }
       setSelectedHunks(new Set())
       await loadPatches() // Refresh patches
     } catch (error) {